@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"gitlab-status/models"
+)
+
+// BackupCounts is how much a backup holds
+type BackupCounts struct {
+	Users      int
+	Selections int
+	Incidents  int
+}
+
+// String summarizes the counts for the log
+func (c BackupCounts) String() string {
+	return fmt.Sprintf("%d users, %d selected projects and %d incidents", c.Users, c.Selections, c.Incidents)
+}
+
+// WriteBackup writes the users with their settings and selected projects and the incidents as JSON.
+// GitLab tokens are written as stored, so they stay encrypted when ENCRYPTION_KEY is set.
+func WriteBackup(ctx context.Context, w io.Writer) (BackupCounts, error) {
+	var counts BackupCounts
+	var users []models.User
+	if err := DB.NewSelect().Model(&users).Order("id").Scan(ctx); err != nil {
+		return counts, fmt.Errorf("error loading users: %v", err)
+	}
+	var selections []models.SelectedProject
+	if err := DB.NewSelect().Model(&selections).Order("user_id", "id").Scan(ctx); err != nil {
+		return counts, fmt.Errorf("error loading selected projects: %v", err)
+	}
+	var incidents []models.Incident
+	if err := DB.NewSelect().Model(&incidents).Order("id").Scan(ctx); err != nil {
+		return counts, fmt.Errorf("error loading incidents: %v", err)
+	}
+
+	userSelections := make(map[int64][]models.BackupSelection)
+	for _, selection := range selections {
+		userSelections[selection.UserID] = append(userSelections[selection.UserID], models.BackupSelection{
+			ProjectID:   selection.ProjectID,
+			Path:        selection.Path,
+			Ref:         selection.Ref,
+			Criticality: selection.Criticality,
+			CreatedAt:   selection.CreatedAt,
+		})
+	}
+
+	backup := models.Backup{
+		Version:   models.BackupVersion,
+		CreatedAt: time.Now().UTC(),
+		Users:     make([]models.BackupUser, 0, len(users)),
+		Incidents: make([]models.BackupIncident, 0, len(incidents)),
+	}
+	for _, user := range users {
+		if userSelections[user.ID] == nil {
+			userSelections[user.ID] = []models.BackupSelection{}
+		}
+		backup.Users = append(backup.Users, models.BackupUser{
+			ID:             user.ID,
+			Username:       user.Username,
+			Password:       user.Password,
+			GitLabToken:    user.GitLabToken,
+			GitLabURL:      user.GitLabURL,
+			StatusPalette:  user.StatusPalette,
+			StatusShapes:   user.StatusShapes,
+			ExportLocale:   user.ExportLocale,
+			ExportTimezone: user.ExportTimezone,
+			CreatedAt:      user.CreatedAt,
+			UpdatedAt:      user.UpdatedAt,
+			Selections:     userSelections[user.ID],
+		})
+		counts.Selections += len(userSelections[user.ID])
+	}
+	for _, incident := range incidents {
+		backup.Incidents = append(backup.Incidents, models.BackupIncident{
+			Title:         incident.Title,
+			AffectedPaths: incident.AffectedPaths,
+			StartedAt:     incident.StartedAt,
+			ResolvedAt:    incident.ResolvedAt,
+			DeclaredBy:    incident.DeclaredBy,
+			ResolvedBy:    incident.ResolvedBy,
+			CreatedAt:     incident.CreatedAt,
+		})
+	}
+	counts.Users, counts.Incidents = len(backup.Users), len(backup.Incidents)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(backup); err != nil {
+		return counts, fmt.Errorf("error writing backup: %v", err)
+	}
+	return counts, nil
+}
+
+// RestoreBackup loads a backup written by WriteBackup in one transaction. A database that
+// already has users is only overwritten with replace, which deletes its users, their selected
+// projects and sessions and the incidents first. The GitLab cache is left alone.
+func RestoreBackup(ctx context.Context, r io.Reader, replace bool) (BackupCounts, error) {
+	var counts BackupCounts
+	var backup models.Backup
+	if err := json.NewDecoder(r).Decode(&backup); err != nil {
+		return counts, fmt.Errorf("error reading backup: %v", err)
+	}
+	if backup.Version != models.BackupVersion {
+		return counts, fmt.Errorf("unsupported backup version %d, expected %d", backup.Version, models.BackupVersion)
+	}
+
+	err := DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		existing, err := tx.NewSelect().Model((*models.User)(nil)).Count(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to check users: %v", err)
+		}
+		if existing > 0 && !replace {
+			return fmt.Errorf("the database already has %d users, restore with -replace to overwrite them", existing)
+		}
+		for _, model := range []interface{}{
+			(*models.Session)(nil),
+			(*models.SelectedProject)(nil),
+			(*models.User)(nil),
+			(*models.Incident)(nil),
+		} {
+			if _, err := tx.NewDelete().Model(model).Where("1 = 1").Exec(ctx); err != nil {
+				return fmt.Errorf("failed to delete %T: %v", model, err)
+			}
+		}
+
+		for _, backupUser := range backup.Users {
+			user := models.User{
+				ID:             backupUser.ID,
+				Username:       backupUser.Username,
+				Password:       backupUser.Password,
+				GitLabToken:    backupUser.GitLabToken,
+				GitLabURL:      backupUser.GitLabURL,
+				StatusPalette:  backupUser.StatusPalette,
+				StatusShapes:   backupUser.StatusShapes,
+				ExportLocale:   backupUser.ExportLocale,
+				ExportTimezone: backupUser.ExportTimezone,
+				CreatedAt:      backupUser.CreatedAt,
+				UpdatedAt:      backupUser.UpdatedAt,
+			}
+			if _, err := tx.NewInsert().Model(&user).Exec(ctx); err != nil {
+				return fmt.Errorf("failed to restore user %s: %v", backupUser.Username, err)
+			}
+			if len(backupUser.Selections) == 0 {
+				continue
+			}
+			selections := make([]models.SelectedProject, 0, len(backupUser.Selections))
+			for _, selection := range backupUser.Selections {
+				selections = append(selections, models.SelectedProject{
+					UserID:      user.ID,
+					ProjectID:   selection.ProjectID,
+					Path:        selection.Path,
+					Ref:         selection.Ref,
+					Criticality: selection.Criticality,
+					CreatedAt:   selection.CreatedAt,
+				})
+			}
+			if _, err := tx.NewInsert().Model(&selections).Exec(ctx); err != nil {
+				return fmt.Errorf("failed to restore the selected projects of %s: %v", backupUser.Username, err)
+			}
+			counts.Selections += len(selections)
+		}
+		if driver == DriverPostgres && len(backup.Users) > 0 {
+			// The users were inserted with their IDs, so the sequence must continue after them
+			if _, err := tx.ExecContext(ctx, "SELECT setval(pg_get_serial_sequence('users', 'id'), (SELECT MAX(id) FROM users))"); err != nil {
+				return fmt.Errorf("failed to reset the user ID sequence: %v", err)
+			}
+		}
+
+		if len(backup.Incidents) > 0 {
+			incidents := make([]models.Incident, 0, len(backup.Incidents))
+			for _, incident := range backup.Incidents {
+				incidents = append(incidents, models.Incident{
+					Title:         incident.Title,
+					AffectedPaths: incident.AffectedPaths,
+					StartedAt:     incident.StartedAt,
+					ResolvedAt:    incident.ResolvedAt,
+					DeclaredBy:    incident.DeclaredBy,
+					ResolvedBy:    incident.ResolvedBy,
+					CreatedAt:     incident.CreatedAt,
+				})
+			}
+			if _, err := tx.NewInsert().Model(&incidents).Exec(ctx); err != nil {
+				return fmt.Errorf("failed to restore incidents: %v", err)
+			}
+		}
+		counts.Users, counts.Incidents = len(backup.Users), len(backup.Incidents)
+		return nil
+	})
+	if err != nil {
+		return BackupCounts{}, err
+	}
+	return counts, nil
+}
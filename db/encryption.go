@@ -0,0 +1,221 @@
+package db
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/uptrace/bun"
+
+	"gitlab-status/models"
+)
+
+// encryptedPrefix marks encrypted secrets, stored as "enc:v1:<key ID>:<base64 of nonce and ciphertext>"
+const encryptedPrefix = "enc:v1:"
+
+// minEncryptionKeyLength is the shortest accepted encryption key, e.g. from openssl rand -base64 32
+const minEncryptionKeyLength = 32
+
+// ErrUnknownEncryptionKey is returned for secrets encrypted with a key that isn't configured
+var ErrUnknownEncryptionKey = errors.New("secret is encrypted with an unknown key, check ENCRYPTION_KEY and ENCRYPTION_KEY_PREVIOUS")
+
+// encryptionKey is a key secrets stored in the database are encrypted with
+type encryptionKey struct {
+	id   string // Stored with the secrets it encrypted, so they are decrypted with the right key
+	aead cipher.AEAD
+}
+
+var (
+	// currentKey encrypts secrets when they are stored, nil stores them in plaintext
+	currentKey *encryptionKey
+	// previousKeys decrypt the secrets stored before the key was rotated
+	previousKeys []*encryptionKey
+)
+
+// secretColumns lists the columns holding secrets, which are encrypted when a key is set
+var secretColumns = []struct {
+	model  interface{}
+	table  string
+	key    string
+	column string
+}{
+	{(*models.User)(nil), "users", "id", "gitlab_token"},
+}
+
+// SetEncryptionKeys sets the key secrets are encrypted with and the earlier keys that secrets
+// stored before a rotation can still be decrypted with. Without a key secrets are stored in plaintext.
+func SetEncryptionKeys(key string, previous []string) error {
+	currentKey, previousKeys = nil, nil
+	if key != "" {
+		k, err := newEncryptionKey(key)
+		if err != nil {
+			return fmt.Errorf("invalid ENCRYPTION_KEY: %v", err)
+		}
+		currentKey = k
+	}
+	for _, p := range previous {
+		k, err := newEncryptionKey(p)
+		if err != nil {
+			return fmt.Errorf("invalid ENCRYPTION_KEY_PREVIOUS: %v", err)
+		}
+		previousKeys = append(previousKeys, k)
+	}
+	return nil
+}
+
+// newEncryptionKey derives an AES-256-GCM key from a configured key
+func newEncryptionKey(key string) (*encryptionKey, error) {
+	if len(key) < minEncryptionKeyLength {
+		return nil, fmt.Errorf("it must be at least %d characters long", minEncryptionKeyLength)
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	id := sha256.Sum256(sum[:])
+	return &encryptionKey{id: hex.EncodeToString(id[:4]), aead: aead}, nil
+}
+
+// encryptSecret encrypts a secret with the current key; it stays in plaintext without one
+func encryptSecret(secret string) (string, error) {
+	if secret == "" || currentKey == nil {
+		return secret, nil
+	}
+	nonce := make([]byte, currentKey.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("error generating nonce: %v", err)
+	}
+	sealed := currentKey.aead.Seal(nonce, nonce, []byte(secret), nil)
+	return encryptedPrefix + currentKey.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret decrypts a stored secret; secrets stored in plaintext are returned as they are
+func decryptSecret(stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return stored, nil
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(stored, encryptedPrefix), ":")
+	if !ok {
+		return "", errors.New("malformed encrypted secret")
+	}
+	key := findEncryptionKey(id)
+	if key == nil {
+		return "", ErrUnknownEncryptionKey
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < key.aead.NonceSize() {
+		return "", errors.New("malformed encrypted secret")
+	}
+	nonce, ciphertext := sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():]
+	secret, err := key.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting secret: %v", err)
+	}
+	return string(secret), nil
+}
+
+// findEncryptionKey returns the configured key with an ID, nil if none has it
+func findEncryptionKey(id string) *encryptionKey {
+	for _, key := range append([]*encryptionKey{currentKey}, previousKeys...) {
+		if key != nil && key.id == id {
+			return key
+		}
+	}
+	return nil
+}
+
+// storedWithCurrentKey reports whether a stored secret is in the form the current key stores it:
+// encrypted with it, or in plaintext when there is no key
+func storedWithCurrentKey(stored string) bool {
+	if currentKey == nil {
+		return !strings.HasPrefix(stored, encryptedPrefix)
+	}
+	return strings.HasPrefix(stored, encryptedPrefix+currentKey.id+":")
+}
+
+// SecretsResult counts the stored secrets a run of EncryptSecrets or RotateSecrets changed or couldn't read
+type SecretsResult struct {
+	Updated    int // Secrets stored again with the current key
+	Unreadable int // Secrets encrypted with a key that isn't configured
+}
+
+// EncryptSecrets encrypts the secrets still stored in plaintext with the current key, e.g. the
+// ones stored before ENCRYPTION_KEY was set. Secrets encrypted with a previous key are left to
+// RotateSecrets.
+func EncryptSecrets(ctx context.Context) (SecretsResult, error) {
+	return reencryptSecrets(ctx, func(stored string) bool {
+		return currentKey != nil && !strings.HasPrefix(stored, encryptedPrefix)
+	})
+}
+
+// RotateSecrets stores every secret again with the current key, decrypting them with the current
+// or a previous key. Without a current key it decrypts them back to plaintext.
+func RotateSecrets(ctx context.Context) (SecretsResult, error) {
+	return reencryptSecrets(ctx, func(stored string) bool {
+		return !storedWithCurrentKey(stored)
+	})
+}
+
+// reencryptSecrets decrypts the stored secrets that need it and stores them again with the current
+// key, counting the ones no configured key decrypts
+func reencryptSecrets(ctx context.Context, needsUpdate func(stored string) bool) (SecretsResult, error) {
+	var result SecretsResult
+	for _, column := range secretColumns {
+		var rows []struct {
+			ID    int64  `bun:"id"`
+			Value string `bun:"value"`
+		}
+		err := DB.NewSelect().Model(column.model).
+			ColumnExpr("? AS id, ? AS value", bun.Ident(column.key), bun.Ident(column.column)).
+			Where("? IS NOT NULL AND ? <> ''", bun.Ident(column.column), bun.Ident(column.column)).
+			Scan(ctx, &rows)
+		if err != nil {
+			return result, fmt.Errorf("error loading %s.%s: %v", column.table, column.column, err)
+		}
+
+		err = DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			for _, row := range rows {
+				secret, err := decryptSecret(row.Value)
+				if errors.Is(err, ErrUnknownEncryptionKey) {
+					result.Unreadable++
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("error decrypting %s.%s of %d: %v", column.table, column.column, row.ID, err)
+				}
+				if !needsUpdate(row.Value) {
+					continue
+				}
+				stored, err := encryptSecret(secret)
+				if err != nil {
+					return err
+				}
+				_, err = tx.NewUpdate().Model(column.model).
+					Set("? = ?", bun.Ident(column.column), stored).
+					Where("? = ?", bun.Ident(column.key), row.ID).
+					Exec(ctx)
+				if err != nil {
+					return fmt.Errorf("error storing %s.%s of %d: %v", column.table, column.column, row.ID, err)
+				}
+				result.Updated++
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	testKey      = "0123456789abcdef0123456789abcdef"
+	testOtherKey = "fedcba9876543210fedcba9876543210"
+)
+
+func TestEncryptSecret(t *testing.T) {
+	t.Cleanup(func() { SetEncryptionKeys("", nil) })
+
+	for _, tt := range []struct {
+		name      string
+		key       string
+		secret    string
+		encrypted bool
+	}{
+		{"no key", "", "glpat-secret", false},
+		{"key", testKey, "glpat-secret", true},
+		{"empty secret", testKey, "", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetEncryptionKeys(tt.key, nil); err != nil {
+				t.Fatalf("setting key: %v", err)
+			}
+			stored, err := encryptSecret(tt.secret)
+			if err != nil {
+				t.Fatalf("encrypting: %v", err)
+			}
+			if encrypted := strings.HasPrefix(stored, encryptedPrefix); encrypted != tt.encrypted {
+				t.Errorf("stored %q encrypted = %v, want %v", stored, encrypted, tt.encrypted)
+			}
+			if tt.encrypted && strings.Contains(stored, tt.secret) {
+				t.Errorf("stored %q contains the secret", stored)
+			}
+			secret, err := decryptSecret(stored)
+			if err != nil || secret != tt.secret {
+				t.Errorf("decrypting %q = %q, %v, want %q", stored, secret, err, tt.secret)
+			}
+		})
+	}
+}
+
+func TestDecryptSecretAfterRotation(t *testing.T) {
+	t.Cleanup(func() { SetEncryptionKeys("", nil) })
+
+	if err := SetEncryptionKeys(testKey, nil); err != nil {
+		t.Fatalf("setting key: %v", err)
+	}
+	stored, err := encryptSecret("glpat-secret")
+	if err != nil {
+		t.Fatalf("encrypting: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		key      string
+		previous []string
+		wantErr  error
+	}{
+		{"same key", testKey, nil, nil},
+		{"previous key", testOtherKey, []string{testKey}, nil},
+		{"unknown key", testOtherKey, nil, ErrUnknownEncryptionKey},
+		{"no key", "", nil, ErrUnknownEncryptionKey},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetEncryptionKeys(tt.key, tt.previous); err != nil {
+				t.Fatalf("setting keys: %v", err)
+			}
+			secret, err := decryptSecret(stored)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("decrypting got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && secret != "glpat-secret" {
+				t.Errorf("decrypted %q, want glpat-secret", secret)
+			}
+			if tt.wantErr == nil && storedWithCurrentKey(stored) != (tt.key == testKey) {
+				t.Errorf("storedWithCurrentKey = %v with key %q", storedWithCurrentKey(stored), tt.key)
+			}
+		})
+	}
+}
+
+func TestDecryptSecretMalformed(t *testing.T) {
+	t.Cleanup(func() { SetEncryptionKeys("", nil) })
+	if err := SetEncryptionKeys(testKey, nil); err != nil {
+		t.Fatalf("setting key: %v", err)
+	}
+	stored, err := encryptSecret("glpat-secret")
+	if err != nil {
+		t.Fatalf("encrypting: %v", err)
+	}
+	id := currentKey.id
+
+	for _, tt := range []struct {
+		name   string
+		stored string
+	}{
+		{"no key ID", encryptedPrefix + "AAAA"},
+		{"not base64", encryptedPrefix + id + ":!!!"},
+		{"too short", encryptedPrefix + id + ":AAAA"},
+		{"tampered", stored[:len(stored)-4] + "AAAA"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if secret, err := decryptSecret(tt.stored); err == nil {
+				t.Errorf("decrypting %q = %q, want an error", tt.stored, secret)
+			}
+		})
+	}
+}
+
+func TestSetEncryptionKeysRejectsShortKeys(t *testing.T) {
+	t.Cleanup(func() { SetEncryptionKeys("", nil) })
+	if err := SetEncryptionKeys("short", nil); err == nil {
+		t.Error("short key accepted")
+	}
+	if err := SetEncryptionKeys(testKey, []string{"short"}); err == nil {
+		t.Error("short previous key accepted")
+	}
+}
@@ -0,0 +1,249 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+
+	"gitlab-status/models"
+)
+
+// migrations lists the schema changes in the order they are applied. Append a new entry for every
+// model change instead of editing an applied one, so existing deployments upgrade on their next start
+var migrations = []struct {
+	name    string
+	comment string
+	up      func(ctx context.Context, tx bun.Tx) error
+}{
+	// Deployments from before versioned migrations already have these tables, so both are idempotent
+	{"0001", "initial_schema", createTables},
+	{"0002", "late_columns", addLateColumns},
+	{"0003", "status_display", addStatusDisplayColumns},
+	{"0004", "lookup_indexes", addLookupIndexes},
+	{"0005", "last_known_statuses", createLastKnownStatuses},
+	{"0006", "pipeline_history", createPipelineHistory},
+	{"0007", "sessions", createSessions},
+	{"0008", "project_criticality", addCriticalityColumn},
+	{"0009", "export_locale", addExportLocaleColumns},
+}
+
+// schemaMigrations registers the migrations with bun/migrate. Each one runs in a transaction and
+// is only marked as applied when it succeeds, so a failed migration is retried on the next start
+func schemaMigrations() *migrate.Migrations {
+	registered := migrate.NewMigrations()
+	for _, migration := range migrations {
+		up := migration.up
+		registered.Add(migrate.Migration{
+			Name:    migration.name,
+			Comment: migration.comment,
+			Up: func(ctx context.Context, idb *bun.DB, _ any) error {
+				return idb.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+					return up(ctx, tx)
+				})
+			},
+		})
+	}
+	return registered
+}
+
+// newMigrator returns a migrator for the open database
+func newMigrator() *migrate.Migrator {
+	return migrate.NewMigrator(DB, schemaMigrations(), migrate.WithMarkAppliedOnSuccess(true))
+}
+
+// Migrate applies the migrations the database hasn't seen yet
+func Migrate() error {
+	ctx := context.Background()
+	migrator := newMigrator()
+	if err := migrator.Init(ctx); err != nil {
+		return fmt.Errorf("failed to create migrations table: %v", err)
+	}
+	group, err := migrator.Migrate(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
+	if !group.IsZero() {
+		log.Printf("Migrated database to %s", group)
+	}
+	return nil
+}
+
+// MigrationStatus returns all known migrations, with the applied ones carrying the time they ran
+func MigrationStatus() (migrate.MigrationSlice, error) {
+	ctx := context.Background()
+	migrator := newMigrator()
+	if err := migrator.Init(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %v", err)
+	}
+	return migrator.MigrationsWithStatus(ctx)
+}
+
+// RollbackMigrations marks the last applied group of migrations as unapplied. The migrations only
+// add to the schema, so nothing is dropped and the next Migrate applies them again
+func RollbackMigrations() (*migrate.MigrationGroup, error) {
+	ctx := context.Background()
+	migrator := newMigrator()
+	if err := migrator.Init(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %v", err)
+	}
+	return migrator.Rollback(ctx)
+}
+
+// createTables creates the database tables if they don't exist, as the models were when
+// migrations were first versioned
+func createTables(ctx context.Context, tx bun.Tx) error {
+	for _, model := range []interface{}{
+		(*user0001)(nil),
+		(*selectedProject0001)(nil),
+		(*cachedProject0001)(nil),
+		(*cachedGroup0001)(nil),
+		(*syncState0001)(nil),
+		(*deepLinkHit0001)(nil),
+		(*statusSnapshot0001)(nil),
+		(*incident0001)(nil),
+		(*pipelineCoverage0001)(nil),
+		(*pipelineTiming0001)(nil),
+		(*jobRun0001)(nil),
+		(*auditEntry0001)(nil),
+	} {
+		_, err := tx.NewCreateTable().Model(model).IfNotExists().Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create table for %T: %v", model, err)
+		}
+	}
+	return nil
+}
+
+// addLateColumns adds the columns introduced after their table was first created, before
+// migrations were versioned; databases from that time may already have them
+func addLateColumns(ctx context.Context, tx bun.Tx) error {
+	for _, column := range []struct {
+		model interface{}
+		table string
+		name  string
+		def   string
+	}{
+		{(*models.User)(nil), "users", "gitlab_token", "gitlab_token VARCHAR"},
+		{(*models.CachedProject)(nil), "cached_projects", "archived", "archived BOOLEAN NOT NULL DEFAULT FALSE"},
+		{(*models.SelectedProject)(nil), "selected_projects", "ref", "ref VARCHAR"},
+		{(*models.StatusSnapshot)(nil), "status_snapshots", "tracked_ref", "tracked_ref VARCHAR"},
+		{(*models.CachedProject)(nil), "cached_projects", "avatar_url", "avatar_url VARCHAR"},
+		{(*models.CachedGroup)(nil), "cached_groups", "avatar_url", "avatar_url VARCHAR"},
+	} {
+		if err := addColumnIfMissing(ctx, tx, column.model, column.table, column.name, column.def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addStatusDisplayColumns adds the users' choice of status colors and symbols
+func addStatusDisplayColumns(ctx context.Context, tx bun.Tx) error {
+	if err := addColumnIfMissing(ctx, tx, (*models.User)(nil), "users", "status_palette", "status_palette VARCHAR"); err != nil {
+		return err
+	}
+	return addColumnIfMissing(ctx, tx, (*models.User)(nil), "users", "status_shapes", "status_shapes BOOLEAN NOT NULL DEFAULT FALSE")
+}
+
+// addLookupIndexes indexes the columns the settings tree and the status page look up and sort
+// projects by, which otherwise scan the whole table on instances with many projects
+func addLookupIndexes(ctx context.Context, tx bun.Tx) error {
+	for _, index := range []struct {
+		model   interface{}
+		name    string
+		columns []string
+	}{
+		{(*models.CachedProject)(nil), "cached_projects_path_with_namespace_idx", []string{"path_with_namespace"}},
+		{(*models.CachedProject)(nil), "cached_projects_group_id_idx", []string{"group_id"}},
+		{(*models.SelectedProject)(nil), "selected_projects_user_id_project_id_idx", []string{"user_id", "project_id"}},
+	} {
+		_, err := tx.NewCreateIndex().Model(index.model).Index(index.name).Column(index.columns...).IfNotExists().Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create index %s: %v", index.name, err)
+		}
+	}
+	return nil
+}
+
+// createLastKnownStatuses adds the table the status page falls back to while GitLab is unreachable
+func createLastKnownStatuses(ctx context.Context, tx bun.Tx) error {
+	_, err := tx.NewCreateTable().Model((*lastKnownStatus0005)(nil)).IfNotExists().Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create table for last known statuses: %v", err)
+	}
+	return nil
+}
+
+// createPipelineHistory adds the table of every pipeline seen while polling, indexed for the
+// pipelines of a project over time
+func createPipelineHistory(ctx context.Context, tx bun.Tx) error {
+	_, err := tx.NewCreateTable().Model((*pipelineRecord0006)(nil)).IfNotExists().Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create table for pipeline history: %v", err)
+	}
+	_, err = tx.NewCreateIndex().Model((*pipelineRecord0006)(nil)).Index("pipeline_history_project_id_created_at_idx").
+		Column("project_id", "created_at").IfNotExists().Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create index pipeline_history_project_id_created_at_idx: %v", err)
+	}
+	return nil
+}
+
+// createSessions adds the table of the sessions kept in the database, indexed for removing expired ones
+func createSessions(ctx context.Context, tx bun.Tx) error {
+	_, err := tx.NewCreateTable().Model((*session0007)(nil)).IfNotExists().Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create table for sessions: %v", err)
+	}
+	_, err = tx.NewCreateIndex().Model((*session0007)(nil)).Index("sessions_expires_at_idx").
+		Column("expires_at").IfNotExists().Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create index sessions_expires_at_idx: %v", err)
+	}
+	return nil
+}
+
+// addCriticalityColumn adds the criticality users give their selected projects
+func addCriticalityColumn(ctx context.Context, tx bun.Tx) error {
+	return addColumnIfMissing(ctx, tx, (*models.SelectedProject)(nil), "selected_projects", "criticality", "criticality VARCHAR")
+}
+
+// addExportLocaleColumns adds the locale and time zone users want exports written in
+func addExportLocaleColumns(ctx context.Context, tx bun.Tx) error {
+	if err := addColumnIfMissing(ctx, tx, (*models.User)(nil), "users", "export_locale", "export_locale VARCHAR"); err != nil {
+		return err
+	}
+	return addColumnIfMissing(ctx, tx, (*models.User)(nil), "users", "export_timezone", "export_timezone VARCHAR")
+}
+
+// addColumnIfMissing adds a column to the table of a model unless it's already there
+func addColumnIfMissing(ctx context.Context, tx bun.Tx, model interface{}, table, name, def string) error {
+	count, err := countColumns(ctx, tx, table, name)
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %v", table, err)
+	}
+	if count > 0 {
+		return nil
+	}
+	if _, err := tx.NewAddColumn().Model(model).ColumnExpr(def).Exec(ctx); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %v", table, name, err)
+	}
+	log.Printf("Added column %s.%s", table, name)
+	return nil
+}
+
+// countColumns returns 1 when a table has a column and 0 otherwise, using the schema tables of the driver
+func countColumns(ctx context.Context, tx bun.Tx, table, column string) (int, error) {
+	if driver == DriverPostgres {
+		return tx.NewSelect().TableExpr("information_schema.columns").
+			Where("table_schema = current_schema()").
+			Where("table_name = ?", table).
+			Where("column_name = ?", column).
+			Count(ctx)
+	}
+	return tx.NewSelect().TableExpr("pragma_table_info(?)", table).
+		Where("name = ?", column).Count(ctx)
+}
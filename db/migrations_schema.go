@@ -0,0 +1,202 @@
+package db
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// The tables created by migrations are copies of the models as they were when the migration was
+// added, so an applied migration keeps creating the same schema however the models change later.
+// Change a model's table by appending a migration, never by editing these.
+
+// Tables of migration 0001. Columns added by migrations 0002, 0003, 0008 and 0009 are left out.
+
+type user0001 struct {
+	bun.BaseModel `bun:"table:users"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	Username  string    `bun:"username,unique,notnull"`
+	Password  string    `bun:"password,notnull"`
+	GitLabURL string    `bun:"gitlab_url"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp"`
+	UpdatedAt time.Time `bun:"updated_at,notnull,default:current_timestamp"`
+}
+
+type selectedProject0001 struct {
+	bun.BaseModel `bun:"table:selected_projects"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	UserID    int64     `bun:"user_id,notnull"`
+	ProjectID int       `bun:"project_id,notnull"`
+	Path      string    `bun:"path,notnull"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp"`
+}
+
+type cachedProject0001 struct {
+	bun.BaseModel `bun:"table:cached_projects"`
+
+	ID                int       `bun:"id,pk"`
+	UserID            int64     `bun:"user_id,notnull"`
+	Name              string    `bun:"name,notnull"`
+	NameWithNamespace string    `bun:"name_with_namespace,notnull"`
+	Path              string    `bun:"path,notnull"`
+	PathWithNamespace string    `bun:"path_with_namespace,notnull"`
+	WebURL            string    `bun:"web_url,notnull"`
+	GroupID           int       `bun:"group_id"`
+	CreatedAt         time.Time `bun:"created_at,notnull,default:current_timestamp"`
+	UpdatedAt         time.Time `bun:"updated_at,notnull,default:current_timestamp"`
+}
+
+type cachedGroup0001 struct {
+	bun.BaseModel `bun:"table:cached_groups"`
+
+	ID        int       `bun:"id,pk"`
+	UserID    int64     `bun:"user_id,notnull"`
+	Name      string    `bun:"name,notnull"`
+	Path      string    `bun:"path,notnull"`
+	FullPath  string    `bun:"full_path,notnull"`
+	ParentID  int       `bun:"parent_id"`
+	WebURL    string    `bun:"web_url,notnull"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp"`
+	UpdatedAt time.Time `bun:"updated_at,notnull,default:current_timestamp"`
+}
+
+type syncState0001 struct {
+	bun.BaseModel `bun:"table:sync_state"`
+
+	ID           int       `bun:"id,pk"`
+	LastSync     time.Time `bun:"last_sync"`
+	LastFullSync time.Time `bun:"last_full_sync"`
+}
+
+type deepLinkHit0001 struct {
+	bun.BaseModel `bun:"table:deep_link_hits"`
+
+	ProjectID  int       `bun:"project_id,pk"`
+	Target     string    `bun:"target,pk"`
+	Hits       int       `bun:"hits,notnull"`
+	LastUsedAt time.Time `bun:"last_used_at,notnull"`
+}
+
+type statusSnapshot0001 struct {
+	bun.BaseModel `bun:"table:status_snapshots"`
+
+	ID              int64     `bun:"id,pk,autoincrement"`
+	TakenAt         time.Time `bun:"taken_at,notnull"`
+	ProjectID       int       `bun:"project_id,notnull"`
+	ProjectName     string    `bun:"project_name"`
+	ProjectPath     string    `bun:"project_path"`
+	Ref             string    `bun:"ref"`
+	PipelineID      int       `bun:"pipeline_id"`
+	Status          string    `bun:"status"`
+	PipelineDate    time.Time `bun:"pipeline_date"`
+	WebURL          string    `bun:"web_url"`
+	ProjectURL      string    `bun:"project_url"`
+	LastSuccessID   int       `bun:"last_success_id"`
+	LastSuccessDate time.Time `bun:"last_success_date"`
+	Stale           bool      `bun:"stale"`
+	Error           string    `bun:"error"`
+}
+
+type incident0001 struct {
+	bun.BaseModel `bun:"table:incidents"`
+
+	ID            int64     `bun:"id,pk,autoincrement"`
+	Title         string    `bun:"title,notnull"`
+	AffectedPaths string    `bun:"affected_paths"`
+	StartedAt     time.Time `bun:"started_at,notnull"`
+	ResolvedAt    time.Time `bun:"resolved_at,nullzero"`
+	DeclaredBy    string    `bun:"declared_by"`
+	ResolvedBy    string    `bun:"resolved_by"`
+	CreatedAt     time.Time `bun:"created_at,notnull,default:current_timestamp"`
+}
+
+type pipelineCoverage0001 struct {
+	bun.BaseModel `bun:"table:pipeline_coverages"`
+
+	PipelineID int       `bun:"pipeline_id,pk"`
+	ProjectID  int       `bun:"project_id,notnull"`
+	Coverage   *float64  `bun:"coverage"`
+	CreatedAt  time.Time `bun:"created_at,notnull,default:current_timestamp"`
+}
+
+type pipelineTiming0001 struct {
+	bun.BaseModel `bun:"table:pipeline_timings"`
+
+	PipelineID     int       `bun:"pipeline_id,pk"`
+	ProjectID      int       `bun:"project_id,notnull"`
+	Ref            string    `bun:"ref"`
+	Status         string    `bun:"status"`
+	WebURL         string    `bun:"web_url"`
+	Duration       float64   `bun:"duration,notnull"`
+	QueuedDuration float64   `bun:"queued_duration,notnull"`
+	PipelineDate   time.Time `bun:"pipeline_date,notnull"`
+	CreatedAt      time.Time `bun:"created_at,notnull,default:current_timestamp"`
+}
+
+type jobRun0001 struct {
+	bun.BaseModel `bun:"table:job_runs"`
+
+	ID         int64     `bun:"id,pk,autoincrement"`
+	Job        string    `bun:"job,notnull"`
+	StartedAt  time.Time `bun:"started_at,notnull"`
+	DurationMs int64     `bun:"duration_ms,notnull"`
+	Items      int       `bun:"items,notnull"`
+	Error      string    `bun:"error"`
+}
+
+type auditEntry0001 struct {
+	bun.BaseModel `bun:"table:audit_log"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	Action    string    `bun:"action,notnull"`
+	Actor     string    `bun:"actor,notnull"`
+	ProjectID int       `bun:"project_id,notnull"`
+	Target    string    `bun:"target"`
+	Error     string    `bun:"error"`
+	ClientIP  string    `bun:"client_ip"`
+	UserAgent string    `bun:"user_agent"`
+	CreatedAt time.Time `bun:"created_at,notnull"`
+}
+
+// Table of migration 0005. The status is stored as its JSON text.
+
+type lastKnownStatus0005 struct {
+	bun.BaseModel `bun:"table:last_known_statuses"`
+
+	ProjectID  int       `bun:"project_id,pk"`
+	TrackedRef string    `bun:"tracked_ref,pk"`
+	Status     string    `bun:"status,type:text"`
+	FetchedAt  time.Time `bun:"fetched_at,notnull"`
+}
+
+// Table of migration 0006
+
+type pipelineRecord0006 struct {
+	bun.BaseModel `bun:"table:pipeline_history"`
+
+	PipelineID     int       `bun:"pipeline_id,pk"`
+	ProjectID      int       `bun:"project_id,notnull"`
+	Ref            string    `bun:"ref"`
+	Status         string    `bun:"status"`
+	Source         string    `bun:"source"`
+	WebURL         string    `bun:"web_url"`
+	Duration       *float64  `bun:"duration"`
+	QueuedDuration *float64  `bun:"queued_duration"`
+	CreatedAt      time.Time `bun:"created_at,notnull"`
+	UpdatedAt      time.Time `bun:"updated_at"`
+	FinishedAt     time.Time `bun:"finished_at,nullzero"`
+	FirstSeenAt    time.Time `bun:"first_seen_at,notnull"`
+}
+
+// Table of migration 0007
+
+type session0007 struct {
+	bun.BaseModel `bun:"table:sessions"`
+
+	ID        string    `bun:"id,pk"`
+	Data      []byte    `bun:"data"`
+	ExpiresAt time.Time `bun:"expires_at,notnull"`
+	UpdatedAt time.Time `bun:"updated_at,notnull"`
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"gitlab-status/models"
+)
+
+// TestMigrationsMatchModels checks that a database migrated from scratch has a column for every
+// field of the models, so a model change without a migration is caught
+func TestMigrationsMatchModels(t *testing.T) {
+	initTestDB(t)
+
+	for _, model := range []interface{}{
+		(*models.User)(nil),
+		(*models.SelectedProject)(nil),
+		(*models.CachedProject)(nil),
+		(*models.CachedGroup)(nil),
+		(*models.SyncState)(nil),
+		(*models.DeepLinkHit)(nil),
+		(*models.StatusSnapshot)(nil),
+		(*models.Incident)(nil),
+		(*models.PipelineCoverage)(nil),
+		(*models.PipelineTiming)(nil),
+		(*models.JobRun)(nil),
+		(*models.AuditEntry)(nil),
+		(*models.LastKnownStatus)(nil),
+		(*models.PipelineRecord)(nil),
+		(*models.Session)(nil),
+	} {
+		table := DB.Table(reflect.TypeOf(model).Elem())
+		var columns []string
+		if err := DB.NewSelect().TableExpr("pragma_table_info(?)", table.Name).Column("name").Scan(t.Context(), &columns); err != nil {
+			t.Fatalf("inspecting table %s: %v", table.Name, err)
+		}
+		have := make(map[string]bool, len(columns))
+		for _, column := range columns {
+			have[column] = true
+		}
+		for _, field := range table.Fields {
+			if !have[field.Name] {
+				t.Errorf("table %s has no column %s for %T", table.Name, field.Name, model)
+			}
+		}
+	}
+}
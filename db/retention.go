@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"gitlab-status/models"
+)
+
+// pruneBatchSize is how many rows one delete statement removes, so pruning a large backlog
+// doesn't hold SQLite's write lock for long
+const pruneBatchSize = 5000
+
+// RetentionPolicy is how long recorded data is kept; zero keeps it forever
+type RetentionPolicy struct {
+	History time.Duration // Pipeline history, timings and coverage, by the pipeline's creation
+	Audit   time.Duration // Audit log entries
+}
+
+// PruneResult is what a pruning run deleted
+type PruneResult struct {
+	Rows map[string]int64 // Deleted rows per table
+	// ReclaimedBytes is the space the deleted rows freed in the SQLite file, which new rows reuse.
+	// It is 0 on Postgres, where autovacuum reclaims the space later.
+	ReclaimedBytes int64
+}
+
+// TotalRows returns how many rows were deleted from all tables
+func (r PruneResult) TotalRows() int64 {
+	var total int64
+	for _, rows := range r.Rows {
+		total += rows
+	}
+	return total
+}
+
+// String summarizes the deleted rows per table and the reclaimed space
+func (r PruneResult) String() string {
+	tables := make([]string, 0, len(r.Rows))
+	for table := range r.Rows {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	counts := make([]string, 0, len(tables))
+	for _, table := range tables {
+		counts = append(counts, fmt.Sprintf("%s: %d", table, r.Rows[table]))
+	}
+	summary := fmt.Sprintf("Pruned %d rows (%s)", r.TotalRows(), strings.Join(counts, ", "))
+	if driver == DriverSQLite {
+		summary += fmt.Sprintf(", reclaimed %.1f MB", float64(r.ReclaimedBytes)/(1<<20))
+	}
+	return summary
+}
+
+// PruneOldData deletes the recorded data older than the policy allows and the expired sessions.
+// Status snapshots and job runs are pruned when they are recorded, with their own retention.
+func PruneOldData(ctx context.Context, policy RetentionPolicy) (PruneResult, error) {
+	result := PruneResult{Rows: make(map[string]int64)}
+	freeBefore, err := freeBytes(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	now := time.Now()
+	for _, table := range []struct {
+		model     interface{}
+		name      string
+		key       string
+		column    string
+		retention time.Duration
+	}{
+		{(*models.PipelineRecord)(nil), "pipeline_history", "pipeline_id", "created_at", policy.History},
+		{(*models.PipelineTiming)(nil), "pipeline_timings", "pipeline_id", "pipeline_date", policy.History},
+		{(*models.PipelineCoverage)(nil), "pipeline_coverages", "pipeline_id", "created_at", policy.History},
+		{(*models.AuditEntry)(nil), "audit_entries", "id", "created_at", policy.Audit},
+	} {
+		if table.retention <= 0 {
+			continue
+		}
+		deleted, err := deleteInBatches(ctx, table.model, table.key, table.column, now.Add(-table.retention))
+		result.Rows[table.name] = deleted
+		if err != nil {
+			return result, fmt.Errorf("error pruning %s: %v", table.name, err)
+		}
+	}
+
+	expired, err := deleteExpiredSessions(ctx)
+	result.Rows["sessions"] = expired
+	if err != nil {
+		return result, fmt.Errorf("error deleting expired sessions: %v", err)
+	}
+
+	freeAfter, err := freeBytes(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.ReclaimedBytes = max(freeAfter-freeBefore, 0)
+	log.Println(result)
+	return result, nil
+}
+
+// deleteInBatches deletes the rows of a model whose column is before a time, pruneBatchSize at a
+// time, and returns how many it deleted
+func deleteInBatches(ctx context.Context, model interface{}, key, column string, before time.Time) (int64, error) {
+	var deleted int64
+	for {
+		batch := DB.NewSelect().Model(model).Column(key).Where("? < ?", bun.Ident(column), before).Limit(pruneBatchSize)
+		res, err := DB.NewDelete().Model(model).Where("? IN (?)", bun.Ident(key), batch).Exec(ctx)
+		if err != nil {
+			return deleted, err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += rows
+		if rows < pruneBatchSize {
+			return deleted, nil
+		}
+	}
+}
+
+// freeBytes returns the unused space in the SQLite file, 0 on Postgres
+func freeBytes(ctx context.Context) (int64, error) {
+	if driver != DriverSQLite {
+		return 0, nil
+	}
+	var pages, pageSize int64
+	if err := DB.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&pages); err != nil {
+		return 0, fmt.Errorf("error reading free pages: %v", err)
+	}
+	if err := DB.QueryRowContext(ctx, "PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, fmt.Errorf("error reading page size: %v", err)
+	}
+	return pages * pageSize, nil
+}
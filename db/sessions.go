@@ -0,0 +1,135 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+
+	"gitlab-status/models"
+)
+
+// browserSessionLifetime is how long sessions with a MaxAge of 0, whose cookie lasts until the
+// browser closes, are kept
+const browserSessionLifetime = 24 * time.Hour
+
+// SessionStore keeps sessions in the database, so they survive a rotated SESSION_SECRET and
+// aren't limited by the size of a cookie. The cookie holds a random ID; the database only stores
+// its hash, so its contents can't be used to take over sessions. Types stored in the values
+// must be registered with gob, like for cookies.
+type SessionStore struct {
+	Options *sessions.Options // Default options of new sessions; MaxAge is also their lifetime
+}
+
+// NewSessionStore returns a database session store with the given default options
+func NewSessionStore(options *sessions.Options) *SessionStore {
+	return &SessionStore{Options: options}
+}
+
+// Get returns the named session of the request, loading it once per request
+func (s *SessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session named in the request's cookie, or returns a new one when there is none
+// or it expired
+func (s *SessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.Options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return session, nil
+	}
+	var stored models.Session
+	err = DB.NewSelect().Model(&stored).
+		Where("id = ?", sessionKey(cookie.Value)).
+		Where("expires_at > ?", time.Now()).
+		Scan(r.Context())
+	if err == sql.ErrNoRows {
+		return session, nil
+	}
+	if err != nil {
+		return session, fmt.Errorf("error loading session: %v", err)
+	}
+	if err := gob.NewDecoder(bytes.NewReader(stored.Data)).Decode(&session.Values); err != nil {
+		return session, fmt.Errorf("error decoding session: %v", err)
+	}
+	session.ID = cookie.Value
+	session.IsNew = false
+	return session, nil
+}
+
+// Save stores the session and sets its cookie. A negative MaxAge deletes the session.
+func (s *SessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	ctx := r.Context()
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if _, err := DB.NewDelete().Model((*models.Session)(nil)).Where("id = ?", sessionKey(session.ID)).Exec(ctx); err != nil {
+				return fmt.Errorf("error deleting session: %v", err)
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		id := make([]byte, 32)
+		if _, err := rand.Read(id); err != nil {
+			return fmt.Errorf("error generating session ID: %v", err)
+		}
+		session.ID = base64.RawURLEncoding.EncodeToString(id)
+	}
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(session.Values); err != nil {
+		return fmt.Errorf("error encoding session: %v", err)
+	}
+	lifetime := time.Duration(session.Options.MaxAge) * time.Second
+	if lifetime == 0 {
+		lifetime = browserSessionLifetime
+	}
+	now := time.Now()
+	stored := models.Session{
+		ID:        sessionKey(session.ID),
+		Data:      data.Bytes(),
+		ExpiresAt: now.Add(lifetime),
+		UpdatedAt: now,
+	}
+	_, err := DB.NewInsert().Model(&stored).
+		On("CONFLICT (id) DO UPDATE").
+		Set("data = EXCLUDED.data").
+		Set("expires_at = EXCLUDED.expires_at").
+		Set("updated_at = EXCLUDED.updated_at").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error saving session: %v", err)
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), session.ID, session.Options))
+	return nil
+}
+
+// sessionKey returns the stored key of a session ID
+func sessionKey(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// deleteExpiredSessions deletes the sessions that expired and returns how many
+func deleteExpiredSessions(ctx context.Context) (int64, error) {
+	res, err := DB.NewDelete().Model((*models.Session)(nil)).Where("expires_at < ?", time.Now()).Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
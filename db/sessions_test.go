@@ -0,0 +1,131 @@
+package db
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+
+	"gitlab-status/models"
+)
+
+// initTestDB migrates a new SQLite database for a test
+func initTestDB(t *testing.T) {
+	t.Helper()
+	if err := Initialize(Options{DSN: filepath.Join(t.TempDir(), "gitlab-status.db")}); err != nil {
+		t.Fatalf("initializing database: %v", err)
+	}
+	t.Cleanup(func() { DB.Close() })
+}
+
+// saveTestSession saves a session with values and returns its cookie
+func saveTestSession(t *testing.T, store *SessionStore, session *sessions.Session) *http.Cookie {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	if err := store.Save(httptest.NewRequest(http.MethodGet, "/", nil), rec, session); err != nil {
+		t.Fatalf("saving session: %v", err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("saving session set %d cookies, want 1", len(cookies))
+	}
+	return cookies[0]
+}
+
+// loadTestSession loads the session of a cookie in a new request
+func loadTestSession(t *testing.T, store *SessionStore, cookie *http.Cookie) *sessions.Session {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	session, err := store.New(req, "test-session")
+	if err != nil {
+		t.Fatalf("loading session: %v", err)
+	}
+	return session
+}
+
+func TestSessionStore(t *testing.T) {
+	initTestDB(t)
+	store := NewSessionStore(&sessions.Options{Path: "/", MaxAge: 3600, HttpOnly: true})
+
+	session := loadTestSession(t, store, nil)
+	if !session.IsNew {
+		t.Fatal("session without a cookie isn't new")
+	}
+	session.Values["user_id"] = int64(7)
+	cookie := saveTestSession(t, store, session)
+
+	var stored models.Session
+	if err := DB.NewSelect().Model(&stored).Scan(t.Context()); err != nil {
+		t.Fatalf("reading stored session: %v", err)
+	}
+	if stored.ID == cookie.Value || stored.ID != sessionKey(cookie.Value) {
+		t.Errorf("stored session key %q, want the hash of the cookie", stored.ID)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		cookie  *http.Cookie
+		prepare func(t *testing.T)
+		wantNew bool
+	}{
+		{"saved", cookie, nil, false},
+		{"unknown ID", &http.Cookie{Name: "test-session", Value: "forged"}, nil, true},
+		{"empty cookie", &http.Cookie{Name: "test-session", Value: ""}, nil, true},
+		{"expired", cookie, func(t *testing.T) {
+			_, err := DB.NewUpdate().Model((*models.Session)(nil)).
+				Set("expires_at = ?", time.Now().Add(-time.Minute)).
+				Where("id = ?", sessionKey(cookie.Value)).
+				Exec(t.Context())
+			if err != nil {
+				t.Fatalf("expiring session: %v", err)
+			}
+		}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prepare != nil {
+				tt.prepare(t)
+			}
+			loaded := loadTestSession(t, store, tt.cookie)
+			if loaded.IsNew != tt.wantNew {
+				t.Fatalf("loaded session IsNew = %v, want %v", loaded.IsNew, tt.wantNew)
+			}
+			if !tt.wantNew && loaded.Values["user_id"] != int64(7) {
+				t.Errorf("loaded user_id %v, want 7", loaded.Values["user_id"])
+			}
+		})
+	}
+
+	deleted, err := deleteExpiredSessions(t.Context())
+	if err != nil || deleted != 1 {
+		t.Errorf("deleteExpiredSessions = %d, %v, want 1 deleted", deleted, err)
+	}
+}
+
+func TestSessionStoreDelete(t *testing.T) {
+	initTestDB(t)
+	store := NewSessionStore(&sessions.Options{Path: "/", MaxAge: 3600})
+
+	session := loadTestSession(t, store, nil)
+	session.Values["user_id"] = int64(7)
+	cookie := saveTestSession(t, store, session)
+
+	loaded := loadTestSession(t, store, cookie)
+	loaded.Options.MaxAge = -1
+	if cleared := saveTestSession(t, store, loaded); cleared.Value != "" || cleared.MaxAge >= 0 {
+		t.Errorf("logout cookie is %q with MaxAge %d, want an empty expired cookie", cleared.Value, cleared.MaxAge)
+	}
+
+	count, err := DB.NewSelect().Model((*models.Session)(nil)).Count(t.Context())
+	if err != nil || count != 0 {
+		t.Errorf("%d sessions left after deleting, %v", count, err)
+	}
+	if !loadTestSession(t, store, cookie).IsNew {
+		t.Error("deleted session still loads")
+	}
+}
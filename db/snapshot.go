@@ -0,0 +1,94 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gitlab-status/models"
+)
+
+// ExportCacheSnapshot writes the cached groups and projects as a snapshot of the structure of
+// the GitLab instance at gitlabURL, and returns how many groups and projects it wrote
+func ExportCacheSnapshot(w io.Writer, gitlabURL string) (int, int, error) {
+	cachedGroups, err := GetCachedGroups()
+	if err != nil {
+		return 0, 0, err
+	}
+	cachedProjects, err := GetCachedProjects()
+	if err != nil {
+		return 0, 0, err
+	}
+	state, err := GetSyncState()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	snapshot := models.CacheSnapshot{
+		Version:    models.CacheSnapshotVersion,
+		GitLabURL:  gitlabURL,
+		ExportedAt: time.Now().UTC(),
+		SyncedAt:   state.LastFullSync,
+		Groups:     make([]models.Group, 0, len(cachedGroups)),
+		Projects:   make([]models.Project, 0, len(cachedProjects)),
+	}
+	for _, cached := range cachedGroups {
+		snapshot.Groups = append(snapshot.Groups, models.Group{
+			ID:        cached.ID,
+			Name:      cached.Name,
+			Path:      cached.Path,
+			FullPath:  cached.FullPath,
+			WebURL:    cached.WebURL,
+			AvatarURL: cached.AvatarURL,
+			ParentID:  cached.ParentID,
+		})
+	}
+	for _, cached := range cachedProjects {
+		project := models.Project{
+			ID:                cached.ID,
+			Name:              cached.Name,
+			NameWithNamespace: cached.NameWithNamespace,
+			Path:              cached.Path,
+			PathWithNamespace: cached.PathWithNamespace,
+			WebURL:            cached.WebURL,
+			AvatarURL:         cached.AvatarURL,
+			Archived:          cached.Archived,
+		}
+		project.Namespace.ID = cached.GroupID
+		snapshot.Projects = append(snapshot.Projects, project)
+	}
+
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		return 0, 0, fmt.Errorf("error writing cache snapshot: %v", err)
+	}
+	return len(snapshot.Groups), len(snapshot.Projects), nil
+}
+
+// ImportCacheSnapshot replaces the cache with the groups and projects of a snapshot, as a full
+// sync at the time the snapshot was synced would. The snapshot must be of the GitLab instance at
+// gitlabURL, as the IDs of another instance would mix up projects. It returns how many groups
+// and projects it imported.
+func ImportCacheSnapshot(r io.Reader, gitlabURL string) (int, int, error) {
+	var snapshot models.CacheSnapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return 0, 0, fmt.Errorf("error reading cache snapshot: %v", err)
+	}
+	if snapshot.Version != models.CacheSnapshotVersion {
+		return 0, 0, fmt.Errorf("unsupported cache snapshot version %d, expected %d", snapshot.Version, models.CacheSnapshotVersion)
+	}
+	if !sameGitLabURL(snapshot.GitLabURL, gitlabURL) {
+		return 0, 0, fmt.Errorf("cache snapshot is of %s, not %s", snapshot.GitLabURL, gitlabURL)
+	}
+
+	if err := CacheGitLabStructure(snapshot.Groups, snapshot.Projects, snapshot.SyncedAt); err != nil {
+		return 0, 0, err
+	}
+	return len(snapshot.Groups), len(snapshot.Projects), nil
+}
+
+// sameGitLabURL reports whether two URLs name the same GitLab instance
+func sameGitLabURL(a, b string) bool {
+	return strings.EqualFold(strings.TrimRight(a, "/"), strings.TrimRight(b, "/"))
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	sqldriver "database/sql/driver"
+	"fmt"
+	"strings"
+
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+// sqlitePragmas are run on every new SQLite connection, as busy_timeout and foreign_keys only
+// apply to the connection that sets them
+var sqlitePragmas = []string{
+	// A full structure sync holds the write lock for a while, so writers wait rather than fail.
+	// Set first, as switching the journal mode of a database another connection uses needs a lock.
+	"busy_timeout = 30000",
+	"journal_mode = WAL",
+	"foreign_keys = ON",
+}
+
+// sqliteDSN makes transactions take the write lock when they begin. A deferred transaction that
+// reads before writing can't wait for another writer in WAL mode and fails with "database is locked"
+func sqliteDSN(dsn string) string {
+	if strings.Contains(dsn, "_txlock=") {
+		return dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&_txlock=immediate"
+	}
+	return dsn + "?_txlock=immediate"
+}
+
+// sqliteConnector opens connections through the SQLite driver sqliteshim picked for the platform
+// and applies sqlitePragmas to each of them
+type sqliteConnector struct {
+	dsn string
+}
+
+func (c sqliteConnector) Connect(ctx context.Context) (sqldriver.Conn, error) {
+	conn, err := sqliteshim.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	execer, ok := conn.(sqldriver.ExecerContext)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("SQLite driver %s can't execute pragmas", sqliteshim.DriverName())
+	}
+	for _, pragma := range sqlitePragmas {
+		if _, err := execer.ExecContext(ctx, "PRAGMA "+pragma, nil); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to set PRAGMA %s: %v", pragma, err)
+		}
+	}
+	return conn, nil
+}
+
+func (c sqliteConnector) Driver() sqldriver.Driver {
+	return sqliteshim.Driver()
+}
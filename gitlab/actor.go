@@ -0,0 +1,34 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// userAgent identifies this application in GitLab's logs, see ConfigureUserAgent
+var userAgent = "gitlab-status"
+
+// ConfigureUserAgent names the version and the instance of the application in the User-Agent of all
+// GitLab API calls, so GitLab admins can attribute the API load to a deployment
+func ConfigureUserAgent(version, instanceID string) {
+	userAgent = fmt.Sprintf("gitlab-status/%s (instance %s)", version, instanceID)
+	log.Printf("Using GitLab API User-Agent: %s", userAgent)
+}
+
+// actorKey is the context key holding the user a GitLab API call is made for
+type actorKey struct{}
+
+// WithActor returns a context whose GitLab API calls name actor in their User-Agent, so actions
+// taken on behalf of a user can be traced in GitLab's logs
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// userAgentFrom returns the User-Agent for the API calls of a context
+func userAgentFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return userAgent + " on behalf of " + actor
+	}
+	return userAgent
+}
@@ -0,0 +1,250 @@
+package gitlab
+
+import (
+	"context"
+	"time"
+
+	"gitlab-status/models"
+)
+
+// Client is the GitLab API used by the handlers and the background sync.
+// Calls are canceled together with ctx.
+type Client interface {
+	// URL returns the base URL of the GitLab instance
+	URL() string
+	FetchGroups(ctx context.Context) ([]models.Group, error)
+	FetchProjects(ctx context.Context) ([]models.Project, error)
+	FetchProjectsChangedSince(ctx context.Context, since time.Time) ([]models.Project, error)
+	FetchMemberProjects(ctx context.Context) ([]models.Project, error)
+	// The pipeline calls are limited to ref, or cover all branches and tags when it is empty
+	FetchLatestPipeline(ctx context.Context, projectID, ref string) (*models.Pipeline, error)
+	FetchPipelines(ctx context.Context, projectID, ref string, count int) ([]models.Pipeline, error)
+	FetchLastSuccessPipeline(ctx context.Context, projectID, ref string) (*models.Pipeline, error)
+	FetchPipeline(ctx context.Context, projectID string, pipelineID int) (*models.Pipeline, error)
+	FetchMergeRequestPipelines(ctx context.Context, projectID string, mergeRequestIID int) ([]models.Pipeline, error)
+	FetchFinishedPipelines(ctx context.Context, projectID string, since time.Time, page int) ([]models.Pipeline, error)
+	CreatePipeline(ctx context.Context, projectID, ref string, variables []models.PipelineVariable) (*models.Pipeline, error)
+	FetchPipelineSchedules(ctx context.Context, projectID string) ([]models.PipelineSchedule, error)
+	FetchPipelineSchedule(ctx context.Context, projectID string, scheduleID int) (*models.PipelineSchedule, error)
+	CreatePipelineSchedule(ctx context.Context, projectID string, schedule models.PipelineSchedule) (*models.PipelineSchedule, error)
+	SetPipelineScheduleActive(ctx context.Context, projectID string, scheduleID int, active bool) (*models.PipelineSchedule, error)
+	FetchPipelineJobs(ctx context.Context, projectID string, pipelineID int) ([]models.Job, error)
+	FetchPipelineBridges(ctx context.Context, projectID string, pipelineID int) ([]models.Bridge, error)
+	FetchJobTrace(ctx context.Context, projectID string, jobID int, lines int) (string, error)
+	RetryJob(ctx context.Context, projectID string, jobID int) (*models.Job, error)
+	FetchTestReportSummary(ctx context.Context, projectID string, pipelineID int) (*models.TestReportSummary, error)
+	GetProject(ctx context.Context, projectPath string) (*models.Project, error)
+	FetchEnvironments(ctx context.Context, projectID string) ([]models.Environment, error)
+	FetchDeployments(ctx context.Context, projectID, environment, status string, count int) ([]models.Deployment, error)
+	FetchClusterAgents(ctx context.Context, projectID string) ([]models.ClusterAgent, error)
+	FetchRunners(ctx context.Context, projectID string) ([]models.Runner, error)
+	FetchAvatar(ctx context.Context, avatarURL string) ([]byte, error)
+	FetchLatestTag(ctx context.Context, projectID string) (*models.Tag, error)
+	CountCommitsBetween(ctx context.Context, projectID, from, to string) (int, error)
+	FetchOpenMergeRequests(ctx context.Context, projectID, targetBranch, labels string) ([]models.MergeRequest, error)
+	FetchLatestRelease(ctx context.Context, projectID string) (*models.Release, error)
+	FetchReleasesSince(ctx context.Context, projectID string, since time.Time) ([]models.Release, error)
+	FetchInstanceInfo(ctx context.Context) (*models.InstanceInfo, error)
+	ValidateToken(ctx context.Context) (*models.TokenValidation, error)
+	FetchRefProtection(ctx context.Context, projectID, ref string) (*models.RefProtection, error)
+	FetchCurrentIterations(ctx context.Context, groupID string) ([]models.Iteration, error)
+	FetchIterationIssues(ctx context.Context, projectID string, iterationID int) ([]models.Issue, error)
+}
+
+// HTTPClient implements Client with requests to the GitLab REST API
+type HTTPClient struct {
+	baseURL string
+	token   string
+}
+
+var _ Client = (*HTTPClient)(nil)
+
+// NewHTTPClient creates a Client for the GitLab instance at gitlabURL authenticated with token
+func NewHTTPClient(gitlabURL, token string) *HTTPClient {
+	return &HTTPClient{baseURL: gitlabURL, token: token}
+}
+
+// URL returns the base URL of the GitLab instance
+func (c *HTTPClient) URL() string {
+	return c.baseURL
+}
+
+// FetchGroups gets all GitLab groups accessible with the token
+func (c *HTTPClient) FetchGroups(ctx context.Context) ([]models.Group, error) {
+	return FetchGroups(ctx, c.baseURL, c.token)
+}
+
+// FetchProjects gets all GitLab projects accessible with the token
+func (c *HTTPClient) FetchProjects(ctx context.Context) ([]models.Project, error) {
+	return FetchProjects(ctx, c.baseURL, c.token)
+}
+
+// FetchProjectsChangedSince gets the projects with activity after the given time
+func (c *HTTPClient) FetchProjectsChangedSince(ctx context.Context, since time.Time) ([]models.Project, error) {
+	return FetchProjectsChangedSince(ctx, c.baseURL, c.token, since)
+}
+
+// FetchMemberProjects gets all projects the token's user is a member of
+func (c *HTTPClient) FetchMemberProjects(ctx context.Context) ([]models.Project, error) {
+	return FetchMemberProjects(ctx, c.baseURL, c.token)
+}
+
+// FetchLatestPipeline gets the latest pipeline of a project
+func (c *HTTPClient) FetchLatestPipeline(ctx context.Context, projectID, ref string) (*models.Pipeline, error) {
+	return FetchLatestPipeline(ctx, c.baseURL, projectID, ref, c.token)
+}
+
+// FetchPipelines gets the most recent pipelines of a project
+func (c *HTTPClient) FetchPipelines(ctx context.Context, projectID, ref string, count int) ([]models.Pipeline, error) {
+	return FetchPipelines(ctx, c.baseURL, projectID, ref, c.token, count)
+}
+
+// FetchLastSuccessPipeline gets the last successful pipeline of a project
+func (c *HTTPClient) FetchLastSuccessPipeline(ctx context.Context, projectID, ref string) (*models.Pipeline, error) {
+	return FetchLastSuccessPipeline(ctx, c.baseURL, projectID, ref, c.token)
+}
+
+// FetchPipeline gets a single pipeline of a project
+func (c *HTTPClient) FetchPipeline(ctx context.Context, projectID string, pipelineID int) (*models.Pipeline, error) {
+	return FetchPipeline(ctx, c.baseURL, projectID, pipelineID, c.token)
+}
+
+// FetchMergeRequestPipelines gets the pipelines of a merge request
+func (c *HTTPClient) FetchMergeRequestPipelines(ctx context.Context, projectID string, mergeRequestIID int) ([]models.Pipeline, error) {
+	return FetchMergeRequestPipelines(ctx, c.baseURL, projectID, mergeRequestIID, c.token)
+}
+
+// FetchFinishedPipelines gets a page of the finished pipelines of a project updated since a time
+func (c *HTTPClient) FetchFinishedPipelines(ctx context.Context, projectID string, since time.Time, page int) ([]models.Pipeline, error) {
+	return FetchFinishedPipelines(ctx, c.baseURL, projectID, since, page, c.token)
+}
+
+// CreatePipeline runs a new pipeline for a ref of a project
+func (c *HTTPClient) CreatePipeline(ctx context.Context, projectID, ref string, variables []models.PipelineVariable) (*models.Pipeline, error) {
+	return CreatePipeline(ctx, c.baseURL, projectID, ref, variables, c.token)
+}
+
+// FetchPipelineSchedules gets the pipeline schedules of a project
+func (c *HTTPClient) FetchPipelineSchedules(ctx context.Context, projectID string) ([]models.PipelineSchedule, error) {
+	return FetchPipelineSchedules(ctx, c.baseURL, projectID, c.token)
+}
+
+// FetchPipelineSchedule gets a single pipeline schedule with its last pipeline
+func (c *HTTPClient) FetchPipelineSchedule(ctx context.Context, projectID string, scheduleID int) (*models.PipelineSchedule, error) {
+	return FetchPipelineSchedule(ctx, c.baseURL, projectID, scheduleID, c.token)
+}
+
+// CreatePipelineSchedule creates a pipeline schedule in a project
+func (c *HTTPClient) CreatePipelineSchedule(ctx context.Context, projectID string, schedule models.PipelineSchedule) (*models.PipelineSchedule, error) {
+	return CreatePipelineSchedule(ctx, c.baseURL, projectID, schedule, c.token)
+}
+
+// SetPipelineScheduleActive pauses or resumes a pipeline schedule
+func (c *HTTPClient) SetPipelineScheduleActive(ctx context.Context, projectID string, scheduleID int, active bool) (*models.PipelineSchedule, error) {
+	return SetPipelineScheduleActive(ctx, c.baseURL, projectID, scheduleID, active, c.token)
+}
+
+// FetchPipelineJobs gets the jobs of a pipeline
+func (c *HTTPClient) FetchPipelineJobs(ctx context.Context, projectID string, pipelineID int) ([]models.Job, error) {
+	return FetchPipelineJobs(ctx, c.baseURL, projectID, pipelineID, c.token)
+}
+
+// FetchPipelineBridges gets the trigger jobs of a pipeline
+func (c *HTTPClient) FetchPipelineBridges(ctx context.Context, projectID string, pipelineID int) ([]models.Bridge, error) {
+	return FetchPipelineBridges(ctx, c.baseURL, projectID, pipelineID, c.token)
+}
+
+// FetchJobTrace gets the last lines of a job's log
+func (c *HTTPClient) FetchJobTrace(ctx context.Context, projectID string, jobID int, lines int) (string, error) {
+	return FetchJobTrace(ctx, c.baseURL, projectID, jobID, c.token, lines)
+}
+
+// RetryJob retries a failed job
+func (c *HTTPClient) RetryJob(ctx context.Context, projectID string, jobID int) (*models.Job, error) {
+	return RetryJob(ctx, c.baseURL, projectID, jobID, c.token)
+}
+
+// FetchTestReportSummary gets the test case counts of a pipeline
+func (c *HTTPClient) FetchTestReportSummary(ctx context.Context, projectID string, pipelineID int) (*models.TestReportSummary, error) {
+	return FetchTestReportSummary(ctx, c.baseURL, projectID, pipelineID, c.token)
+}
+
+// GetProject fetches a single project by ID or path
+func (c *HTTPClient) GetProject(ctx context.Context, projectPath string) (*models.Project, error) {
+	return GetProject(ctx, c.baseURL, projectPath, c.token)
+}
+
+// FetchEnvironments gets the available environments of a project
+func (c *HTTPClient) FetchEnvironments(ctx context.Context, projectID string) ([]models.Environment, error) {
+	return FetchEnvironments(ctx, c.baseURL, projectID, c.token)
+}
+
+// FetchDeployments gets the most recent deployments of a project, optionally limited to an environment and status
+func (c *HTTPClient) FetchDeployments(ctx context.Context, projectID, environment, status string, count int) ([]models.Deployment, error) {
+	return FetchDeployments(ctx, c.baseURL, projectID, environment, status, c.token, count)
+}
+
+// FetchRunners gets the runners of a project, or of the instance when projectID is empty
+func (c *HTTPClient) FetchRunners(ctx context.Context, projectID string) ([]models.Runner, error) {
+	return FetchRunners(ctx, c.baseURL, projectID, c.token)
+}
+
+// FetchAvatar downloads a project or group avatar
+func (c *HTTPClient) FetchAvatar(ctx context.Context, avatarURL string) ([]byte, error) {
+	return FetchAvatar(ctx, avatarURL, c.token)
+}
+
+// FetchClusterAgents gets the agents for Kubernetes of a project with their last contact
+func (c *HTTPClient) FetchClusterAgents(ctx context.Context, projectID string) ([]models.ClusterAgent, error) {
+	return FetchClusterAgents(ctx, c.baseURL, projectID, c.token)
+}
+
+// FetchLatestTag gets the most recently updated tag of a project
+func (c *HTTPClient) FetchLatestTag(ctx context.Context, projectID string) (*models.Tag, error) {
+	return FetchLatestTag(ctx, c.baseURL, projectID, c.token)
+}
+
+// CountCommitsBetween counts the commits on to that aren't on from
+func (c *HTTPClient) CountCommitsBetween(ctx context.Context, projectID, from, to string) (int, error) {
+	return CountCommitsBetween(ctx, c.baseURL, projectID, from, to, c.token)
+}
+
+// FetchOpenMergeRequests gets the open merge requests targeting a branch, optionally limited to labels
+func (c *HTTPClient) FetchOpenMergeRequests(ctx context.Context, projectID, targetBranch, labels string) ([]models.MergeRequest, error) {
+	return FetchOpenMergeRequests(ctx, c.baseURL, projectID, targetBranch, labels, c.token)
+}
+
+// FetchLatestRelease gets the most recently released release of a project
+func (c *HTTPClient) FetchLatestRelease(ctx context.Context, projectID string) (*models.Release, error) {
+	return FetchLatestRelease(ctx, c.baseURL, projectID, c.token)
+}
+
+// FetchReleasesSince gets the releases of a project released at or after since
+func (c *HTTPClient) FetchReleasesSince(ctx context.Context, projectID string, since time.Time) ([]models.Release, error) {
+	return FetchReleasesSince(ctx, c.baseURL, projectID, since, c.token)
+}
+
+// FetchInstanceInfo gets the version and capabilities of the GitLab instance
+func (c *HTTPClient) FetchInstanceInfo(ctx context.Context) (*models.InstanceInfo, error) {
+	return FetchInstanceInfo(ctx, c.baseURL, c.token)
+}
+
+// ValidateToken checks that the token is accepted and has the read_api scope
+func (c *HTTPClient) ValidateToken(ctx context.Context) (*models.TokenValidation, error) {
+	return ValidateToken(ctx, c.baseURL, c.token)
+}
+
+// FetchRefProtection checks whether a ref is protected and whether pipelines must succeed to merge
+func (c *HTTPClient) FetchRefProtection(ctx context.Context, projectID, ref string) (*models.RefProtection, error) {
+	return FetchRefProtection(ctx, c.baseURL, projectID, ref, c.token)
+}
+
+// FetchCurrentIterations gets the current iterations of a group and its ancestor groups
+func (c *HTTPClient) FetchCurrentIterations(ctx context.Context, groupID string) ([]models.Iteration, error) {
+	return FetchCurrentIterations(ctx, c.baseURL, groupID, c.token)
+}
+
+// FetchIterationIssues gets the open issues of a project in an iteration
+func (c *HTTPClient) FetchIterationIssues(ctx context.Context, projectID string, iterationID int) ([]models.Issue, error) {
+	return FetchIterationIssues(ctx, c.baseURL, projectID, iterationID, c.token)
+}
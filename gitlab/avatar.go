@@ -0,0 +1,32 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// maxAvatarBytes is the largest avatar image that is fetched
+const maxAvatarBytes = 1 << 20
+
+// FetchAvatar downloads a project or group avatar with the token, so avatars of private projects can be
+// shown without a GitLab session. The URL must come from GitLab, avatarURL is requested as is.
+func FetchAvatar(ctx context.Context, avatarURL, token string) ([]byte, error) {
+	var image []byte
+	_, err := sendRequest(ctx, "GET", avatarURL, token, "", func(body io.Reader) error {
+		var err error
+		image, err = io.ReadAll(io.LimitReader(body, maxAvatarBytes+1))
+		if err != nil {
+			return err
+		}
+		if len(image) > maxAvatarBytes {
+			return fmt.Errorf("avatar exceeds %d bytes", maxAvatarBytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
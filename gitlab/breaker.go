@@ -0,0 +1,112 @@
+package gitlab
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBreakerThreshold is the default number of consecutive failures that trip the circuit
+	DefaultBreakerThreshold = 5
+	// DefaultBreakerCooldown is the default time the circuit stays open before a request tests whether GitLab recovered
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without contacting GitLab while the instance is considered unavailable
+var ErrCircuitOpen = errors.New("GitLab API unavailable (circuit breaker open)")
+
+// circuitBreaker stops API calls after repeated failures. Once the cooldown passed it lets one request
+// through to test whether GitLab recovered: its success closes the circuit, its failure keeps it open
+// for another cooldown. Any request can be the test, so one endpoint that keeps failing doesn't hold
+// the circuit open while the rest of the API answers.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	open      bool
+	openedAt  time.Time
+	trialAt   time.Time // When the last request was let through while the circuit is open
+}
+
+var breaker = &circuitBreaker{
+	threshold: DefaultBreakerThreshold,
+	cooldown:  DefaultBreakerCooldown,
+}
+
+// ConfigureCircuitBreaker sets the failure threshold and cooldown of the circuit breaker
+func ConfigureCircuitBreaker(threshold int, cooldown time.Duration) {
+	if threshold < 1 {
+		threshold = DefaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	breaker.threshold = threshold
+	breaker.cooldown = cooldown
+	log.Printf("Using GitLab API circuit breaker: trips after %d failures, tests for recovery after %v", threshold, cooldown)
+}
+
+// CircuitOpen reports whether GitLab API calls are currently being short-circuited
+func CircuitOpen() bool {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	return breaker.open
+}
+
+// allow reports whether a request may be sent to GitLab. While the circuit is open, one request is
+// let through per cooldown; a test request that ends without an answer, e.g. because it was canceled,
+// is replaced by another after the next cooldown.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return true
+	}
+	since := b.openedAt
+	if b.trialAt.After(since) {
+		since = b.trialAt
+	}
+	if time.Since(since) < b.cooldown {
+		return false
+	}
+	b.trialAt = time.Now()
+	log.Printf("GitLab API circuit breaker letting a request through to test for recovery")
+	return true
+}
+
+// recordSuccess resets the failure count and closes the circuit
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	if b.open {
+		log.Printf("GitLab API circuit breaker closed after %.0f seconds", time.Since(b.openedAt).Seconds())
+		b.open = false
+	}
+}
+
+// recordFailure counts a transient failure and trips the circuit once the threshold is reached. A
+// failure while the circuit is open keeps it open for another cooldown.
+func (b *circuitBreaker) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.open {
+		b.openedAt = time.Now()
+		log.Printf("GitLab API circuit breaker stays open, the test request failed")
+		return
+	}
+	if b.failures < b.threshold {
+		return
+	}
+
+	b.open = true
+	b.openedAt = time.Now()
+	log.Printf("WARNING: GitLab API circuit breaker opened after %d consecutive failures", b.failures)
+}
@@ -0,0 +1,42 @@
+package gitlab
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerLetsOneRequestThroughAfterCooldown(t *testing.T) {
+	b := &circuitBreaker{threshold: 2, cooldown: 20 * time.Millisecond}
+
+	b.recordFailure()
+	if !b.allow() {
+		t.Fatal("circuit opened before the threshold")
+	}
+	b.recordFailure()
+	if b.allow() {
+		t.Fatal("circuit didn't open at the threshold")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("no request let through after the cooldown")
+	}
+	if b.allow() {
+		t.Fatal("a second request let through while the first tests for recovery")
+	}
+
+	// The test request failed, so the circuit stays open for another cooldown
+	b.recordFailure()
+	if b.allow() {
+		t.Fatal("request let through right after the test request failed")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("no request let through after the second cooldown")
+	}
+	b.recordSuccess()
+	if !b.allow() || !b.allow() {
+		t.Error("circuit didn't close after the test request succeeded")
+	}
+}
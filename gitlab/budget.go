@@ -0,0 +1,204 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Features that GitLab API calls are accounted to
+const (
+	FeatureSync         = "sync"
+	FeatureStatus       = "status"
+	FeatureMembership   = "membership"
+	FeatureRegistration = "registration"
+	FeatureImport       = "import"
+	FeatureOther        = "other"
+)
+
+// budgetWindow is the period API call budgets apply to
+const budgetWindow = time.Hour
+
+// ErrBudgetExceeded is returned without contacting GitLab once a feature used up its hourly API call budget
+var ErrBudgetExceeded = errors.New("GitLab API call budget exceeded")
+
+// ErrRequestBudgetExceeded is returned without contacting GitLab once serving one HTTP request
+// made as many API calls as WithRequestBudget allows
+var ErrRequestBudgetExceeded = errors.New("GitLab API call limit per request exceeded")
+
+// featureKey is the context key holding the feature an API call is accounted to
+type featureKey struct{}
+
+// WithFeature returns a context whose GitLab API calls are accounted to feature
+func WithFeature(ctx context.Context, feature string) context.Context {
+	return context.WithValue(ctx, featureKey{}, feature)
+}
+
+// featureFrom returns the feature of a context, FeatureOther if none was set
+func featureFrom(ctx context.Context) string {
+	if feature, ok := ctx.Value(featureKey{}).(string); ok && feature != "" {
+		return feature
+	}
+	return FeatureOther
+}
+
+// BudgetUsage is the API call accounting of one feature
+type BudgetUsage struct {
+	Feature     string    `json:"feature"`
+	Calls       int       `json:"calls"`        // Calls in the current window
+	Budget      int       `json:"budget"`       // Allowed calls per window, 0 if unlimited
+	Rejected    int       `json:"rejected"`     // Calls rejected in the current window
+	Total       int       `json:"total"`        // Calls since startup
+	WindowStart time.Time `json:"window_start"` // Start of the current window
+}
+
+var (
+	budgetMu sync.Mutex
+	budgets  = make(map[string]int)
+	usage    = make(map[string]*BudgetUsage)
+)
+
+// ConfigureBudgets sets the hourly API call budget per feature from a spec like "sync=2000,status=10000".
+// Features without a budget are only counted.
+func ConfigureBudgets(spec string) error {
+	parsed := make(map[string]int)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		feature, limit, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("invalid budget %q, expected feature=calls", part)
+		}
+		calls, err := strconv.Atoi(strings.TrimSpace(limit))
+		if err != nil || calls < 0 {
+			return fmt.Errorf("invalid budget %q, expected feature=calls", part)
+		}
+		parsed[strings.TrimSpace(feature)] = calls
+	}
+
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+	budgets = parsed
+	for feature, calls := range parsed {
+		log.Printf("Limiting GitLab API calls for %s to %d per hour", feature, calls)
+	}
+	return nil
+}
+
+// GetBudgetUsage returns the API call accounting of every feature that made calls, sorted by feature
+func GetBudgetUsage() []BudgetUsage {
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+
+	features := make(map[string]bool)
+	for feature := range usage {
+		features[feature] = true
+	}
+	for feature := range budgets {
+		features[feature] = true
+	}
+
+	var result []BudgetUsage
+	for feature := range features {
+		u := currentUsage(feature)
+		u.Budget = budgets[feature]
+		result = append(result, *u)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Feature < result[j].Feature })
+	return result
+}
+
+// currentUsage returns the usage of a feature, starting a new window when the current one expired.
+// The caller must hold budgetMu.
+func currentUsage(feature string) *BudgetUsage {
+	u, ok := usage[feature]
+	if !ok {
+		u = &BudgetUsage{Feature: feature, WindowStart: time.Now()}
+		usage[feature] = u
+	}
+	if time.Since(u.WindowStart) >= budgetWindow {
+		u.WindowStart = time.Now()
+		u.Calls = 0
+		u.Rejected = 0
+	}
+	return u
+}
+
+// requestBudgetKey is the context key holding the API call cap of an HTTP request
+type requestBudgetKey struct{}
+
+// requestBudget caps the API calls made while serving one HTTP request, shared by the goroutines
+// fetching the request's projects in parallel
+type requestBudget struct {
+	limit    int64
+	calls    atomic.Int64
+	rejected atomic.Int64
+}
+
+// WithRequestBudget returns a context whose GitLab API calls fail with ErrRequestBudgetExceeded
+// after limit calls, so one page load can't flood GitLab. A limit of 0 doesn't cap the calls.
+func WithRequestBudget(ctx context.Context, limit int) context.Context {
+	return context.WithValue(ctx, requestBudgetKey{}, &requestBudget{limit: int64(limit)})
+}
+
+// RequestBudgetExceeded reports whether API calls of the request of ctx were rejected by its cap
+func RequestBudgetExceeded(ctx context.Context) bool {
+	b, ok := ctx.Value(requestBudgetKey{}).(*requestBudget)
+	return ok && b.rejected.Load() > 0
+}
+
+// RequestCalls returns how many API calls the request of ctx made and how many its cap rejected
+func RequestCalls(ctx context.Context) (int, int) {
+	b, ok := ctx.Value(requestBudgetKey{}).(*requestBudget)
+	if !ok {
+		return 0, 0
+	}
+	return int(b.calls.Load()), int(b.rejected.Load())
+}
+
+// spendRequestBudget accounts one API call to the request of ctx, failing when its cap is reached
+func spendRequestBudget(ctx context.Context) error {
+	b, ok := ctx.Value(requestBudgetKey{}).(*requestBudget)
+	if !ok || b.limit <= 0 {
+		return nil
+	}
+	if b.calls.Add(1) > b.limit {
+		b.calls.Add(-1)
+		b.rejected.Add(1)
+		return fmt.Errorf("%w (%d calls)", ErrRequestBudgetExceeded, b.limit)
+	}
+	return nil
+}
+
+// spendBudget accounts one API call to the request and the feature of ctx, failing when either
+// budget is used up
+func spendBudget(ctx context.Context) error {
+	if err := spendRequestBudget(ctx); err != nil {
+		return err
+	}
+	feature := featureFrom(ctx)
+
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+
+	u := currentUsage(feature)
+	if budget := budgets[feature]; budget > 0 && u.Calls >= budget {
+		u.Rejected++
+		if u.Rejected == 1 {
+			log.Printf("WARNING: GitLab API call budget of %d per hour exhausted for %s", budget, feature)
+		}
+		return fmt.Errorf("%w for %s (%d calls per hour)", ErrBudgetExceeded, feature, budget)
+	}
+	u.Calls++
+	u.Total++
+	return nil
+}
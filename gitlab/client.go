@@ -1,10 +1,13 @@
 package gitlab
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -15,63 +18,226 @@ import (
 	"gitlab-status/models"
 )
 
-// Client is a client for GitLab API requests
-var Client *http.Client
+// httpClient is the HTTP client used for GitLab API requests
+var httpClient *http.Client
 
-// Initialize initializes the GitLab API client with the given timeout
-func Initialize(timeout time.Duration) {
+// Initialize initializes the GitLab API client with the given timeout and transport options
+func Initialize(timeout time.Duration, opts TransportOptions) error {
 	log.Printf("Using GitLab API timeout of %v", timeout)
-	Client = &http.Client{Timeout: timeout}
+
+	transport, err := newTransport(opts)
+	if err != nil {
+		return err
+	}
+
+	var roundTripper http.RoundTripper = transport
+	switch {
+	case opts.RecordDir != "" && opts.ReplayDir != "":
+		return errors.New("GitLab fixtures can't be recorded and replayed at the same time")
+	case opts.RecordDir != "":
+		if roundTripper, err = newRecordingTransport(transport, opts.RecordDir); err != nil {
+			return err
+		}
+	case opts.ReplayDir != "":
+		if roundTripper, err = newReplayingTransport(opts.ReplayDir); err != nil {
+			return err
+		}
+	}
+
+	httpClient = &http.Client{Timeout: timeout, Transport: roundTripper, CheckRedirect: checkRedirect}
+	return nil
 }
 
-// makeRequest is a helper function to make GitLab API requests.
-func makeRequest(method, url, token string) ([]byte, error) {
-	log.Printf("Making GitLab API request: %s %s", method, url)
-	startTime := time.Now()
+// maxRedirects is how many redirects a request follows, as many as the default client
+const maxRedirects = 10
 
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		return nil, err
+// checkRedirect follows redirects like the default client, but drops the token when a redirect
+// leaves the scheme and host the request was sent to. Go only drops standard credential headers,
+// and GitLab redirects e.g. avatars in object storage to the storage host.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if req.URL.Scheme != via[0].URL.Scheme || req.URL.Host != via[0].URL.Host {
+		req.Header.Del("PRIVATE-TOKEN")
+	}
+	return nil
+}
+
+// apiResponse is the result of a GitLab API request
+type apiResponse struct {
+	ETag        string
+	NotModified bool // GitLab answered 304 to a conditional request
+}
+
+// apiRequest is a GitLab API request for send
+type apiRequest struct {
+	method string
+	url    string
+	token  string
+	etag   string // Sent as If-None-Match when set
+	body   []byte // JSON body of writes
+	write  bool   // Sent once, as a retried write that reached GitLab would repeat its effect
+}
+
+// sendRequest performs a GitLab API read, sending If-None-Match when etag is set, see send
+func sendRequest(ctx context.Context, method, url, token, etag string, decode func(io.Reader) error) (*apiResponse, error) {
+	return send(ctx, apiRequest{method: method, url: url, token: token, etag: etag}, decode)
+}
+
+// send performs a GitLab API request. The request is canceled together with ctx. A successful response
+// body is streamed to decode, limited to the configured maximum response size.
+// For reads, rate-limited requests (HTTP 429) are retried after the delay requested by GitLab,
+// network errors and 5xx responses are retried with exponential backoff. Writes are sent once, but
+// their failures count towards the circuit breaker and the throttling metrics like those of reads.
+func send(ctx context.Context, r apiRequest, decode func(io.Reader) error) (*apiResponse, error) {
+	if !breaker.allow() {
+		return nil, ErrCircuitOpen
 	}
-	req.Header.Set("PRIVATE-TOKEN", token)
+	method, url, token, etag := r.method, r.url, r.token, r.etag
+
+	log.Printf("Making GitLab API request: %s %s", method, url)
+	startTime := time.Now()
 
 	// Use the global client with configured timeout
-	if Client == nil {
+	if httpClient == nil {
 		// Fallback in case the client isn't initialized
-		Client = &http.Client{Timeout: 300 * time.Second}
+		httpClient = &http.Client{Timeout: 300 * time.Second, CheckRedirect: checkRedirect}
 		log.Printf("WARNING: Using fallback HTTP client with 300s timeout")
 	}
 
-	resp, err := Client.Do(req)
-	if err != nil {
-		log.Printf("ERROR: GitLab API request failed after %.2f seconds: %v",
-			time.Since(startTime).Seconds(), err)
-		return nil, fmt.Errorf("GitLab API request failed: %v (URL: %s)", err, url)
-	}
-	defer resp.Body.Close()
+	rateLimitRetries := 0
+	for attempt := 1; ; attempt++ {
+		var payload io.Reader
+		if r.body != nil {
+			payload = bytes.NewReader(r.body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, payload)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("PRIVATE-TOKEN", token)
+		if r.body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("User-Agent", userAgentFrom(ctx))
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
 
-	log.Printf("GitLab API response received in %.2f seconds with status: %s",
-		time.Since(startTime).Seconds(), resp.Status)
+		// Every attempt puts load on GitLab and counts against the feature's budget
+		if err := spendBudget(ctx); err != nil {
+			return nil, err
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := ioutil.ReadAll(resp.Body)
-		log.Printf("ERROR: GitLab API non-OK response: %s - Body: %s", resp.Status, string(bodyBytes))
-		return nil, fmt.Errorf("GitLab API request failed with status %s (URL: %s)", resp.Status, url)
-	}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				// Canceled by the caller, GitLab itself may be fine
+				log.Printf("GitLab API request canceled after %.2f seconds: %v (URL: %s)",
+					time.Since(startTime).Seconds(), ctx.Err(), url)
+				return nil, contextError(ctx)
+			}
+			log.Printf("ERROR: GitLab API request failed after %.2f seconds: %v",
+				time.Since(startTime).Seconds(), err)
+			if !r.write && attempt < maxAttempts {
+				wait := retryDelay(attempt - 1)
+				log.Printf("Retrying GitLab API request in %v (attempt %d/%d)", wait, attempt+1, maxAttempts)
+				if err := sleepContext(ctx, wait); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			breaker.recordFailure()
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, fmt.Errorf("%w: %v (URL: %s)", ErrTimeout, err, url)
+			}
+			return nil, fmt.Errorf("GitLab API request failed: %v (URL: %s)", err, url)
+		}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("Error reading GitLab API response: %v", err)
-	}
+		recordRateLimitHeaders(resp)
 
-	log.Printf("GitLab API request completed in %.2f seconds, response size: %d bytes",
-		time.Since(startTime).Seconds(), len(body))
+		log.Printf("GitLab API response received in %.2f seconds with status: %s",
+			time.Since(startTime).Seconds(), resp.Status)
 
-	return body, nil
+		if resp.StatusCode == http.StatusTooManyRequests {
+			recordThrottled()
+		}
+		// Rate-limited writes didn't take effect, but are still only sent once
+		if resp.StatusCode == http.StatusTooManyRequests && !r.write {
+			resp.Body.Close()
+			if rateLimitRetries >= maxRateLimitRetries {
+				return nil, fmt.Errorf("%w after %d retries (URL: %s)", ErrRateLimited, rateLimitRetries, url)
+			}
+			rateLimitRetries++
+			// Rate limit waits don't count as failed attempts
+			attempt--
+			wait := rateLimitWait(resp)
+			log.Printf("WARNING: GitLab API rate limit hit, retrying in %v (attempt %d/%d)",
+				wait, rateLimitRetries, maxRateLimitRetries)
+			if err := sleepContext(ctx, wait); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if resp.StatusCode == http.StatusNotModified && etag != "" {
+			resp.Body.Close()
+			breaker.recordSuccess()
+			log.Printf("GitLab API resource not modified, completed in %.2f seconds",
+				time.Since(startTime).Seconds())
+			return &apiResponse{ETag: etag, NotModified: true}, nil
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+			resp.Body.Close()
+			log.Printf("ERROR: GitLab API non-OK response: %s - Body: %s", resp.Status, string(bodyBytes))
+			if isRetryableStatus(resp.StatusCode) && !r.write && attempt < maxAttempts {
+				wait := retryDelay(attempt - 1)
+				log.Printf("Retrying GitLab API request in %v (attempt %d/%d)", wait, attempt+1, maxAttempts)
+				if err := sleepContext(ctx, wait); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if isRetryableStatus(resp.StatusCode) {
+				breaker.recordFailure()
+			} else {
+				breaker.recordSuccess()
+			}
+			apiErr := &APIError{StatusCode: resp.StatusCode, Status: resp.Status, URL: url}
+			if r.write {
+				apiErr.Message = gitLabErrorMessage(bodyBytes)
+			}
+			return nil, apiErr
+		}
+
+		breaker.recordSuccess()
+
+		body := &limitedReader{r: resp.Body, remaining: maxResponseBytes}
+		err = decode(body)
+		resp.Body.Close()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, contextError(ctx)
+			}
+			if body.exceeded {
+				return nil, fmt.Errorf("GitLab API response exceeds the maximum size of %d bytes (URL: %s)", maxResponseBytes, url)
+			}
+			return nil, fmt.Errorf("failed to parse GitLab API response JSON: %v (URL: %s)", err, url)
+		}
+
+		log.Printf("GitLab API request completed in %.2f seconds, response size: %d bytes",
+			time.Since(startTime).Seconds(), body.read)
+
+		return &apiResponse{ETag: resp.Header.Get("ETag")}, nil
+	}
 }
 
 // FetchGroups gets all GitLab groups accessible with the token
-func FetchGroups(gitlabURL, token string) ([]models.Group, error) {
+func FetchGroups(ctx context.Context, gitlabURL, token string) ([]models.Group, error) {
 	page := 1
 	perPage := 100 // Maximum allowed by GitLab API
 	maxPages := 5  // Limit number of pages to fetch to avoid extremely long requests
@@ -85,17 +251,12 @@ func FetchGroups(gitlabURL, token string) ([]models.Group, error) {
 			gitlabURL, perPage, page)
 
 		log.Printf("Fetching page %d of groups...", page)
-		body, err := makeRequest("GET", apiURL, token)
+		groups, err := getJSON[[]models.Group](ctx, apiURL, token)
 		if err != nil {
 			log.Printf("Error fetching groups page %d: %v", page, err)
 			return nil, err
 		}
 
-		var groups []models.Group
-		if err := json.Unmarshal(body, &groups); err != nil {
-			return nil, fmt.Errorf("failed to parse groups JSON: %v", err)
-		}
-
 		log.Printf("Fetched %d groups on page %d", len(groups), page)
 
 		// Break if no more groups
@@ -124,43 +285,33 @@ func FetchGroups(gitlabURL, token string) ([]models.Group, error) {
 }
 
 // FetchSubgroups gets all subgroups for a specific group
-func FetchSubgroups(gitlabURL, token string, groupID int) ([]models.Group, error) {
+func FetchSubgroups(ctx context.Context, gitlabURL, token string, groupID int) ([]models.Group, error) {
 	apiURL := fmt.Sprintf("%s/api/v4/groups/%d/subgroups?per_page=100&order_by=name&sort=asc&all_available=true",
 		gitlabURL, groupID)
 
-	body, err := makeRequest("GET", apiURL, token)
+	subgroups, err := getJSON[[]models.Group](ctx, apiURL, token)
 	if err != nil {
 		return nil, err
 	}
 
-	var subgroups []models.Group
-	if err := json.Unmarshal(body, &subgroups); err != nil {
-		return nil, fmt.Errorf("failed to parse subgroups JSON: %v", err)
-	}
-
 	return subgroups, nil
 }
 
 // FetchGroupProjects gets all projects for a specific group
-func FetchGroupProjects(gitlabURL, token string, groupID int) ([]models.Project, error) {
+func FetchGroupProjects(ctx context.Context, gitlabURL, token string, groupID int) ([]models.Project, error) {
 	apiURL := fmt.Sprintf("%s/api/v4/groups/%d/projects?per_page=100&order_by=name&sort=asc&include_subgroups=false",
 		gitlabURL, groupID)
 
-	body, err := makeRequest("GET", apiURL, token)
+	projects, err := getJSON[[]models.Project](ctx, apiURL, token)
 	if err != nil {
 		return nil, err
 	}
 
-	var projects []models.Project
-	if err := json.Unmarshal(body, &projects); err != nil {
-		return nil, fmt.Errorf("failed to parse group projects JSON: %v", err)
-	}
-
 	return projects, nil
 }
 
 // BuildGroupTree recursively builds a hierarchical tree of groups with their projects
-func BuildGroupTree(gitlabURL, token string, groups []models.Group, parentID int, level int) ([]models.Group, error) {
+func BuildGroupTree(ctx context.Context, gitlabURL, token string, groups []models.Group, parentID int, level int) ([]models.Group, error) {
 	var result []models.Group
 
 	if level == 0 {
@@ -181,7 +332,7 @@ func BuildGroupTree(gitlabURL, token string, groups []models.Group, parentID int
 			group.Level = level
 
 			// Get subgroups
-			subgroups, err := FetchSubgroups(gitlabURL, token, group.ID)
+			subgroups, err := FetchSubgroups(ctx, gitlabURL, token, group.ID)
 			if err != nil {
 				log.Printf("Warning: Failed to fetch subgroups for group %s: %v", group.Name, err)
 			} else if len(subgroups) > 0 {
@@ -191,7 +342,7 @@ func BuildGroupTree(gitlabURL, token string, groups []models.Group, parentID int
 				}
 
 				// Recursively build tree for subgroups
-				group.Subgroups, err = BuildGroupTree(gitlabURL, token, subgroups, 0, level+1)
+				group.Subgroups, err = BuildGroupTree(ctx, gitlabURL, token, subgroups, 0, level+1)
 				if err != nil {
 					log.Printf("Warning: Failed to build subgroup tree for group %s: %v", group.Name, err)
 				}
@@ -199,7 +350,7 @@ func BuildGroupTree(gitlabURL, token string, groups []models.Group, parentID int
 
 			// Get projects for this group
 			projectStartTime := time.Now()
-			projects, err := FetchGroupProjects(gitlabURL, token, group.ID)
+			projects, err := FetchGroupProjects(ctx, gitlabURL, token, group.ID)
 			if err != nil {
 				log.Printf("Warning: Failed to fetch projects for group %s: %v", group.Name, err)
 			} else {
@@ -230,31 +381,71 @@ func BuildGroupTree(gitlabURL, token string, groups []models.Group, parentID int
 }
 
 // FetchProjects gets the list of all GitLab projects accessible with the token.
-func FetchProjects(gitlabURL, token string) ([]models.Project, error) {
+func FetchProjects(ctx context.Context, gitlabURL, token string) ([]models.Project, error) {
+	log.Printf("Fetching GitLab projects from %s", gitlabURL)
+	return fetchProjectPages(ctx, gitlabURL, token, "")
+}
+
+// FetchProjectsChangedSince gets the projects with activity after the given time, for incremental syncs.
+// Deleted projects are not reported; a full sync is needed to remove them from the cache.
+func FetchProjectsChangedSince(ctx context.Context, gitlabURL, token string, since time.Time) ([]models.Project, error) {
+	log.Printf("Fetching GitLab projects changed since %s from %s", since.Format(time.RFC3339), gitlabURL)
+	return fetchProjectPages(ctx, gitlabURL, token, "&last_activity_after="+url.QueryEscape(since.UTC().Format(time.RFC3339)))
+}
+
+// FetchMemberProjects gets every project the token's user is a member of. Unlike FetchProjects it
+// ignores the sync filters and pages through all projects, as it decides what the user may see.
+func FetchMemberProjects(ctx context.Context, gitlabURL, token string) ([]models.Project, error) {
+	perPage := 100
+	keyset := supportsKeysetPagination()
+	var allProjects []models.Project
+	for page, lastID := 1, 0; ; page++ {
+		apiURL := fmt.Sprintf("%s/api/v4/projects?membership=true&per_page=%d&page=%d&order_by=id&sort=asc",
+			gitlabURL, perPage, page)
+		if keyset {
+			apiURL = fmt.Sprintf("%s/api/v4/projects?membership=true&per_page=%d&order_by=id&sort=asc&id_after=%d",
+				gitlabURL, perPage, lastID)
+		}
+		projects, err := getJSON[[]models.Project](ctx, apiURL, token)
+		if err != nil {
+			return nil, err
+		}
+		allProjects = append(allProjects, projects...)
+		if len(projects) < perPage {
+			return allProjects, nil
+		}
+		lastID = projects[len(projects)-1].ID
+	}
+}
+
+// fetchProjectPages pages through the projects API, appending extraQuery to every request.
+// Instances with keyset pagination are paged by project ID, which stays consistent
+// while projects are created or renamed during the sync.
+func fetchProjectPages(ctx context.Context, gitlabURL, token, extraQuery string) ([]models.Project, error) {
 	// Get projects with pagination to ensure we get all projects
 	page := 1
 	perPage := 100 // Maximum allowed by GitLab API
 	maxPages := 10 // Limit number of pages to fetch to avoid extremely long requests
 	allProjects := []models.Project{}
-
-	log.Printf("Fetching GitLab projects from %s", gitlabURL)
+	keyset := supportsKeysetPagination()
+	lastID := 0
+	extraQuery = syncFilters.query() + extraQuery
 
 	for page <= maxPages {
-		apiURL := fmt.Sprintf("%s/api/v4/projects?per_page=%d&page=%d&order_by=name&sort=asc&membership=true",
-			gitlabURL, perPage, page)
+		apiURL := fmt.Sprintf("%s/api/v4/projects?per_page=%d&page=%d&order_by=name&sort=asc%s",
+			gitlabURL, perPage, page, extraQuery)
+		if keyset {
+			apiURL = fmt.Sprintf("%s/api/v4/projects?per_page=%d&order_by=id&sort=asc&id_after=%d%s",
+				gitlabURL, perPage, lastID, extraQuery)
+		}
 
 		log.Printf("Fetching page %d of projects...", page)
-		body, err := makeRequest("GET", apiURL, token)
+		projects, err := getJSON[[]models.Project](ctx, apiURL, token)
 		if err != nil {
 			log.Printf("Error fetching projects page %d: %v", page, err)
 			return nil, err
 		}
 
-		var projects []models.Project
-		if err := json.Unmarshal(body, &projects); err != nil {
-			return nil, fmt.Errorf("failed to parse projects JSON: %v", err)
-		}
-
 		log.Printf("Fetched %d projects on page %d", len(projects), page)
 
 		// Break if no more projects
@@ -263,6 +454,7 @@ func FetchProjects(gitlabURL, token string) ([]models.Project, error) {
 		}
 
 		allProjects = append(allProjects, projects...)
+		lastID = projects[len(projects)-1].ID
 
 		// If we got fewer projects than perPage, this is the last page
 		if len(projects) < perPage {
@@ -282,55 +474,169 @@ func FetchProjects(gitlabURL, token string) ([]models.Project, error) {
 	return allProjects, nil
 }
 
+// refQuery returns the query parameter limiting pipelines to a branch or tag, or "" for any ref
+func refQuery(ref string) string {
+	if ref == "" {
+		return ""
+	}
+	return "&ref=" + url.QueryEscape(ref)
+}
+
 // FetchLatestPipeline calls the GitLab API to get the latest pipeline for a project.
-func FetchLatestPipeline(gitlabURL, projectID, token string) (*models.Pipeline, error) {
-	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipelines?per_page=1", gitlabURL, projectID)
+// An empty ref returns the latest pipeline of any branch or tag.
+func FetchLatestPipeline(ctx context.Context, gitlabURL, projectID, ref, token string) (*models.Pipeline, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipelines?per_page=%d%s", gitlabURL, projectID, pipelinePageSize(1), refQuery(ref))
 
-	body, err := makeRequest("GET", apiURL, token)
+	pipelines, err := getJSON[[]models.Pipeline](ctx, apiURL, token)
 	if err != nil {
 		return nil, err
 	}
-
-	var pipelines []models.Pipeline
-	if err := json.Unmarshal(body, &pipelines); err != nil {
-		return nil, err
-	}
+	pipelines = filterPipelines(pipelines, 1)
 	if len(pipelines) == 0 {
-		return nil, fmt.Errorf("no pipelines found for project %s", projectID)
+		return nil, fmt.Errorf("%w for project %s", ErrNoPipelines, projectID)
 	}
 	return &pipelines[0], nil
 }
 
-// FetchPipelines gets multiple pipelines for a project.
-func FetchPipelines(gitlabURL, projectID, token string, count int) ([]models.Pipeline, error) {
-	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipelines?per_page=%d", gitlabURL, projectID, count)
+// FetchPipelines gets multiple pipelines for a project, limited to ref unless it is empty.
+func FetchPipelines(ctx context.Context, gitlabURL, projectID, ref, token string, count int) ([]models.Pipeline, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipelines?per_page=%d%s", gitlabURL, projectID, pipelinePageSize(count), refQuery(ref))
 
-	body, err := makeRequest("GET", apiURL, token)
+	pipelines, err := getJSON[[]models.Pipeline](ctx, apiURL, token)
 	if err != nil {
 		return nil, err
 	}
 
-	var pipelines []models.Pipeline
-	if err := json.Unmarshal(body, &pipelines); err != nil {
+	return filterPipelines(pipelines, count), nil
+}
+
+// PipelineHistoryPageSize is the number of pipelines per page of FetchFinishedPipelines
+const PipelineHistoryPageSize = 100
+
+// FetchFinishedPipelines gets a page of the finished pipelines of a project updated since a time, newest first.
+// Pages start at 1; a page shorter than PipelineHistoryPageSize is the last one.
+func FetchFinishedPipelines(ctx context.Context, gitlabURL, projectID string, since time.Time, page int, token string) ([]models.Pipeline, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipelines?scope=finished&updated_after=%s&order_by=id&sort=desc&per_page=%d&page=%d",
+		gitlabURL, projectID, url.QueryEscape(since.UTC().Format(time.RFC3339)), PipelineHistoryPageSize, page)
+
+	pipelines, err := getJSON[[]models.Pipeline](ctx, apiURL, token)
+	if err != nil {
 		return nil, err
 	}
 
 	return pipelines, nil
 }
 
-// FetchLastSuccessPipeline gets the last successful pipeline for a project.
-func FetchLastSuccessPipeline(gitlabURL, projectID, token string) (*models.Pipeline, error) {
-	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipelines?per_page=20&status=success", gitlabURL, projectID)
+// CreatePipeline runs a new pipeline for a ref of a project with the given variables.
+// The token needs the api scope and permission to run pipelines on the ref.
+func CreatePipeline(ctx context.Context, gitlabURL, projectID, ref string, variables []models.PipelineVariable, token string) (*models.Pipeline, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipeline", gitlabURL, projectID)
+
+	payload := struct {
+		Ref       string                    `json:"ref"`
+		Variables []models.PipelineVariable `json:"variables,omitempty"`
+	}{Ref: ref, Variables: variables}
+	pipeline, err := postJSON[models.Pipeline](ctx, apiURL, token, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pipeline, nil
+}
+
+// FetchPipeline gets a single pipeline of a project, including the fields only returned for single pipelines.
+func FetchPipeline(ctx context.Context, gitlabURL, projectID string, pipelineID int, token string) (*models.Pipeline, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipelines/%d", gitlabURL, projectID, pipelineID)
+
+	pipeline, err := getJSON[models.Pipeline](ctx, apiURL, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pipeline, nil
+}
+
+// FetchPipelineBridges gets the trigger jobs of a pipeline with the downstream pipelines they started.
+func FetchPipelineBridges(ctx context.Context, gitlabURL, projectID string, pipelineID int, token string) ([]models.Bridge, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipelines/%d/bridges?per_page=100", gitlabURL, projectID, pipelineID)
+
+	bridges, err := getJSON[[]models.Bridge](ctx, apiURL, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return bridges, nil
+}
+
+// FetchPipelineSchedules gets the pipeline schedules of a project.
+func FetchPipelineSchedules(ctx context.Context, gitlabURL, projectID, token string) ([]models.PipelineSchedule, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipeline_schedules?per_page=100", gitlabURL, projectID)
+
+	schedules, err := getJSON[[]models.PipelineSchedule](ctx, apiURL, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+// FetchPipelineSchedule gets a single pipeline schedule, including the last pipeline it started.
+func FetchPipelineSchedule(ctx context.Context, gitlabURL, projectID string, scheduleID int, token string) (*models.PipelineSchedule, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipeline_schedules/%d", gitlabURL, projectID, scheduleID)
+
+	schedule, err := getJSON[models.PipelineSchedule](ctx, apiURL, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+// CreatePipelineSchedule creates a pipeline schedule from the description, ref, cron, timezone and active
+// state of schedule. The token needs the api scope and at least the Developer role.
+func CreatePipelineSchedule(ctx context.Context, gitlabURL, projectID string, schedule models.PipelineSchedule, token string) (*models.PipelineSchedule, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipeline_schedules", gitlabURL, projectID)
+
+	payload := struct {
+		Description  string `json:"description"`
+		Ref          string `json:"ref"`
+		Cron         string `json:"cron"`
+		CronTimezone string `json:"cron_timezone,omitempty"`
+		Active       bool   `json:"active"`
+	}{schedule.Description, schedule.Ref, schedule.Cron, schedule.CronTimezone, schedule.Active}
+	created, err := postJSON[models.PipelineSchedule](ctx, apiURL, token, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// SetPipelineScheduleActive pauses or resumes a pipeline schedule. GitLab only lets the owner of
+// a schedule or a Maintainer change it.
+func SetPipelineScheduleActive(ctx context.Context, gitlabURL, projectID string, scheduleID int, active bool, token string) (*models.PipelineSchedule, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipeline_schedules/%d", gitlabURL, projectID, scheduleID)
 
-	body, err := makeRequest("GET", apiURL, token)
+	payload := struct {
+		Active bool `json:"active"`
+	}{active}
+	schedule, err := putJSON[models.PipelineSchedule](ctx, apiURL, token, payload)
 	if err != nil {
 		return nil, err
 	}
 
-	var pipelines []models.Pipeline
-	if err := json.Unmarshal(body, &pipelines); err != nil {
+	return &schedule, nil
+}
+
+// FetchLastSuccessPipeline gets the last successful pipeline for a project, limited to ref unless it is empty.
+func FetchLastSuccessPipeline(ctx context.Context, gitlabURL, projectID, ref, token string) (*models.Pipeline, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipelines?per_page=20&status=success%s", gitlabURL, projectID, refQuery(ref))
+
+	pipelines, err := getJSON[[]models.Pipeline](ctx, apiURL, token)
+	if err != nil {
 		return nil, err
 	}
+	pipelines = filterPipelines(pipelines, 1)
 
 	if len(pipelines) == 0 {
 		return nil, nil // No successful pipelines found
@@ -339,31 +645,102 @@ func FetchLastSuccessPipeline(gitlabURL, projectID, token string) (*models.Pipel
 	return &pipelines[0], nil
 }
 
+// FetchPipelineJobs gets the jobs of a pipeline, newest first. Retried jobs are left out and only the
+// first 100 jobs are returned, which covers the stages of all but the largest pipelines.
+func FetchPipelineJobs(ctx context.Context, gitlabURL, projectID string, pipelineID int, token string) ([]models.Job, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipelines/%d/jobs?per_page=100", gitlabURL, projectID, pipelineID)
+
+	jobs, err := getJSON[[]models.Job](ctx, apiURL, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// RetryJob retries a failed or canceled job, which GitLab runs as a new job in the same pipeline.
+// The token needs the api scope and permission to run jobs in the project.
+func RetryJob(ctx context.Context, gitlabURL, projectID string, jobID int, token string) (*models.Job, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/jobs/%d/retry", gitlabURL, projectID, jobID)
+
+	job, err := postJSON[models.Job](ctx, apiURL, token, struct{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// testReportSummaryResponse is the part of a pipeline test report summary with the totals
+type testReportSummaryResponse struct {
+	Total models.TestReportSummary `json:"total"`
+}
+
+// FetchTestReportSummary gets the test case counts of a pipeline's test reports, or nil when it has none.
+func FetchTestReportSummary(ctx context.Context, gitlabURL, projectID string, pipelineID int, token string) (*models.TestReportSummary, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/pipelines/%d/test_report_summary", gitlabURL, projectID, pipelineID)
+
+	summary, err := getJSON[testReportSummaryResponse](ctx, apiURL, token)
+	if errors.Is(err, ErrNotFound) {
+		// GitLab before 14.2 has no test report summaries
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if summary.Total.Total == 0 {
+		return nil, nil
+	}
+	return &summary.Total, nil
+}
+
 // GetProject fetches a single project by ID or path.
-func GetProject(gitlabURL, projectPath, token string) (*models.Project, error) {
+func GetProject(ctx context.Context, gitlabURL, projectPath, token string) (*models.Project, error) {
 	encodedProjectPath := url.PathEscape(projectPath)
 	apiURL := fmt.Sprintf("%s/api/v4/projects/%s", gitlabURL, encodedProjectPath)
 
-	body, err := makeRequest("GET", apiURL, token)
+	project, err := getJSON[models.Project](ctx, apiURL, token)
 	if err != nil {
 		return nil, err
 	}
 
-	var project models.Project
-	if err := json.Unmarshal(body, &project); err != nil {
+	return &project, nil
+}
+
+// branchResponse is the part of a repository branch used to check its protection
+type branchResponse struct {
+	Protected bool `json:"protected"`
+}
+
+// FetchRefProtection checks whether a ref is a protected branch and whether the project requires
+// pipelines to succeed before merging. Refs that aren't branches are reported with IsBranch false.
+func FetchRefProtection(ctx context.Context, gitlabURL, projectID, ref, token string) (*models.RefProtection, error) {
+	project, err := GetProject(ctx, gitlabURL, projectID, token)
+	if err != nil {
 		return nil, err
 	}
+	protection := &models.RefProtection{PipelineRequired: project.OnlyAllowMergeIfPipelineSucceeds}
 
-	return &project, nil
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/repository/branches/%s", gitlabURL, url.PathEscape(projectID), url.PathEscape(ref))
+	branch, err := getJSON[branchResponse](ctx, apiURL, token)
+	if errors.Is(err, ErrNotFound) {
+		return protection, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	protection.IsBranch = true
+	protection.Protected = branch.Protected
+	return protection, nil
 }
 
 // CacheGitLabStructure fetches all groups and projects from GitLab and stores them in the database
-func CacheGitLabStructure(db *bun.DB, userID int64, gitlabURL, token string) error {
+func CacheGitLabStructure(ctx context.Context, db *bun.DB, userID int64, gitlabURL, token string) error {
 	log.Printf("Starting to cache GitLab structure for user ID %d from %s", userID, gitlabURL)
 	startTime := time.Now()
 
 	// Get the groups
-	groups, err := FetchGroups(gitlabURL, token)
+	groups, err := FetchGroups(ctx, gitlabURL, token)
 	if err != nil {
 		log.Printf("Error fetching groups: %v", err)
 		return err
@@ -371,7 +748,7 @@ func CacheGitLabStructure(db *bun.DB, userID int64, gitlabURL, token string) err
 	log.Printf("Successfully fetched %d groups", len(groups))
 
 	// Get the projects
-	projects, err := FetchProjects(gitlabURL, token)
+	projects, err := FetchProjects(ctx, gitlabURL, token)
 	if err != nil {
 		log.Printf("Error fetching projects: %v", err)
 		return err
@@ -416,6 +793,7 @@ func buildNestedGroupTree(cachedGroups []models.CachedGroup, cachedProjects []mo
 			Path:        cg.Path,
 			FullPath:    cg.FullPath,
 			WebURL:      cg.WebURL,
+			AvatarURL:   cg.AvatarURL,
 			ParentID:    cg.ParentID,
 			Subgroups:   []models.Group{},
 			Projects:    []models.Project{},
@@ -446,6 +824,8 @@ func buildNestedGroupTree(cachedGroups []models.CachedGroup, cachedProjects []mo
 			Path:              cp.Path,
 			PathWithNamespace: cp.PathWithNamespace,
 			WebURL:            cp.WebURL,
+			AvatarURL:         cp.AvatarURL,
+			Archived:          cp.Archived,
 			Level:             0,
 			Selected:          false,
 		}
@@ -0,0 +1,42 @@
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchAvatarDropsTokenOnRedirectToOtherHost(t *testing.T) {
+	var storageToken string
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		storageToken = r.Header.Get("PRIVATE-TOKEN")
+		w.Write([]byte("png"))
+	}))
+	defer storage.Close()
+
+	var gitlabToken string
+	gitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gitlabToken = r.Header.Get("PRIVATE-TOKEN")
+		http.Redirect(w, r, storage.URL+"/bucket/avatar.png", http.StatusFound)
+	}))
+	defer gitlab.Close()
+
+	if err := Initialize(10*time.Second, TransportOptions{}); err != nil {
+		t.Fatalf("initializing GitLab client: %v", err)
+	}
+	image, err := FetchAvatar(context.Background(), gitlab.URL+"/uploads/-/system/project/avatar/1/avatar.png", "secret")
+	if err != nil {
+		t.Fatalf("FetchAvatar: %v", err)
+	}
+	if string(image) != "png" {
+		t.Errorf("avatar = %q, want the image from storage", image)
+	}
+	if gitlabToken != "secret" {
+		t.Errorf("GitLab got token %q, want the token", gitlabToken)
+	}
+	if storageToken != "" {
+		t.Errorf("storage host got token %q, want none", storageToken)
+	}
+}
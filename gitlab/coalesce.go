@@ -0,0 +1,53 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// requestGroup coalesces concurrent identical GET requests into a single API call
+var requestGroup singleflight.Group
+
+// getJSON fetches and decodes a GitLab API resource. Concurrent calls for the same
+// URL and token share one request, e.g. when several users load a dashboard
+// containing the same project at the same moment.
+// The shared request runs with the context of the caller that started it; callers stop
+// waiting when their own context is canceled, and retry on their own when the shared request
+// failed for the starting caller only, because it went away or used up its call budget.
+func getJSON[T any](ctx context.Context, url, token string) (T, error) {
+	var zero T
+	started := false
+	ch := requestGroup.DoChan(etagKey(url, token), func() (interface{}, error) {
+		started = true
+		return fetchJSON[T](ctx, url, token)
+	})
+
+	var res singleflight.Result
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case res = <-ch:
+	}
+
+	if res.Err != nil {
+		if res.Shared && !started && ctx.Err() == nil && callerError(res.Err) {
+			return fetchJSON[T](ctx, url, token)
+		}
+		return zero, res.Err
+	}
+	if res.Shared {
+		log.Printf("Shared in-flight GitLab API response for %s", url)
+	}
+	// Every caller gets its own copy of shared slices
+	return cloneValue(res.Val.(T)), nil
+}
+
+// callerError reports whether a request failed because of the context or call budgets of the caller
+// that sent it, not because of GitLab
+func callerError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrRequestBudgetExceeded) || errors.Is(err, ErrBudgetExceeded)
+}
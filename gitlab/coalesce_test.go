@@ -0,0 +1,61 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetJSONRetriesWhenSharedRequestExceededStarterBudget(t *testing.T) {
+	var hits atomic.Int32
+	first := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			close(first)
+			<-release
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"id":7}`))
+	}))
+	defer server.Close()
+
+	if err := Initialize(10*time.Second, TransportOptions{}); err != nil {
+		t.Fatalf("initializing GitLab client: %v", err)
+	}
+	ConfigureRetries(2, 10*time.Millisecond)
+	t.Cleanup(func() { ConfigureRetries(DefaultMaxAttempts, DefaultRetryBackoff) })
+
+	type result struct {
+		value map[string]int
+		err   error
+	}
+	url := server.URL + "/api/v4/projects/1"
+
+	// The starter may make one call, so its retry after the 500 exceeds its budget
+	starter := make(chan result)
+	go func() {
+		value, err := getJSON[map[string]int](WithRequestBudget(context.Background(), 1), url, "secret")
+		starter <- result{value, err}
+	}()
+	<-first
+	waiter := make(chan result)
+	go func() {
+		value, err := getJSON[map[string]int](context.Background(), url, "secret")
+		waiter <- result{value, err}
+	}()
+	time.Sleep(50 * time.Millisecond) // Let the waiter join the request in flight
+	close(release)
+
+	if res := <-starter; !errors.Is(res.err, ErrRequestBudgetExceeded) {
+		t.Errorf("starter error = %v, want its call limit exceeded", res.err)
+	}
+	if res := <-waiter; res.err != nil || res.value["id"] != 7 {
+		t.Errorf("waiter got %v, %v, want the project from its own request", res.value, res.err)
+	}
+}
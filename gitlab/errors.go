@@ -0,0 +1,58 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors returned by the GitLab client, to be checked with errors.Is
+var (
+	// ErrNotFound means the resource doesn't exist or isn't visible to the token
+	ErrNotFound = errors.New("GitLab resource not found")
+	// ErrUnauthorized means the token is invalid, expired or lacks the required scope or permissions
+	ErrUnauthorized = errors.New("GitLab token unauthorized")
+	// ErrRateLimited means GitLab kept answering 429 after all rate limit retries
+	ErrRateLimited = errors.New("GitLab API rate limit exceeded")
+	// ErrTimeout means GitLab didn't answer within the configured timeout or the caller's deadline
+	ErrTimeout = errors.New("GitLab API request timed out")
+	// ErrNoPipelines means the project exists but has never run a pipeline
+	ErrNoPipelines = errors.New("no pipelines found")
+)
+
+// APIError is a GitLab API response with an unexpected HTTP status
+type APIError struct {
+	StatusCode int
+	Status     string
+	URL        string
+	Message    string // Reason given by GitLab, only read for rejected writes
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("GitLab API request failed with status %s: %s (URL: %s)", e.Status, e.Message, e.URL)
+	}
+	return fmt.Sprintf("GitLab API request failed with status %s (URL: %s)", e.Status, e.URL)
+}
+
+// Is maps HTTP statuses to the package's sentinel errors
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// contextError returns the error of a finished context, reporting expired deadlines as ErrTimeout
+func contextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, ctx.Err())
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,150 @@
+package gitlab
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// maxETagEntries bounds the number of cached responses kept in memory
+const maxETagEntries = 2000
+
+// etagEntry is a decoded GitLab API response together with its ETag
+type etagEntry struct {
+	key   string
+	etag  string
+	value interface{}
+}
+
+var (
+	etagMu    sync.Mutex
+	etagCache = make(map[string]*list.Element) // Elements of etagLRU by key
+	etagLRU   = list.New()                     // Responses from most to least recently used
+)
+
+// etagKey builds the cache key for a request; responses depend on the token's permissions
+func etagKey(url, token string) string {
+	return token + " " + url
+}
+
+// fetchJSON performs a conditional GET request and decodes the JSON response into T.
+// When GitLab answers 304 Not Modified the previously decoded value is reused,
+// skipping both the download and the JSON parsing.
+func fetchJSON[T any](ctx context.Context, url, token string) (T, error) {
+	var result T
+	key := etagKey(url, token)
+
+	cached, hasCached := cachedETag(key)
+	etag := ""
+	if hasCached {
+		etag = cached.etag
+	}
+
+	resp, err := sendRequest(ctx, "GET", url, token, etag, func(body io.Reader) error {
+		return decodeJSON(url, body, &result)
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	if resp.NotModified {
+		return cloneValue(cached.value.(T)), nil
+	}
+
+	if resp.ETag != "" {
+		cacheETag(etagEntry{key: key, etag: resp.ETag, value: cloneValue(result)})
+	}
+
+	return result, nil
+}
+
+// cachedETag returns the cached response of key, marking it as recently used
+func cachedETag(key string) (etagEntry, bool) {
+	etagMu.Lock()
+	defer etagMu.Unlock()
+	element, ok := etagCache[key]
+	if !ok {
+		return etagEntry{}, false
+	}
+	etagLRU.MoveToFront(element)
+	return element.Value.(etagEntry), true
+}
+
+// cacheETag keeps a response, dropping the least recently used ones beyond maxETagEntries
+func cacheETag(entry etagEntry) {
+	etagMu.Lock()
+	defer etagMu.Unlock()
+	if element, ok := etagCache[entry.key]; ok {
+		etagLRU.Remove(element)
+	}
+	etagCache[entry.key] = etagLRU.PushFront(entry)
+	for etagLRU.Len() > maxETagEntries {
+		delete(etagCache, etagLRU.Remove(etagLRU.Back()).(etagEntry).key)
+	}
+}
+
+// cloneValue returns a deep copy of a decoded response so callers can't modify cached responses
+// through the slices, maps or pointers in it
+func cloneValue[T any](v T) T {
+	rv := reflect.ValueOf(&v).Elem()
+	clone := reflect.New(rv.Type()).Elem()
+	deepCopy(clone, rv)
+	return clone.Interface().(T)
+}
+
+// deepCopy copies src into dst, which must be settable, with new slices, maps and pointed to values.
+// Unexported struct fields, such as the location of a time.Time, are shared.
+func deepCopy(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Pointer:
+		if src.IsNil() {
+			return
+		}
+		elem := reflect.New(src.Type().Elem())
+		deepCopy(elem.Elem(), src.Elem())
+		dst.Set(elem)
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		clone := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			deepCopy(clone.Index(i), src.Index(i))
+		}
+		dst.Set(clone)
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			deepCopy(dst.Index(i), src.Index(i))
+		}
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		clone := reflect.MakeMapWithSize(src.Type(), src.Len())
+		for iter := src.MapRange(); iter.Next(); {
+			value := reflect.New(src.Type().Elem()).Elem()
+			deepCopy(value, iter.Value())
+			clone.SetMapIndex(iter.Key(), value)
+		}
+		dst.Set(clone)
+	case reflect.Struct:
+		dst.Set(src)
+		for i := 0; i < src.NumField(); i++ {
+			if dst.Field(i).CanSet() {
+				deepCopy(dst.Field(i), src.Field(i))
+			}
+		}
+	case reflect.Interface:
+		if src.IsNil() {
+			return
+		}
+		value := reflect.New(src.Elem().Type()).Elem()
+		deepCopy(value, src.Elem())
+		dst.Set(value)
+	default:
+		dst.Set(src)
+	}
+}
@@ -0,0 +1,70 @@
+package gitlab
+
+import (
+	"container/list"
+	"strconv"
+	"testing"
+	"time"
+
+	"gitlab-status/models"
+)
+
+func TestCloneValueCopiesDeeply(t *testing.T) {
+	pipeline := &models.Pipeline{ID: 1, Status: "success"}
+	if clone := cloneValue(pipeline); clone == pipeline {
+		t.Error("pointer result is shared with the cache")
+	} else if clone.ID != 1 {
+		t.Errorf("cloned pipeline has ID %d, want 1", clone.ID)
+	}
+
+	artifacts := []models.Job{{ID: 2, Name: "build", ArtifactsFile: &models.ArtifactsFile{Filename: "dist.zip"}}}
+	clone := cloneValue(artifacts)
+	clone[0].Name = "changed"
+	clone[0].ArtifactsFile.Filename = "changed.zip"
+	if artifacts[0].Name != "build" || artifacts[0].ArtifactsFile.Filename != "dist.zip" {
+		t.Errorf("changing the clone changed the cached jobs to %+v", artifacts[0])
+	}
+
+	releasedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	release := cloneValue(&models.Release{TagName: "v1.0.0", ReleasedAt: releasedAt})
+	if !release.ReleasedAt.Equal(releasedAt) {
+		t.Errorf("cloned release date is %v, want %v", release.ReleasedAt, releasedAt)
+	}
+
+	counts := map[string][]int{"a": {1}}
+	cloned := cloneValue(counts)
+	cloned["a"][0] = 2
+	if counts["a"][0] != 1 {
+		t.Error("changing the cloned map changed the cached one")
+	}
+}
+
+func TestCacheETagEvictsLeastRecentlyUsed(t *testing.T) {
+	etagMu.Lock()
+	savedCache, savedLRU := etagCache, etagLRU
+	etagCache, etagLRU = make(map[string]*list.Element), list.New()
+	etagMu.Unlock()
+	t.Cleanup(func() {
+		etagMu.Lock()
+		etagCache, etagLRU = savedCache, savedLRU
+		etagMu.Unlock()
+	})
+
+	for i := 0; i < maxETagEntries; i++ {
+		cacheETag(etagEntry{key: strconv.Itoa(i), etag: "e"})
+	}
+	// Using the oldest entry keeps it over the second oldest
+	if _, ok := cachedETag("0"); !ok {
+		t.Fatal("entry 0 missing before the cache is full")
+	}
+	cacheETag(etagEntry{key: "new", etag: "e"})
+
+	if len(etagCache) != maxETagEntries || etagLRU.Len() != maxETagEntries {
+		t.Errorf("cache holds %d entries and %d in its LRU list, want %d", len(etagCache), etagLRU.Len(), maxETagEntries)
+	}
+	for key, want := range map[string]bool{"0": true, "1": false, "2": true, "new": true} {
+		if _, ok := cachedETag(key); ok != want {
+			t.Errorf("entry %s cached = %v, want %v", key, ok, want)
+		}
+	}
+}
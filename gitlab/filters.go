@@ -0,0 +1,76 @@
+package gitlab
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// Project scopes for syncs
+const (
+	// ScopeMembership syncs the projects the token's user is a member of
+	ScopeMembership = "membership"
+	// ScopeOwned syncs the projects owned by the token's user
+	ScopeOwned = "owned"
+	// ScopeAll syncs every project the token can see
+	ScopeAll = "all"
+)
+
+// SyncFilters limit which projects are fetched during syncs, so large instances can cache
+// only the relevant slice of projects
+type SyncFilters struct {
+	// Scope is ScopeMembership (default), ScopeOwned or ScopeAll
+	Scope string
+	// Visibility is "private", "internal", "public" or empty for all
+	Visibility string
+	// Topics only keeps projects that have all of the topics
+	Topics []string
+	// ExcludeArchived leaves archived projects out
+	ExcludeArchived bool
+}
+
+// syncFilters are the filters applied to project syncs
+var syncFilters = SyncFilters{Scope: ScopeMembership}
+
+// ConfigureSyncFilters validates and applies the project sync filters
+func ConfigureSyncFilters(filters SyncFilters) error {
+	switch filters.Scope {
+	case "":
+		filters.Scope = ScopeMembership
+	case ScopeMembership, ScopeOwned, ScopeAll:
+	default:
+		return fmt.Errorf("unknown project scope %q, use membership, owned or all", filters.Scope)
+	}
+	switch filters.Visibility {
+	case "", "private", "internal", "public":
+	default:
+		return fmt.Errorf("unknown visibility %q, use private, internal or public", filters.Visibility)
+	}
+
+	syncFilters = filters
+	log.Printf("Syncing GitLab projects with filters: %s", strings.TrimPrefix(filters.query(), "&"))
+	return nil
+}
+
+// query returns the filters as query parameters for the projects API, each prefixed with "&"
+func (f SyncFilters) query() string {
+	var query strings.Builder
+	switch f.Scope {
+	case ScopeOwned:
+		query.WriteString("&owned=true")
+	case ScopeAll:
+	default:
+		query.WriteString("&membership=true")
+	}
+	if f.Visibility != "" {
+		query.WriteString("&visibility=" + f.Visibility)
+	}
+	if len(f.Topics) > 0 {
+		query.WriteString("&topic=" + url.QueryEscape(strings.Join(f.Topics, ",")))
+	}
+	if f.ExcludeArchived {
+		query.WriteString("&archived=false")
+	}
+	return query.String()
+}
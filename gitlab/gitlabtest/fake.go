@@ -0,0 +1,506 @@
+// Package gitlabtest provides an in-memory GitLab client for tests.
+package gitlabtest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+// FakeClient is an in-memory gitlab.Client for tests. Pipelines are keyed by project ID
+// and ordered newest first, the way GitLab returns them.
+type FakeClient struct {
+	BaseURL   string
+	Groups    []models.Group
+	Projects  []models.Project
+	Pipelines map[string][]models.Pipeline
+	// Schedules are the pipeline schedules keyed by project ID
+	Schedules map[string][]models.PipelineSchedule
+	// MergeRequestPipelines are keyed by merge request IID
+	MergeRequestPipelines map[int][]models.Pipeline
+	// Jobs are keyed by pipeline ID
+	Jobs map[int][]models.Job
+	// Bridges are keyed by pipeline ID
+	Bridges map[int][]models.Bridge
+	// TestReports are keyed by pipeline ID
+	TestReports map[int]*models.TestReportSummary
+	// Traces are the job logs keyed by job ID
+	Traces map[int]string
+	// Environments are keyed by project ID
+	Environments map[string][]models.Environment
+	// Deployments are keyed by project ID and ordered newest first
+	Deployments map[string][]models.Deployment
+	// Runners are keyed by project ID, the instance runners by the empty string
+	Runners map[string][]models.Runner
+	// Avatars are the avatar images keyed by URL
+	Avatars map[string][]byte
+	// ClusterAgents are keyed by project ID
+	ClusterAgents map[string][]models.ClusterAgent
+	// Tags are keyed by project ID and ordered newest first
+	Tags map[string][]models.Tag
+	// UnreleasedCommits is returned by CountCommitsBetween, keyed by project ID
+	UnreleasedCommits map[string]int
+	// Releases are keyed by project ID and ordered newest first
+	Releases map[string][]models.Release
+	// MergeRequests are the open merge requests keyed by project ID
+	MergeRequests map[string][]models.MergeRequest
+	// Iterations are the current iterations keyed by group ID
+	Iterations map[string][]models.Iteration
+	// Issues are the open issues keyed by project ID
+	Issues map[string][]models.Issue
+	// Protection is returned by FetchRefProtection for every project and ref
+	Protection *models.RefProtection
+	// Instance is returned by FetchInstanceInfo
+	Instance *models.InstanceInfo
+	// Err, when set, is returned by every call
+	Err error
+}
+
+var _ gitlab.Client = (*FakeClient)(nil)
+
+// err returns the context error or the configured error
+func (f *FakeClient) err(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return f.Err
+}
+
+// URL returns the configured base URL
+func (f *FakeClient) URL() string {
+	return f.BaseURL
+}
+
+// FetchGroups returns the configured groups
+func (f *FakeClient) FetchGroups(ctx context.Context) ([]models.Group, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	return f.Groups, nil
+}
+
+// FetchProjects returns the configured projects
+func (f *FakeClient) FetchProjects(ctx context.Context) ([]models.Project, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	return f.Projects, nil
+}
+
+// FetchProjectsChangedSince returns all configured projects, since the fake does not track activity
+func (f *FakeClient) FetchProjectsChangedSince(ctx context.Context, since time.Time) ([]models.Project, error) {
+	return f.FetchProjects(ctx)
+}
+
+// FetchMemberProjects returns the configured projects, as the fake has a single user
+func (f *FakeClient) FetchMemberProjects(ctx context.Context) ([]models.Project, error) {
+	return f.FetchProjects(ctx)
+}
+
+// pipelines returns the configured pipelines of a project on ref, or on any ref when it is empty,
+// without merge request pipelines when they are excluded
+func (f *FakeClient) pipelines(projectID, ref string) []models.Pipeline {
+	var pipelines []models.Pipeline
+	for _, pipeline := range f.Pipelines[projectID] {
+		if (ref == "" || pipeline.Ref == ref) && !(gitlab.ExcludesMergeRequestPipelines() && pipeline.MergeRequest()) {
+			pipelines = append(pipelines, pipeline)
+		}
+	}
+	return pipelines
+}
+
+// FetchLatestPipeline returns the first configured pipeline of a project
+func (f *FakeClient) FetchLatestPipeline(ctx context.Context, projectID, ref string) (*models.Pipeline, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	pipelines := f.pipelines(projectID, ref)
+	if len(pipelines) == 0 {
+		return nil, fmt.Errorf("%w for project %s", gitlab.ErrNoPipelines, projectID)
+	}
+	return &pipelines[0], nil
+}
+
+// FetchPipelines returns up to count configured pipelines of a project
+func (f *FakeClient) FetchPipelines(ctx context.Context, projectID, ref string, count int) ([]models.Pipeline, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	pipelines := f.pipelines(projectID, ref)
+	if len(pipelines) > count {
+		pipelines = pipelines[:count]
+	}
+	return pipelines, nil
+}
+
+// FetchLastSuccessPipeline returns the newest configured successful pipeline of a project
+func (f *FakeClient) FetchLastSuccessPipeline(ctx context.Context, projectID, ref string) (*models.Pipeline, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	for _, pipeline := range f.pipelines(projectID, ref) {
+		if pipeline.Status == "success" {
+			return &pipeline, nil
+		}
+	}
+	return nil, nil
+}
+
+// FetchPipeline returns the configured pipeline of a project with the given ID
+func (f *FakeClient) FetchPipeline(ctx context.Context, projectID string, pipelineID int) (*models.Pipeline, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	for _, pipeline := range f.Pipelines[projectID] {
+		if pipeline.ID == pipelineID {
+			return &pipeline, nil
+		}
+	}
+	return nil, &gitlab.APIError{StatusCode: http.StatusNotFound, Status: "404 Not Found", URL: fmt.Sprintf("/api/v4/projects/%s/pipelines/%d", projectID, pipelineID)}
+}
+
+// FetchMergeRequestPipelines returns the configured pipelines of a merge request
+func (f *FakeClient) FetchMergeRequestPipelines(ctx context.Context, projectID string, mergeRequestIID int) ([]models.Pipeline, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	return f.MergeRequestPipelines[mergeRequestIID], nil
+}
+
+// FetchFinishedPipelines returns a page of the configured pipelines of a project created since a time
+func (f *FakeClient) FetchFinishedPipelines(ctx context.Context, projectID string, since time.Time, page int) ([]models.Pipeline, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	var pipelines []models.Pipeline
+	for _, pipeline := range f.Pipelines[projectID] {
+		if !pipeline.CreatedAt.Before(since) {
+			pipelines = append(pipelines, pipeline)
+		}
+	}
+	start := min((page-1)*gitlab.PipelineHistoryPageSize, len(pipelines))
+	end := min(start+gitlab.PipelineHistoryPageSize, len(pipelines))
+	return pipelines[start:end], nil
+}
+
+// CreatePipeline adds a created pipeline as the newest pipeline of a project
+func (f *FakeClient) CreatePipeline(ctx context.Context, projectID, ref string, variables []models.PipelineVariable) (*models.Pipeline, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	if f.Pipelines == nil {
+		f.Pipelines = make(map[string][]models.Pipeline)
+	}
+	id := 1
+	for _, pipeline := range f.Pipelines[projectID] {
+		id = max(id, pipeline.ID+1)
+	}
+	pipeline := models.Pipeline{ID: id, Ref: ref, Status: "created", Source: "api", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	f.Pipelines[projectID] = append([]models.Pipeline{pipeline}, f.Pipelines[projectID]...)
+	return &pipeline, nil
+}
+
+// FetchPipelineSchedules returns the configured schedules of a project
+func (f *FakeClient) FetchPipelineSchedules(ctx context.Context, projectID string) ([]models.PipelineSchedule, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	return f.Schedules[projectID], nil
+}
+
+// FetchPipelineSchedule returns the configured schedule of a project with the given ID
+func (f *FakeClient) FetchPipelineSchedule(ctx context.Context, projectID string, scheduleID int) (*models.PipelineSchedule, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	for _, schedule := range f.Schedules[projectID] {
+		if schedule.ID == scheduleID {
+			return &schedule, nil
+		}
+	}
+	return nil, &gitlab.APIError{StatusCode: http.StatusNotFound, Status: "404 Not Found", URL: fmt.Sprintf("/api/v4/projects/%s/pipeline_schedules/%d", projectID, scheduleID)}
+}
+
+// CreatePipelineSchedule adds a schedule to the configured schedules of a project
+func (f *FakeClient) CreatePipelineSchedule(ctx context.Context, projectID string, schedule models.PipelineSchedule) (*models.PipelineSchedule, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	if f.Schedules == nil {
+		f.Schedules = make(map[string][]models.PipelineSchedule)
+	}
+	schedule.ID = 1
+	for _, existing := range f.Schedules[projectID] {
+		schedule.ID = max(schedule.ID, existing.ID+1)
+	}
+	f.Schedules[projectID] = append(f.Schedules[projectID], schedule)
+	return &schedule, nil
+}
+
+// SetPipelineScheduleActive pauses or resumes a configured schedule
+func (f *FakeClient) SetPipelineScheduleActive(ctx context.Context, projectID string, scheduleID int, active bool) (*models.PipelineSchedule, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	for i, schedule := range f.Schedules[projectID] {
+		if schedule.ID == scheduleID {
+			f.Schedules[projectID][i].Active = active
+			schedule.Active = active
+			return &schedule, nil
+		}
+	}
+	return nil, &gitlab.APIError{StatusCode: http.StatusNotFound, Status: "404 Not Found", URL: fmt.Sprintf("/api/v4/projects/%s/pipeline_schedules/%d", projectID, scheduleID)}
+}
+
+// FetchPipelineJobs returns the configured jobs of a pipeline
+func (f *FakeClient) FetchPipelineJobs(ctx context.Context, projectID string, pipelineID int) ([]models.Job, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	return f.Jobs[pipelineID], nil
+}
+
+// FetchPipelineBridges returns the configured trigger jobs of a pipeline
+func (f *FakeClient) FetchPipelineBridges(ctx context.Context, projectID string, pipelineID int) ([]models.Bridge, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	return f.Bridges[pipelineID], nil
+}
+
+// FetchJobTrace returns the last lines of the configured log of a job
+func (f *FakeClient) FetchJobTrace(ctx context.Context, projectID string, jobID int, lines int) (string, error) {
+	if err := f.err(ctx); err != nil {
+		return "", err
+	}
+	trace := strings.Split(strings.TrimRight(f.Traces[jobID], "\n"), "\n")
+	if len(trace) > lines {
+		trace = trace[len(trace)-lines:]
+	}
+	return strings.Join(trace, "\n"), nil
+}
+
+// RetryJob adds a pending copy of a configured job to its pipeline
+func (f *FakeClient) RetryJob(ctx context.Context, projectID string, jobID int) (*models.Job, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	nextID := 1
+	for _, jobs := range f.Jobs {
+		for _, job := range jobs {
+			nextID = max(nextID, job.ID+1)
+		}
+	}
+	for pipelineID, jobs := range f.Jobs {
+		for _, job := range jobs {
+			if job.ID == jobID {
+				job.ID = nextID
+				job.Status = "pending"
+				f.Jobs[pipelineID] = append([]models.Job{job}, jobs...)
+				return &job, nil
+			}
+		}
+	}
+	return nil, gitlab.ErrNotFound
+}
+
+// FetchTestReportSummary returns the configured test report of a pipeline
+func (f *FakeClient) FetchTestReportSummary(ctx context.Context, projectID string, pipelineID int) (*models.TestReportSummary, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	return f.TestReports[pipelineID], nil
+}
+
+// GetProject returns the configured project with the given ID or path
+func (f *FakeClient) GetProject(ctx context.Context, projectPath string) (*models.Project, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	for _, project := range f.Projects {
+		if project.PathWithNamespace == projectPath || strconv.Itoa(project.ID) == projectPath {
+			return &project, nil
+		}
+	}
+	return nil, &gitlab.APIError{StatusCode: http.StatusNotFound, Status: "404 Not Found", URL: "/api/v4/projects/" + projectPath}
+}
+
+// FetchEnvironments returns the configured environments of a project
+func (f *FakeClient) FetchEnvironments(ctx context.Context, projectID string) ([]models.Environment, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	return f.Environments[projectID], nil
+}
+
+// FetchDeployments returns up to count configured deployments of a project matching the environment and status
+func (f *FakeClient) FetchDeployments(ctx context.Context, projectID, environment, status string, count int) ([]models.Deployment, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	var deployments []models.Deployment
+	for _, deployment := range f.Deployments[projectID] {
+		if len(deployments) == count {
+			break
+		}
+		if (environment == "" || deployment.Environment.Name == environment) && (status == "" || deployment.Status == status) {
+			deployments = append(deployments, deployment)
+		}
+	}
+	return deployments, nil
+}
+
+// FetchRunners returns the configured runners of a project or the instance
+func (f *FakeClient) FetchRunners(ctx context.Context, projectID string) ([]models.Runner, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	return f.Runners[projectID], nil
+}
+
+// FetchAvatar returns the configured avatar image of a URL
+func (f *FakeClient) FetchAvatar(ctx context.Context, avatarURL string) ([]byte, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	image, ok := f.Avatars[avatarURL]
+	if !ok {
+		return nil, &gitlab.APIError{StatusCode: http.StatusNotFound, Status: "404 Not Found", URL: avatarURL}
+	}
+	return image, nil
+}
+
+// FetchClusterAgents returns the configured agents for Kubernetes of a project
+func (f *FakeClient) FetchClusterAgents(ctx context.Context, projectID string) ([]models.ClusterAgent, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	return f.ClusterAgents[projectID], nil
+}
+
+// FetchLatestTag returns the first configured tag of a project
+func (f *FakeClient) FetchLatestTag(ctx context.Context, projectID string) (*models.Tag, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	if len(f.Tags[projectID]) == 0 {
+		return nil, nil
+	}
+	return &f.Tags[projectID][0], nil
+}
+
+// CountCommitsBetween returns the configured number of unreleased commits of a project
+func (f *FakeClient) CountCommitsBetween(ctx context.Context, projectID, from, to string) (int, error) {
+	if err := f.err(ctx); err != nil {
+		return 0, err
+	}
+	return f.UnreleasedCommits[projectID], nil
+}
+
+// FetchOpenMergeRequests returns the configured merge requests of a project that target the branch and have all labels
+func (f *FakeClient) FetchOpenMergeRequests(ctx context.Context, projectID, targetBranch, labels string) ([]models.MergeRequest, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	var mergeRequests []models.MergeRequest
+	for _, mr := range f.MergeRequests[projectID] {
+		if mr.TargetBranch == targetBranch && hasLabels(mr, labels) {
+			mergeRequests = append(mergeRequests, mr)
+		}
+	}
+	return mergeRequests, nil
+}
+
+// hasLabels reports whether a merge request has all of the comma-separated labels
+func hasLabels(mr models.MergeRequest, labels string) bool {
+	for _, label := range strings.Split(labels, ",") {
+		if label = strings.TrimSpace(label); label != "" && !slices.Contains(mr.Labels, label) {
+			return false
+		}
+	}
+	return true
+}
+
+// FetchLatestRelease returns the first configured release of a project
+func (f *FakeClient) FetchLatestRelease(ctx context.Context, projectID string) (*models.Release, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	if len(f.Releases[projectID]) == 0 {
+		return nil, nil
+	}
+	return &f.Releases[projectID][0], nil
+}
+
+// FetchReleasesSince returns the configured releases of a project released at or after since
+func (f *FakeClient) FetchReleasesSince(ctx context.Context, projectID string, since time.Time) ([]models.Release, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	var releases []models.Release
+	for _, release := range f.Releases[projectID] {
+		if !release.ReleasedAt.Before(since) {
+			releases = append(releases, release)
+		}
+	}
+	return releases, nil
+}
+
+// FetchInstanceInfo returns the configured instance, or an unknown version when none is set
+func (f *FakeClient) FetchInstanceInfo(ctx context.Context) (*models.InstanceInfo, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	if f.Instance == nil {
+		return &models.InstanceInfo{Version: "unknown", DetectedAt: time.Now()}, nil
+	}
+	return f.Instance, nil
+}
+
+// ValidateToken reports the token as valid
+func (f *FakeClient) ValidateToken(ctx context.Context) (*models.TokenValidation, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	return &models.TokenValidation{Username: "fake", Scopes: []string{"read_api"}, CheckedAt: time.Now()}, nil
+}
+
+// FetchRefProtection returns the configured protection, or an unprotected branch when none is set
+func (f *FakeClient) FetchRefProtection(ctx context.Context, projectID, ref string) (*models.RefProtection, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	if f.Protection == nil {
+		return &models.RefProtection{IsBranch: true}, nil
+	}
+	return f.Protection, nil
+}
+
+// FetchCurrentIterations returns the configured iterations of a group
+func (f *FakeClient) FetchCurrentIterations(ctx context.Context, groupID string) ([]models.Iteration, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	return f.Iterations[groupID], nil
+}
+
+// FetchIterationIssues returns the configured issues of a project in the iteration
+func (f *FakeClient) FetchIterationIssues(ctx context.Context, projectID string, iterationID int) ([]models.Issue, error) {
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	var issues []models.Issue
+	for _, issue := range f.Issues[projectID] {
+		if issue.Iteration != nil && issue.Iteration.ID == iterationID {
+			issues = append(issues, issue)
+		}
+	}
+	return issues, nil
+}
@@ -0,0 +1,95 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gitlab-status/models"
+)
+
+// currentInstance is the GitLab instance detected at startup, nil until detection succeeds
+var currentInstance atomic.Pointer[models.InstanceInfo]
+
+// metadataResponse is the body of /api/v4/metadata and, without the extra fields, /api/v4/version
+type metadataResponse struct {
+	Version    string `json:"version"`
+	Revision   string `json:"revision"`
+	Enterprise bool   `json:"enterprise" gitlab:"optional"` // Not returned by /version
+	KAS        struct {
+		Enabled bool `json:"enabled"`
+	} `json:"kas" gitlab:"optional"`
+}
+
+// FetchInstanceInfo gets the version of the GitLab instance and derives the features it supports.
+// /metadata only exists since GitLab 15.2, older instances fall back to /version.
+func FetchInstanceInfo(ctx context.Context, gitlabURL, token string) (*models.InstanceInfo, error) {
+	metadata, err := getJSON[metadataResponse](ctx, gitlabURL+"/api/v4/metadata", token)
+	if errors.Is(err, ErrNotFound) {
+		metadata, err = getJSON[metadataResponse](ctx, gitlabURL+"/api/v4/version", token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info := &models.InstanceInfo{
+		Version:    metadata.Version,
+		Revision:   metadata.Revision,
+		Enterprise: metadata.Enterprise,
+		KASEnabled: metadata.KAS.Enabled,
+		DetectedAt: time.Now(),
+	}
+	major, minor, err := parseVersion(metadata.Version)
+	if err != nil {
+		// Unknown versions keep every optional feature disabled
+		log.Printf("Cannot determine GitLab capabilities: %v", err)
+		return info, nil
+	}
+	info.GraphQL = versionAtLeast(major, minor, 12, 1)
+	info.KeysetPagination = versionAtLeast(major, minor, 13, 0)
+	return info, nil
+}
+
+// parseVersion extracts the major and minor version from strings like "16.3.2-ee"
+func parseVersion(version string) (int, int, error) {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("invalid GitLab version %q", version)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid GitLab version %q", version)
+	}
+	minor, err := strconv.Atoi(strings.TrimRightFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' }))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid GitLab version %q", version)
+	}
+	return major, minor, nil
+}
+
+// versionAtLeast reports whether major.minor is at least wantMajor.wantMinor
+func versionAtLeast(major, minor, wantMajor, wantMinor int) bool {
+	return major > wantMajor || (major == wantMajor && minor >= wantMinor)
+}
+
+// SetInstanceInfo records the detected GitLab instance, enabling the features it supports
+func SetInstanceInfo(info *models.InstanceInfo) {
+	currentInstance.Store(info)
+	log.Printf("Detected GitLab %s (GraphQL: %t, keyset pagination: %t)", info.Version, info.GraphQL, info.KeysetPagination)
+}
+
+// CurrentInstance returns the detected GitLab instance, or nil when detection has not succeeded
+func CurrentInstance() *models.InstanceInfo {
+	return currentInstance.Load()
+}
+
+// supportsKeysetPagination reports whether the detected instance can page projects by ID
+func supportsKeysetPagination() bool {
+	info := currentInstance.Load()
+	return info != nil && info.KeysetPagination
+}
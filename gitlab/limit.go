@@ -0,0 +1,56 @@
+package gitlab
+
+import (
+	"errors"
+	"io"
+	"log"
+)
+
+const (
+	// DefaultMaxResponseBytes is the default limit for a single GitLab API response body
+	DefaultMaxResponseBytes = 64 << 20
+	// maxErrorBodyBytes limits how much of an error response is read for logging
+	maxErrorBodyBytes = 4 << 10
+)
+
+// errResponseTooLarge is returned by limitedReader once the limit is exceeded
+var errResponseTooLarge = errors.New("response too large")
+
+var maxResponseBytes int64 = DefaultMaxResponseBytes
+
+// ConfigureMaxResponseSize sets the largest GitLab API response body that will be decoded
+func ConfigureMaxResponseSize(bytes int64) {
+	if bytes <= 0 {
+		bytes = DefaultMaxResponseBytes
+	}
+	maxResponseBytes = bytes
+	log.Printf("Limiting GitLab API responses to %d bytes", bytes)
+}
+
+// limitedReader reads at most remaining bytes and fails instead of silently truncating,
+// so an oversized response can't be mistaken for malformed JSON
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	read      int64
+	exceeded  bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Check whether the body really continues past the limit
+		var probe [1]byte
+		if n, _ := l.r.Read(probe[:]); n > 0 {
+			l.exceeded = true
+			return 0, errResponseTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	l.read += int64(n)
+	return n, err
+}
@@ -0,0 +1,64 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"gitlab-status/models"
+)
+
+// excludeMergeRequestPipelines leaves merge request pipelines out of the project pipeline calls
+var excludeMergeRequestPipelines bool
+
+// SetExcludeMergeRequestPipelines sets whether detached and merged results pipelines are left out when
+// fetching a project's pipelines, so they don't stand in for the status of its branches
+func SetExcludeMergeRequestPipelines(exclude bool) {
+	excludeMergeRequestPipelines = exclude
+	if exclude {
+		log.Printf("Excluding merge request pipelines from pipeline statuses")
+	}
+}
+
+// ExcludesMergeRequestPipelines reports whether merge request pipelines are left out of the project pipeline calls
+func ExcludesMergeRequestPipelines() bool {
+	return excludeMergeRequestPipelines
+}
+
+// pipelinePageSize returns how many pipelines to request for count results. When merge request
+// pipelines are excluded more are requested, since they are only filtered out afterwards.
+func pipelinePageSize(count int) int {
+	if !excludeMergeRequestPipelines {
+		return count
+	}
+	return min(max(count*3, 20), 100)
+}
+
+// filterPipelines drops merge request pipelines when they are excluded and keeps at most count pipelines
+func filterPipelines(pipelines []models.Pipeline, count int) []models.Pipeline {
+	if excludeMergeRequestPipelines {
+		filtered := make([]models.Pipeline, 0, len(pipelines))
+		for _, pipeline := range pipelines {
+			if !pipeline.MergeRequest() {
+				filtered = append(filtered, pipeline)
+			}
+		}
+		pipelines = filtered
+	}
+	if len(pipelines) > count {
+		pipelines = pipelines[:count]
+	}
+	return pipelines
+}
+
+// FetchMergeRequestPipelines gets the pipelines of a merge request, newest first.
+func FetchMergeRequestPipelines(ctx context.Context, gitlabURL, projectID string, mergeRequestIID int, token string) ([]models.Pipeline, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/merge_requests/%d/pipelines?per_page=100", gitlabURL, projectID, mergeRequestIID)
+
+	pipelines, err := getJSON[[]models.Pipeline](ctx, apiURL, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return pipelines, nil
+}
@@ -0,0 +1,33 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+
+	"gitlab-status/models"
+)
+
+// FetchCurrentIterations gets the current iterations of a group and its ancestor groups. Iterations
+// need GitLab Premium; other instances answer with an error.
+func FetchCurrentIterations(ctx context.Context, gitlabURL, groupID, token string) ([]models.Iteration, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/groups/%s/iterations?state=current&include_ancestors=true&per_page=100", gitlabURL, groupID)
+
+	iterations, err := getJSON[[]models.Iteration](ctx, apiURL, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return iterations, nil
+}
+
+// FetchIterationIssues gets the open issues of a project in an iteration, with their epics where available
+func FetchIterationIssues(ctx context.Context, gitlabURL, projectID string, iterationID int, token string) ([]models.Issue, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/issues?state=opened&iteration_id=%d&per_page=100", gitlabURL, projectID, iterationID)
+
+	issues, err := getJSON[[]models.Issue](ctx, apiURL, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return issues, nil
+}
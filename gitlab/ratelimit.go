@@ -0,0 +1,104 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRateLimitRetries is how many times a rate-limited request is retried before giving up
+	maxRateLimitRetries = 5
+	// defaultRateLimitWait is used when GitLab returns 429 without any reset hint
+	defaultRateLimitWait = 60 * time.Second
+	// maxRateLimitWait caps a single rate limit sleep
+	maxRateLimitWait = 5 * time.Minute
+)
+
+// RateLimitStatus holds the most recent rate limit information reported by GitLab
+type RateLimitStatus struct {
+	Limit     int       // RateLimit-Limit header, 0 if unknown
+	Remaining int       // RateLimit-Remaining header, -1 if unknown
+	ResetAt   time.Time // RateLimit-Reset header
+	UpdatedAt time.Time // When the information was last updated
+	Throttled int       // Number of 429 responses seen since startup
+}
+
+var (
+	rateLimitMu     sync.Mutex
+	rateLimitStatus = RateLimitStatus{Remaining: -1}
+)
+
+// GetRateLimitStatus returns the last known rate limit quota of the GitLab token
+func GetRateLimitStatus() RateLimitStatus {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	return rateLimitStatus
+}
+
+// Known reports whether GitLab has sent any rate limit headers yet
+func (s RateLimitStatus) Known() bool {
+	return !s.UpdatedAt.IsZero() && s.Remaining >= 0
+}
+
+// String formats the quota for log output
+func (s RateLimitStatus) String() string {
+	if !s.Known() {
+		return "rate limit quota unknown"
+	}
+	return fmt.Sprintf("%d/%d requests remaining, resets at %s (throttled %d times)",
+		s.Remaining, s.Limit, s.ResetAt.Format("15:04:05"), s.Throttled)
+}
+
+// recordRateLimitHeaders stores the RateLimit-* headers of a GitLab response
+func recordRateLimitHeaders(resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+
+	rateLimitStatus.Remaining = remaining
+	if limit, err := strconv.Atoi(resp.Header.Get("RateLimit-Limit")); err == nil {
+		rateLimitStatus.Limit = limit
+	}
+	if reset, err := strconv.ParseInt(resp.Header.Get("RateLimit-Reset"), 10, 64); err == nil {
+		rateLimitStatus.ResetAt = time.Unix(reset, 0)
+	}
+	rateLimitStatus.UpdatedAt = time.Now()
+}
+
+// recordThrottled counts a 429 response
+func recordThrottled() {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	rateLimitStatus.Throttled++
+}
+
+// rateLimitWait determines how long to wait before retrying a rate-limited request.
+// Retry-After (seconds or HTTP date) takes precedence over RateLimit-Reset.
+func rateLimitWait(resp *http.Response) time.Duration {
+	wait := defaultRateLimitWait
+
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			wait = time.Duration(seconds) * time.Second
+		} else if date, err := http.ParseTime(retryAfter); err == nil {
+			wait = time.Until(date)
+		}
+	} else if reset, err := strconv.ParseInt(resp.Header.Get("RateLimit-Reset"), 10, 64); err == nil {
+		wait = time.Until(time.Unix(reset, 0))
+	}
+
+	if wait < time.Second {
+		wait = time.Second
+	}
+	if wait > maxRateLimitWait {
+		wait = maxRateLimitWait
+	}
+	return wait
+}
@@ -0,0 +1,193 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"gitlab-status/models"
+)
+
+// MaxCountedCommits is where CountCommitsBetween stops counting, so long-unreleased projects don't page through their whole history
+const MaxCountedCommits = 1000
+
+// commitResponse is the part of a commit needed to count commits
+type commitResponse struct {
+	ID string `json:"id"`
+}
+
+// FetchEnvironments gets the available environments of a project.
+func FetchEnvironments(ctx context.Context, gitlabURL, projectID, token string) ([]models.Environment, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/environments?states=available&per_page=100", gitlabURL, projectID)
+
+	environments, err := getJSON[[]models.Environment](ctx, apiURL, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return environments, nil
+}
+
+// FetchDeployments gets the most recently updated deployments of a project, newest first. An empty environment
+// or status returns deployments to every environment or with any status; the last successful deployment
+// to an environment is what it currently runs.
+func FetchDeployments(ctx context.Context, gitlabURL, projectID, environment, status, token string, count int) ([]models.Deployment, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/deployments?order_by=updated_at&sort=desc&per_page=%d", gitlabURL, projectID, count)
+	if environment != "" {
+		apiURL += "&environment=" + url.QueryEscape(environment)
+	}
+	if status != "" {
+		apiURL += "&status=" + url.QueryEscape(status)
+	}
+
+	deployments, err := getJSON[[]models.Deployment](ctx, apiURL, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return deployments, nil
+}
+
+// agentTokenResponse is the part of a cluster agent token that tells when the agent last connected
+type agentTokenResponse struct {
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// FetchRunners gets the runners available to a project, or every runner of the instance when projectID
+// is empty, which needs an administrator token.
+func FetchRunners(ctx context.Context, gitlabURL, projectID, token string) ([]models.Runner, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/runners/all?per_page=100", gitlabURL)
+	if projectID != "" {
+		apiURL = fmt.Sprintf("%s/api/v4/projects/%s/runners?per_page=100", gitlabURL, projectID)
+	}
+
+	runners, err := getJSON[[]models.Runner](ctx, apiURL, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return runners, nil
+}
+
+// FetchClusterAgents gets the agents for Kubernetes registered in a project with the time each last contacted
+// GitLab, taken from its most recently used active token. Instances without the cluster agents API
+// (before GitLab 15.0) report no agents.
+func FetchClusterAgents(ctx context.Context, gitlabURL, projectID, token string) ([]models.ClusterAgent, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/cluster_agents?per_page=100", gitlabURL, projectID)
+
+	agents, err := getJSON[[]models.ClusterAgent](ctx, apiURL, token)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, agent := range agents {
+		tokensURL := fmt.Sprintf("%s/api/v4/projects/%s/cluster_agents/%d/tokens?per_page=100", gitlabURL, projectID, agent.ID)
+		tokens, err := getJSON[[]agentTokenResponse](ctx, tokensURL, token)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tokens {
+			if t.LastUsedAt != nil && t.LastUsedAt.After(agents[i].LastContact) {
+				agents[i].LastContact = *t.LastUsedAt
+			}
+		}
+	}
+	return agents, nil
+}
+
+// FetchLatestTag gets the most recently updated tag of a project, or nil when it has none.
+func FetchLatestTag(ctx context.Context, gitlabURL, projectID, token string) (*models.Tag, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/repository/tags?order_by=updated&sort=desc&per_page=1", gitlabURL, projectID)
+
+	tags, err := getJSON[[]models.Tag](ctx, apiURL, token)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	return &tags[0], nil
+}
+
+// CountCommitsBetween counts the commits reachable from to but not from from, up to MaxCountedCommits.
+func CountCommitsBetween(ctx context.Context, gitlabURL, projectID, from, to, token string) (int, error) {
+	count := 0
+	for page := 1; count < MaxCountedCommits; page++ {
+		apiURL := fmt.Sprintf("%s/api/v4/projects/%s/repository/commits?ref_name=%s&per_page=100&page=%d",
+			gitlabURL, projectID, url.QueryEscape(from+".."+to), page)
+
+		commits, err := getJSON[[]commitResponse](ctx, apiURL, token)
+		if err != nil {
+			return 0, err
+		}
+		count += len(commits)
+		if len(commits) < 100 {
+			break
+		}
+	}
+	return min(count, MaxCountedCommits), nil
+}
+
+// FetchOpenMergeRequests gets the open merge requests of a project targeting a branch, limited to those
+// with all of the comma-separated labels unless labels is empty.
+func FetchOpenMergeRequests(ctx context.Context, gitlabURL, projectID, targetBranch, labels, token string) ([]models.MergeRequest, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/merge_requests?state=opened&target_branch=%s&per_page=100",
+		gitlabURL, projectID, url.QueryEscape(targetBranch))
+	if labels != "" {
+		apiURL += "&labels=" + url.QueryEscape(labels)
+	}
+
+	mergeRequests, err := getJSON[[]models.MergeRequest](ctx, apiURL, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeRequests, nil
+}
+
+// FetchLatestRelease gets the most recently released release of a project, or nil when it has none.
+func FetchLatestRelease(ctx context.Context, gitlabURL, projectID, token string) (*models.Release, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/releases?order_by=released_at&sort=desc&per_page=1", gitlabURL, projectID)
+
+	releases, err := getJSON[[]models.Release](ctx, apiURL, token)
+	if err != nil {
+		return nil, err
+	}
+	if len(releases) == 0 {
+		return nil, nil
+	}
+	return &releases[0], nil
+}
+
+// maxReleasePages limits how many pages of releases FetchReleasesSince reads
+const maxReleasePages = 10
+
+// FetchReleasesSince gets the releases of a project released at or after since, newest first,
+// including the release notes rendered to HTML by GitLab.
+func FetchReleasesSince(ctx context.Context, gitlabURL, projectID string, since time.Time, token string) ([]models.Release, error) {
+	var releases []models.Release
+	for page := 1; page <= maxReleasePages; page++ {
+		apiURL := fmt.Sprintf("%s/api/v4/projects/%s/releases?order_by=released_at&sort=desc&include_html_description=true&per_page=100&page=%d",
+			gitlabURL, projectID, page)
+
+		pageReleases, err := getJSON[[]models.Release](ctx, apiURL, token)
+		if err != nil {
+			return nil, err
+		}
+		for _, release := range pageReleases {
+			if release.ReleasedAt.Before(since) {
+				return releases, nil
+			}
+			releases = append(releases, release)
+		}
+		if len(pageReleases) < 100 {
+			break
+		}
+	}
+	return releases, nil
+}
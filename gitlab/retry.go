@@ -0,0 +1,63 @@
+package gitlab
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+)
+
+const (
+	// DefaultMaxAttempts is the default number of attempts for a failing GitLab API request
+	DefaultMaxAttempts = 3
+	// DefaultRetryBackoff is the default base delay between retries
+	DefaultRetryBackoff = 500 * time.Millisecond
+	// maxRetryBackoff caps the delay between two attempts
+	maxRetryBackoff = 30 * time.Second
+)
+
+var (
+	maxAttempts  = DefaultMaxAttempts
+	retryBackoff = DefaultRetryBackoff
+)
+
+// ConfigureRetries sets how often transient GitLab API failures (network errors
+// and 5xx responses) are retried and the base delay of the exponential backoff
+func ConfigureRetries(attempts int, backoff time.Duration) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	maxAttempts = attempts
+	retryBackoff = backoff
+	log.Printf("Using GitLab API retry policy: %d attempts, %v base backoff", maxAttempts, retryBackoff)
+}
+
+// isRetryableStatus reports whether a response status is a transient server-side failure
+func isRetryableStatus(statusCode int) bool {
+	return statusCode >= 500 && statusCode <= 599
+}
+
+// retryDelay returns the exponential backoff delay with equal jitter for the given retry (starting at 0)
+func retryDelay(retry int) time.Duration {
+	delay := retryBackoff << uint(retry)
+	if delay <= 0 || delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	// Equal jitter: wait at least half the backoff, so retries still back off, plus a random part of the other half
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// sleepContext waits for d or until ctx is canceled, whichever comes first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return contextError(ctx)
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,197 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab-status/models"
+)
+
+// schemaCheckInterval is how often the responses of one endpoint are compared with the models they
+// are decoded into; decoding in between skips the extra parsing
+const schemaCheckInterval = 10 * time.Minute
+
+// numericSegment matches the IDs in API paths
+var numericSegment = regexp.MustCompile(`^\d+$`)
+
+// namedSegments are path segments followed by a name or URL-encoded path instead of a numeric ID
+var namedSegments = map[string]bool{
+	"projects": true,
+	"groups":   true,
+	"branches": true,
+	"tags":     true,
+}
+
+var (
+	schemaMu        sync.Mutex
+	schemaCheckedAt = make(map[string]time.Time)
+	schemaUnknown   = make(map[string]bool) // Endpoints whose unused fields have been logged
+	schemaDrifts    = make(map[string]models.SchemaDrift)
+)
+
+// endpointOf returns the API path of a URL with IDs and names replaced by placeholders,
+// e.g. /projects/:id/pipelines/:id/jobs
+func endpointOf(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	path := parsed.EscapedPath()
+	if i := strings.Index(path, "/api/v4/"); i >= 0 {
+		path = path[i+len("/api/v4"):]
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if numericSegment.MatchString(segment) || (i > 0 && namedSegments[segments[i-1]] && segment != "") {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// decodeJSON decodes a GitLab API response into result. Every schemaCheckInterval per endpoint the
+// response is also compared with the fields of result, so changed responses show up as warnings
+// instead of silently decoding into zero values.
+func decodeJSON(rawURL string, body io.Reader, result interface{}) error {
+	endpoint := endpointOf(rawURL)
+	schemaMu.Lock()
+	due := time.Since(schemaCheckedAt[endpoint]) >= schemaCheckInterval
+	if due {
+		schemaCheckedAt[endpoint] = time.Now()
+	}
+	schemaMu.Unlock()
+	if !due {
+		return json.NewDecoder(body).Decode(result)
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return err
+	}
+	checkSchema(endpoint, raw, reflect.TypeOf(result))
+	return nil
+}
+
+// modelFields returns the JSON fields of a struct type and whether each is required. Fields tagged
+// gitlab:"optional" are only returned by some endpoints or versions and aren't required.
+func modelFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Tag.Get("gitlab") != "optional"
+	}
+	return fields
+}
+
+// checkSchema compares the top-level fields of the objects in a response with the struct they are
+// decoded into. Required fields that none of the objects have are recorded as drift, fields the
+// struct doesn't use are logged once per endpoint.
+func checkSchema(endpoint string, raw json.RawMessage, t reflect.Type) {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &objects); err != nil {
+		var object map[string]json.RawMessage
+		if json.Unmarshal(raw, &object) != nil {
+			return
+		}
+		objects = append(objects, object)
+	}
+	if len(objects) == 0 {
+		return
+	}
+
+	fields := modelFields(t)
+	var missing []string
+	for name, required := range fields {
+		if !required {
+			continue
+		}
+		found := false
+		for _, object := range objects {
+			if _, ok := object[name]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	unknown := make(map[string]bool)
+	for _, object := range objects {
+		for name := range object {
+			if _, ok := fields[name]; !ok {
+				unknown[name] = true
+			}
+		}
+	}
+
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+	if len(unknown) > 0 && !schemaUnknown[endpoint] {
+		schemaUnknown[endpoint] = true
+		names := make([]string, 0, len(unknown))
+		for name := range unknown {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		log.Printf("GitLab API %s returns fields that %s doesn't use: %s", endpoint, t.Name(), strings.Join(names, ", "))
+	}
+	previous, drifted := schemaDrifts[endpoint]
+	if len(missing) == 0 {
+		if drifted {
+			log.Printf("GitLab API %s returns all fields of %s again", endpoint, t.Name())
+			delete(schemaDrifts, endpoint)
+		}
+		return
+	}
+	if drifted && strings.Join(previous.MissingFields, ",") == strings.Join(missing, ",") {
+		return
+	}
+	drift := models.SchemaDrift{Endpoint: endpoint, Model: t.Name(), MissingFields: missing, DetectedAt: time.Now()}
+	if info := CurrentInstance(); info != nil {
+		drift.GitLabVersion = info.Version
+	}
+	schemaDrifts[endpoint] = drift
+	log.Printf("WARNING: GitLab API %s doesn't return fields of %s, they decode as zero values: %s", endpoint, t.Name(), strings.Join(missing, ", "))
+}
+
+// SchemaDrifts returns the endpoints whose responses lack fields the models expect, by endpoint
+func SchemaDrifts() []models.SchemaDrift {
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+	drifts := make([]models.SchemaDrift, 0, len(schemaDrifts))
+	for _, drift := range schemaDrifts {
+		drifts = append(drifts, drift)
+	}
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].Endpoint < drifts[j].Endpoint })
+	return drifts
+}
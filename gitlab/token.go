@@ -0,0 +1,149 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"gitlab-status/models"
+)
+
+// requiredScopes are the token scopes that grant read access to the API, any one is enough
+var requiredScopes = []string{"read_api", "api"}
+
+// currentToken is the last validation of the configured token, nil until it was checked
+var currentToken atomic.Pointer[models.TokenValidation]
+
+// DefaultTokenExpiryWarning is how long before the token expires warnings are shown
+const DefaultTokenExpiryWarning = 14 * 24 * time.Hour
+
+// tokenExpiryWarning is how long before the token expires warnings are shown
+var tokenExpiryWarning = DefaultTokenExpiryWarning
+
+// ConfigureTokenExpiryWarning sets how long before the token expires warnings are shown
+func ConfigureTokenExpiryWarning(d time.Duration) {
+	tokenExpiryWarning = d
+}
+
+// userResponse is the part of /api/v4/user used to validate a token
+type userResponse struct {
+	Username string `json:"username"`
+}
+
+// tokenResponse is the part of /api/v4/personal_access_tokens/self used to validate a token
+type tokenResponse struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	Active    bool     `json:"active"`
+	Revoked   bool     `json:"revoked"`
+	ExpiresAt string   `json:"expires_at"` // Date without time, e.g. "2024-12-31"
+}
+
+// ValidateToken checks that the token is accepted by GitLab and has a scope that allows reading
+// the API. Problems with the token are reported in the result; an error means GitLab could not
+// be asked. Instances older than 15.5 can't report token details, so only the user is checked.
+func ValidateToken(ctx context.Context, gitlabURL, token string) (*models.TokenValidation, error) {
+	validation := &models.TokenValidation{CheckedAt: time.Now()}
+
+	user, err := getJSON[userResponse](ctx, gitlabURL+"/api/v4/user", token)
+	if errors.Is(err, ErrUnauthorized) {
+		validation.Problems = append(validation.Problems,
+			"GitLab rejected the token. It is invalid, expired or revoked; create a new personal access token with the read_api scope and update GITLAB_TOKEN.")
+		return validation, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	validation.Username = user.Username
+
+	details, err := getJSON[tokenResponse](ctx, gitlabURL+"/api/v4/personal_access_tokens/self", token)
+	if errors.Is(err, ErrNotFound) {
+		return validation, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	validation.TokenName = details.Name
+	validation.Scopes = details.Scopes
+	if details.ExpiresAt != "" {
+		if expiresAt, err := time.Parse("2006-01-02", details.ExpiresAt); err == nil {
+			validation.ExpiresAt = &expiresAt
+		}
+	}
+
+	if details.Revoked || !details.Active {
+		validation.Problems = append(validation.Problems,
+			fmt.Sprintf("Token %q is no longer active; create a new personal access token and update GITLAB_TOKEN.", details.Name))
+	}
+	if !hasAnyScope(details.Scopes, requiredScopes) {
+		validation.Problems = append(validation.Problems,
+			fmt.Sprintf("Token %q has scopes %v but needs read_api; create a token with the read_api scope and update GITLAB_TOKEN.", details.Name, details.Scopes))
+	}
+	return validation, nil
+}
+
+// hasAnyScope reports whether scopes contains one of wanted
+func hasAnyScope(scopes, wanted []string) bool {
+	for _, scope := range scopes {
+		for _, w := range wanted {
+			if scope == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetTokenValidation records the latest validation of the configured token and logs its problems
+// the first time and whenever they change
+func SetTokenValidation(validation *models.TokenValidation) {
+	previous := currentToken.Swap(validation)
+	if warning := expiryWarning(validation); warning != "" && (previous == nil || warning != expiryWarning(previous)) {
+		log.Printf("WARNING: %s", warning)
+	}
+	if previous != nil && fmt.Sprint(previous.Problems) == fmt.Sprint(validation.Problems) {
+		return
+	}
+	if validation.Valid() {
+		log.Printf("GitLab token is valid (user %s, scopes %v)", validation.Username, validation.Scopes)
+		return
+	}
+	for _, problem := range validation.Problems {
+		log.Printf("WARNING: %s", problem)
+	}
+}
+
+// CurrentTokenValidation returns the latest validation of the configured token, or nil if it wasn't checked
+func CurrentTokenValidation() *models.TokenValidation {
+	return currentToken.Load()
+}
+
+// TokenExpiryWarning returns a warning when the configured token expires soon, or "" otherwise
+func TokenExpiryWarning() string {
+	validation := currentToken.Load()
+	if validation == nil {
+		return ""
+	}
+	return expiryWarning(validation)
+}
+
+// expiryWarning describes when the validated token expires if that is within the warning period
+func expiryWarning(validation *models.TokenValidation) string {
+	if validation.ExpiresAt == nil || !validation.Valid() {
+		return ""
+	}
+	remaining := time.Until(*validation.ExpiresAt)
+	if remaining > tokenExpiryWarning {
+		return ""
+	}
+	days := int(remaining.Hours() / 24)
+	when := fmt.Sprintf("in %d days", days)
+	if days < 1 {
+		when = "today"
+	}
+	return fmt.Sprintf("The GitLab API token expires on %s (%s). Rotate it and update GITLAB_TOKEN so the dashboards don't go stale.",
+		validation.ExpiresAt.Format("2006-01-02"), when)
+}
@@ -0,0 +1,54 @@
+package gitlab
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// traceControlSequences matches the collapsible section markers and terminal escape sequences in job logs
+var traceControlSequences = regexp.MustCompile(`section_(?:start|end):\d+:[^\r\n]*?\r|\x1b\[[0-9;]*[A-Za-z]`)
+
+// cleanTraceLine removes control sequences from a job log line and keeps only the text written after
+// the last carriage return, the way a terminal shows progress output
+func cleanTraceLine(line string) string {
+	line = traceControlSequences.ReplaceAllString(strings.TrimRight(line, "\r\n"), "")
+	if i := strings.LastIndex(line, "\r"); i >= 0 {
+		line = line[i+1:]
+	}
+	return line
+}
+
+// FetchJobTrace gets the last lines of a job's log, without the terminal escape sequences GitLab stores with it.
+// The log is streamed so only the requested lines are kept in memory.
+func FetchJobTrace(ctx context.Context, gitlabURL, projectID string, jobID int, token string, lines int) (string, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/jobs/%d/trace", gitlabURL, projectID, jobID)
+
+	tail := make([]string, 0, lines)
+	_, err := sendRequest(ctx, "GET", apiURL, token, "", func(body io.Reader) error {
+		reader := bufio.NewReader(body)
+		for {
+			line, err := reader.ReadString('\n')
+			if line != "" {
+				if len(tail) == lines {
+					tail = tail[1:]
+				}
+				tail = append(tail, cleanTraceLine(line))
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(tail, "\n"), nil
+}
@@ -0,0 +1,105 @@
+package gitlab
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// TransportOptions configures how the GitLab API is reached
+type TransportOptions struct {
+	// ProxyURL overrides HTTP_PROXY/HTTPS_PROXY/NO_PROXY from the environment
+	// (http://, https://, socks5:// or socks5h://, credentials as user:password@host)
+	ProxyURL string
+	// CACertFile is a PEM bundle trusted in addition to the system roots
+	CACertFile string
+	// ClientCertFile and ClientKeyFile are a PEM certificate and key presented to
+	// mTLS-terminating gateways in front of GitLab; both must be set together
+	ClientCertFile string
+	ClientKeyFile  string
+	// InsecureSkipVerify disables TLS certificate verification
+	InsecureSkipVerify bool
+	// MinTLSVersion is the lowest accepted TLS version: "1.0", "1.1", "1.2" or "1.3"
+	MinTLSVersion string
+	// RecordDir saves every GitLab API response as a fixture in this directory
+	RecordDir string
+	// ReplayDir answers GitLab API requests from the fixtures in this directory without contacting GitLab
+	ReplayDir string
+}
+
+// tlsVersions maps configuration values to TLS versions
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTransport builds the HTTP transport for GitLab API requests
+func newTransport(opts TransportOptions) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if opts.ProxyURL != "" {
+		proxy, err := url.Parse(opts.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GitLab proxy URL: %v", err)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported GitLab proxy scheme %q", proxy.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+		log.Printf("Using proxy %s for GitLab API requests", proxy.Redacted())
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.MinTLSVersion != "" {
+		version, ok := tlsVersions[opts.MinTLSVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported minimum TLS version %q", opts.MinTLSVersion)
+		}
+		tlsConfig.MinVersion = version
+		log.Printf("Requiring TLS %s or newer for GitLab API requests", opts.MinTLSVersion)
+	}
+
+	if opts.CACertFile != "" {
+		pem, err := os.ReadFile(opts.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read GitLab CA certificate file: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+		log.Printf("Trusting CA certificates from %s for GitLab API requests", opts.CACertFile)
+	}
+
+	if opts.ClientCertFile != "" || opts.ClientKeyFile != "" {
+		if opts.ClientCertFile == "" || opts.ClientKeyFile == "" {
+			return nil, fmt.Errorf("both a client certificate and key file are required for GitLab mTLS")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load GitLab client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		log.Printf("Presenting client certificate %s for GitLab API requests", opts.ClientCertFile)
+	}
+
+	if opts.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+		log.Printf("WARNING: TLS certificate verification is disabled for GitLab API requests")
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
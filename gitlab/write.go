@@ -0,0 +1,54 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// gitLabMessage is the error body GitLab returns for rejected writes
+type gitLabMessage struct {
+	Message interface{} `json:"message"`
+	Error   string      `json:"error"`
+}
+
+// postJSON creates a resource with payload, see sendJSON
+func postJSON[T any](ctx context.Context, url, token string, payload interface{}) (T, error) {
+	return sendJSON[T](ctx, http.MethodPost, url, token, payload)
+}
+
+// putJSON updates a resource with payload, see sendJSON
+func putJSON[T any](ctx context.Context, url, token string, payload interface{}) (T, error) {
+	return sendJSON[T](ctx, http.MethodPut, url, token, payload)
+}
+
+// sendJSON sends payload as JSON and decodes the JSON response. Unlike reads, writes are sent once
+// and never retried, since a retried request that reached GitLab would repeat its effect.
+func sendJSON[T any](ctx context.Context, method, url, token string, payload interface{}) (T, error) {
+	var result T
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return result, err
+	}
+	_, err = send(ctx, apiRequest{method: method, url: url, token: token, body: body, write: true}, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&result)
+	})
+	return result, err
+}
+
+// gitLabErrorMessage returns the reason GitLab gave in the body of a rejected write, if any
+func gitLabErrorMessage(body []byte) string {
+	var message gitLabMessage
+	if json.Unmarshal(body, &message) != nil {
+		return ""
+	}
+	switch {
+	case message.Message != nil:
+		return fmt.Sprint(message.Message)
+	case message.Error != "":
+		return message.Error
+	}
+	return ""
+}
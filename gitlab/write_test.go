@@ -0,0 +1,43 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSendJSONSendsFailedWritesOnce(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", r.Header.Get("Content-Type"))
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"message":"upstream down"}`))
+	}))
+	defer server.Close()
+
+	if err := Initialize(10*time.Second, TransportOptions{}); err != nil {
+		t.Fatalf("initializing GitLab client: %v", err)
+	}
+	t.Cleanup(breaker.recordSuccess)
+
+	_, err := postJSON[map[string]interface{}](context.Background(), server.URL+"/api/v4/projects/1/pipeline", "secret", map[string]string{"ref": "main"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || apiErr.Message != "upstream down" {
+		t.Fatalf("postJSON error = %v, want 502 with GitLab's message", err)
+	}
+	if hits != 1 {
+		t.Errorf("write sent %d times, want once", hits)
+	}
+	breaker.mu.Lock()
+	failures := breaker.failures
+	breaker.mu.Unlock()
+	if failures != 1 {
+		t.Errorf("circuit breaker counted %d failures, want 1", failures)
+	}
+}
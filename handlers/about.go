@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AppInfo identifies the running deployment of the application
+type AppInfo struct {
+	Version  string `json:"version"`
+	Instance string `json:"instance"`
+}
+
+// VersionHandler returns the application version and instance, so GitLab admins can match the
+// User-Agent of API calls to a deployment. It needs no login.
+func VersionHandler(info AppInfo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, info)
+	}
+}
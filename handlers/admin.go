@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+	"gitlab-status/templates"
+)
+
+// incidentTimeLayout is the format of datetime-local inputs
+const incidentTimeLayout = "2006-01-02T15:04"
+
+// adminUsernames lists the users allowed to open the admin page
+var adminUsernames = map[string]bool{}
+
+// SetAdminUsernames configures the admin users from a comma-separated list
+func SetAdminUsernames(names string) {
+	adminUsernames = map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			adminUsernames[name] = true
+		}
+	}
+}
+
+// currentAdmin returns the logged-in username and whether that user is an admin
+func currentAdmin(c echo.Context, store sessions.Store) (string, bool) {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	username, _ := session.Values["username"].(string)
+	return username, username != "" && adminUsernames[username]
+}
+
+// AdminPageHandler shows the detected GitLab instance, the state of the API client and incidents
+func AdminPageHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	username, ok := currentAdmin(c, store)
+	if !ok {
+		return c.String(http.StatusForbidden, "Admin access required")
+	}
+	return renderAdminPage(c, username, client, "")
+}
+
+// renderAdminPage renders the admin page with an optional error message
+func renderAdminPage(c echo.Context, username string, client gitlab.Client, apiError string) error {
+	deepLinks, err := db.GetDeepLinkHits(20)
+	if err != nil {
+		log.Printf("Error loading deep link hits: %v", err)
+	}
+	incidents, err := db.GetRecentIncidents(20)
+	if err != nil {
+		log.Printf("Error loading incidents: %v", err)
+	}
+	jobRuns, err := db.GetRecentJobRuns(20)
+	if err != nil {
+		log.Printf("Error loading job runs: %v", err)
+	}
+	auditEntries, err := db.GetRecentAuditEntries(20)
+	if err != nil {
+		log.Printf("Error loading audit log: %v", err)
+	}
+	runnersError := ""
+	runners, runnersFetchedAt, err := runnerStatuses(gitlab.WithFeature(c.Request().Context(), gitlab.FeatureOther), client, "")
+	if err != nil {
+		log.Printf("Error fetching runners: %v", err)
+		runnersError = describeGitLabError(err)
+	}
+	projectPaths := make(map[int]string, len(deepLinks)+len(auditEntries))
+	for _, hit := range deepLinks {
+		if project, err := db.GetCachedProject(hit.ProjectID); err == nil {
+			projectPaths[hit.ProjectID] = project.PathWithNamespace
+		}
+	}
+	for _, entry := range auditEntries {
+		if project, err := db.GetCachedProject(entry.ProjectID); err == nil {
+			projectPaths[entry.ProjectID] = project.PathWithNamespace
+		}
+	}
+
+	return templates.Admin(
+		username,
+		csrfToken(c),
+		client.URL(),
+		gitlab.CurrentInstance(),
+		gitlab.CircuitOpen(),
+		gitlab.GetRateLimitStatus().String(),
+		gitlab.SchemaDrifts(),
+		deepLinks,
+		projectPaths,
+		incidents,
+		runners,
+		runnersFetchedAt,
+		runnersError,
+		currentHistoryImport(),
+		jobRuns,
+		auditEntries,
+		apiError,
+	).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// DeclareIncidentHandler declares an incident affecting the given project and group paths
+func DeclareIncidentHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	username, ok := currentAdmin(c, store)
+	if !ok {
+		return c.String(http.StatusForbidden, "Admin access required")
+	}
+
+	incident := models.Incident{
+		Title:         strings.TrimSpace(c.FormValue("title")),
+		AffectedPaths: strings.TrimSpace(c.FormValue("affected_paths")),
+		StartedAt:     time.Now(),
+		DeclaredBy:    username,
+	}
+	if incident.Title == "" {
+		return renderAdminPage(c, username, client, "An incident needs a title")
+	}
+	if len(incident.Paths()) == 0 {
+		return renderAdminPage(c, username, client, "List at least one affected project or group path")
+	}
+	if startedAt := c.FormValue("started_at"); startedAt != "" {
+		parsed, err := time.ParseInLocation(incidentTimeLayout, startedAt, time.Local)
+		if err != nil {
+			return renderAdminPage(c, username, client, "Invalid start time")
+		}
+		incident.StartedAt = parsed
+	}
+
+	if err := db.CreateIncident(&incident); err != nil {
+		log.Printf("Error declaring incident: %v", err)
+		return renderAdminPage(c, username, client, "Failed to declare incident")
+	}
+	log.Printf("Incident %d %q declared by %s", incident.ID, incident.Title, username)
+	return c.Redirect(http.StatusSeeOther, "/admin")
+}
+
+// ResolveIncidentHandler resolves an active incident
+func ResolveIncidentHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	username, ok := currentAdmin(c, store)
+	if !ok {
+		return c.String(http.StatusForbidden, "Admin access required")
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Incident not found")
+	}
+	if err := db.ResolveIncident(id, username); err != nil {
+		log.Printf("Error resolving incident: %v", err)
+		return renderAdminPage(c, username, client, "Failed to resolve incident")
+	}
+	log.Printf("Incident %d resolved by %s", id, username)
+	return c.Redirect(http.StatusSeeOther, "/admin")
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+// agentsTTL is how long the agents of a project and their last contact are reused
+const agentsTTL = 2 * time.Minute
+
+// agentsCache holds the agents for Kubernetes by project ID
+var agentsCache = newTTLCache[int, []models.ClusterAgent](detailCacheSize)
+
+// clusterAgents returns the agents for Kubernetes registered in a project, or nil when it's disabled,
+// the project has none or they can't be fetched
+func clusterAgents(ctx context.Context, client gitlab.Client, projectID int) []models.ClusterAgent {
+	if !statusDetails[detailAgents] {
+		return nil
+	}
+	if agents, ok, err := agentsCache.get(projectID); ok {
+		if err != nil {
+			return nil
+		}
+		return agents
+	}
+
+	agents, err := client.FetchClusterAgents(ctx, strconv.Itoa(projectID))
+	agentsCache.set(projectID, agents, err, agentsTTL)
+	if err != nil {
+		log.Printf("Error fetching agents for Kubernetes of project %d: %v", projectID, err)
+		return nil
+	}
+	return agents
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/models"
+)
+
+const (
+	// defaultAlertStaleDays is how long a tracked project may go without a successful pipeline
+	// before the generated rules alert, unless ?stale_days= says otherwise
+	defaultAlertStaleDays = 7
+	// alertFailingFor is how long a pipeline has to stay failed before the generated rules alert,
+	// long enough for a fix or retry to land
+	alertFailingFor = "30m"
+)
+
+// pipelineMetric is the latest recorded status of one tracked project and ref
+type pipelineMetric struct {
+	project       string
+	ref           string // Tracked ref, empty for any
+	failed        bool
+	lastSuccessAt time.Time
+}
+
+var (
+	// pipelineMetricsEnabled exports the per-project pipeline gauges on /metrics. They name the
+	// tracked projects, so they are off unless enabled and only shown to authorized scrapes.
+	pipelineMetricsEnabled bool
+	// metricsToken is the bearer token that lets Prometheus scrape the pipeline gauges without a session
+	metricsToken string
+	// snapshotInterval is how often the status snapshots behind the pipeline metrics are taken
+	snapshotInterval time.Duration
+
+	pipelineMetricsMu sync.Mutex
+	pipelineMetrics   []pipelineMetric
+)
+
+// ConfigurePipelineMetrics sets whether the pipeline status of every tracked project is exported
+// on /metrics, updated with every status snapshot taken at interval (0 when snapshots are off).
+// The gauges are only shown to logged-in users and scrapes sending token as a bearer token.
+func ConfigurePipelineMetrics(enabled bool, interval time.Duration, token string) {
+	pipelineMetricsEnabled = enabled
+	snapshotInterval = interval
+	metricsToken = token
+	if !enabled {
+		return
+	}
+	if token == "" {
+		log.Println("Per-project pipeline metrics are enabled without METRICS_TOKEN, so only logged-in users see them on /metrics")
+	}
+	if interval <= 0 {
+		log.Println("Per-project pipeline metrics are enabled but status snapshots are not, so they stay empty")
+		return
+	}
+	log.Println("Exporting per-project pipeline metrics on /metrics")
+}
+
+// recordPipelineMetrics replaces the exported pipeline gauges with a new status snapshot
+func recordPipelineMetrics(snapshots []models.StatusSnapshot) {
+	if !pipelineMetricsEnabled {
+		return
+	}
+	seen := make(map[string]bool)
+	metrics := make([]pipelineMetric, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		// Users tracking the same project and ref share a series
+		key := snapshot.ProjectPath + "\x00" + snapshot.TrackedRef
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		metrics = append(metrics, pipelineMetric{
+			project:       snapshot.ProjectPath,
+			ref:           snapshot.TrackedRef,
+			failed:        snapshot.Status == "failed",
+			lastSuccessAt: snapshot.LastSuccessDate,
+		})
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].project != metrics[j].project {
+			return metrics[i].project < metrics[j].project
+		}
+		return metrics[i].ref < metrics[j].ref
+	})
+
+	pipelineMetricsMu.Lock()
+	pipelineMetrics = metrics
+	pipelineMetricsMu.Unlock()
+}
+
+// pipelineMetricsAuthorized reports whether a /metrics request may see the per-project pipeline
+// gauges: it sends the metrics token as a bearer token or comes from an admin. The series name the
+// projects every user tracks, so other users don't see them, whatever GitLab lets them read.
+func pipelineMetricsAuthorized(c echo.Context, store sessions.Store) bool {
+	if metricsToken != "" {
+		token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(metricsToken)) == 1 {
+			return true
+		}
+	}
+	_, admin := currentAdmin(c, store)
+	return admin
+}
+
+// writePipelineMetrics appends the per-project pipeline gauges in the Prometheus text format
+func writePipelineMetrics(b *strings.Builder) {
+	if !pipelineMetricsEnabled {
+		return
+	}
+	pipelineMetricsMu.Lock()
+	defer pipelineMetricsMu.Unlock()
+
+	metric := func(name, help string, value func(pipelineMetric) float64) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, m := range pipelineMetrics {
+			fmt.Fprintf(b, "%s{project=%q,ref=%q} %g\n", name, m.project, m.ref, value(m))
+		}
+	}
+	metric("gitlab_status_pipeline_failed", "1 if the latest pipeline of the tracked project failed, as of the last status snapshot.",
+		func(m pipelineMetric) float64 {
+			if m.failed {
+				return 1
+			}
+			return 0
+		})
+	metric("gitlab_status_pipeline_last_success_timestamp_seconds", "Unix time of the tracked project's last successful pipeline, 0 if it has none.",
+		func(m pipelineMetric) float64 {
+			if m.lastSuccessAt.IsZero() {
+				return 0
+			}
+			return float64(m.lastSuccessAt.Unix())
+		})
+}
+
+// AlertRulesHandler downloads Prometheus alerting rules for every project tracked by any user,
+// alerting when its latest pipeline keeps failing or it had no successful pipeline for a while
+func AlertRulesHandler(c echo.Context, store sessions.Store) error {
+	if _, ok := currentAdmin(c, store); !ok {
+		return c.String(http.StatusForbidden, "Admin access required")
+	}
+
+	staleDays := defaultAlertStaleDays
+	if days, err := strconv.Atoi(c.QueryParam("stale_days")); err == nil && days > 0 {
+		staleDays = days
+	}
+
+	selected, err := db.GetAllSelectedProjects()
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error fetching tracked projects")
+	}
+	cached, err := db.GetCachedProjects()
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error fetching cached projects")
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="gitlab-status-alerts.yml"`)
+	return c.Blob(http.StatusOK, "application/yaml; charset=utf-8", []byte(alertRules(selected, cached, staleDays, time.Now())))
+}
+
+// alertSeverity is the severity label of the alerts of a project of a criticality
+func alertSeverity(criticality string) string {
+	switch models.NormalizeCriticality(criticality) {
+	case models.CriticalityCritical:
+		return "critical"
+	case models.CriticalityLow:
+		return "info"
+	}
+	return "warning"
+}
+
+// alertRules writes a Prometheus rules file with a failure and a staleness rule per tracked
+// project and ref, plus one for the status snapshots that feed the pipeline metrics stopping.
+// Projects are named by their current path, as the snapshots behind the metrics are, and their
+// alerts are as severe as the highest criticality a user gave them.
+func alertRules(selected []models.SelectedProject, cached []models.CachedProject, staleDays int, generatedAt time.Time) string {
+	paths := make(map[int]string, len(cached))
+	for _, project := range cached {
+		paths[project.ID] = project.PathWithNamespace
+	}
+
+	type tracked struct{ project, ref string }
+	criticalities := make(map[tracked]string)
+	var projects []tracked
+	for _, project := range selected {
+		path, ok := paths[project.ProjectID]
+		if !ok {
+			// Not in the cache anymore, so no snapshot records it
+			continue
+		}
+		key := tracked{path, project.Ref}
+		criticality, seen := criticalities[key]
+		if !seen {
+			projects = append(projects, key)
+		}
+		if !seen || models.CriticalityWeight(project.Criticality) > models.CriticalityWeight(criticality) {
+			criticalities[key] = project.Criticality
+		}
+	}
+	sort.Slice(projects, func(i, j int) bool {
+		if projects[i].project != projects[j].project {
+			return projects[i].project < projects[j].project
+		}
+		return projects[i].ref < projects[j].ref
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Alerting rules for the %d projects tracked on GitLab Pipeline Status, generated %s.\n",
+		len(projects), generatedAt.Format(time.RFC3339))
+	b.WriteString("# The pipeline metrics need METRICS_PIPELINE_STATUS=true and status snapshots enabled.\n")
+	b.WriteString("# Adjust or delete the rules of single projects as needed.\n")
+	b.WriteString("groups:\n")
+	if snapshotInterval > 0 {
+		// Three missed snapshots, held for two intervals so a restart's first snapshot can land
+		minutes := int(snapshotInterval.Minutes())
+		b.WriteString("  - name: gitlab-status\n    rules:\n")
+		writeAlertRule(&b, "GitLabStatusSnapshotsStopped",
+			fmt.Sprintf(`time() - gitlab_status_job_last_success_timestamp_seconds{job="status-snapshot"} > %d`, 3*minutes*60),
+			fmt.Sprintf("%dm", 2*minutes),
+			"warning", nil, "Pipeline statuses are no longer recorded",
+			fmt.Sprintf("The status snapshot job hasn't succeeded for over %d minutes, so the pipeline metrics are outdated.", 3*minutes))
+	}
+
+	b.WriteString("  - name: gitlab-status-pipelines\n    rules:\n")
+	for _, p := range projects {
+		selector := fmt.Sprintf("{project=%s,ref=%s}", strconv.Quote(p.project), strconv.Quote(p.ref))
+		labels := map[string]string{"project": p.project}
+		target := p.project
+		if p.ref != "" {
+			labels["ref"] = p.ref
+			target += " (" + p.ref + ")"
+		}
+		severity := alertSeverity(criticalities[p])
+		writeAlertRule(&b, "GitLabPipelineFailing",
+			"gitlab_status_pipeline_failed"+selector+" == 1", alertFailingFor,
+			severity, labels, "Pipeline of "+target+" is failing",
+			"The latest pipeline of "+target+" has been failing for "+alertFailingFor+".")
+		writeAlertRule(&b, "GitLabPipelineStale",
+			fmt.Sprintf("gitlab_status_pipeline_last_success_timestamp_seconds%s > 0 and time() - gitlab_status_pipeline_last_success_timestamp_seconds%s > %d", selector, selector, staleDays*24*3600), "1h",
+			severity, labels, "No successful pipeline of "+target+" in "+strconv.Itoa(staleDays)+" days",
+			target+" hasn't had a successful pipeline for more than "+strconv.Itoa(staleDays)+" days.")
+	}
+	return b.String()
+}
+
+// writeAlertRule appends one alerting rule; strings are quoted, which YAML reads like JSON strings
+func writeAlertRule(b *strings.Builder, name, expr, forDuration, severity string, labels map[string]string, summary, description string) {
+	fmt.Fprintf(b, "      - alert: %s\n", name)
+	fmt.Fprintf(b, "        expr: %s\n", strconv.Quote(expr))
+	fmt.Fprintf(b, "        for: %s\n", forDuration)
+	fmt.Fprintf(b, "        labels:\n          severity: %s\n", severity)
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(b, "          %s: %s\n", key, strconv.Quote(labels[key]))
+	}
+	b.WriteString("        annotations:\n")
+	fmt.Fprintf(b, "          summary: %s\n", strconv.Quote(summary))
+	fmt.Fprintf(b, "          description: %s\n", strconv.Quote(description))
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gitlab-status/models"
+)
+
+var (
+	pseudonymAdjectives = []string{"amber", "brisk", "calm", "dusty", "eager", "fuzzy", "gentle", "hollow", "ivory", "jolly", "keen", "lucky", "misty", "noble", "olive", "quiet",
+		"rapid", "silent", "tidy", "urban", "vivid", "windy", "young", "zesty", "bold", "crisp", "dapper", "frosty", "golden", "hazy", "lively", "mellow"}
+	pseudonymNouns = []string{"falcon", "otter", "maple", "comet", "harbor", "lynx", "pebble", "raven", "cedar", "meadow", "badger", "canyon", "heron", "walrus", "willow", "tundra",
+		"aspen", "bison", "coral", "dune", "ember", "fjord", "glacier", "hawk", "iris", "juniper", "kestrel", "lagoon", "marten", "nebula", "orchid", "puffin"}
+
+	// anonymizeKey keys the pseudonyms, so they can't be reversed by hashing guessed project names
+	anonymizeKey = randomAnonymizeKey()
+)
+
+// publicStages are stage names that don't reveal anything and are kept when anonymizing
+var publicStages = map[string]bool{".pre": true, "build": true, "test": true, "lint": true, "deploy": true, "release": true, ".post": true}
+
+// publicRefs are ref names that don't reveal anything and are kept when anonymizing
+var publicRefs = map[string]bool{"main": true, "master": true, "develop": true, "development": true, "staging": true, "production": true}
+
+// versionRef matches version tags, which are kept when anonymizing
+var versionRef = regexp.MustCompile(`^v?\d+(\.\d+)*([-+.][0-9A-Za-z.]+)?$`)
+
+func randomAnonymizeKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// SetAnonymizeSecret sets the secret the pseudonyms of anonymized mode are derived from. Without one
+// a random secret is used, so pseudonyms change when the server restarts and differ between replicas.
+func SetAnonymizeSecret(secret string) {
+	if secret == "" {
+		anonymizeKey = randomAnonymizeKey()
+		return
+	}
+	anonymizeKey = []byte(secret)
+}
+
+// pseudonym returns a readable name like "misty-heron-3fa9c1" that is always the same for the same key
+// and secret
+func pseudonym(key string) string {
+	mac := hmac.New(sha256.New, anonymizeKey)
+	mac.Write([]byte(key))
+	sum := binary.BigEndian.Uint64(mac.Sum(nil))
+	adjective := pseudonymAdjectives[sum%uint64(len(pseudonymAdjectives))]
+	sum /= uint64(len(pseudonymAdjectives))
+	noun := pseudonymNouns[sum%uint64(len(pseudonymNouns))]
+	sum /= uint64(len(pseudonymNouns))
+	return fmt.Sprintf("%s-%s-%06x", adjective, noun, sum&0xffffff)
+}
+
+// anonymizePath replaces every segment of a project or group path with a pseudonym of the path up to it,
+// so projects of the same group still share their pseudonymous group
+func anonymizePath(path string) string {
+	segments := strings.Split(path, "/")
+	anonymized := make([]string, len(segments))
+	for i := range segments {
+		anonymized[i] = pseudonym("path:" + strings.Join(segments[:i+1], "/"))
+	}
+	return strings.Join(anonymized, "/")
+}
+
+// anonymizeRef keeps common branch names and version tags and replaces other refs, which often name
+// customers or features
+func anonymizeRef(ref string) string {
+	if ref == "" || publicRefs[ref] || versionRef.MatchString(ref) {
+		return ref
+	}
+	return "branch-" + pseudonym("ref:"+ref)
+}
+
+// anonymizeStage keeps common stage names and replaces the others and the names of the failed jobs
+func anonymizeStage(stage models.StageSummary) models.StageSummary {
+	if !publicStages[stage.Name] {
+		stage.Name = "stage-" + pseudonym("stage:"+stage.Name)
+	}
+	jobs := make([]models.Job, len(stage.FailedJobs))
+	for i, job := range stage.FailedJobs {
+		job.Name = "job-" + pseudonym("job:"+job.Name)
+		job.Stage = stage.Name
+		job.WebURL = "#"
+		jobs[i] = job
+	}
+	stage.FailedJobs = jobs
+	return stage
+}
+
+// anonymizeRelease keeps version tags and hides other release names and tags and the release notes
+func anonymizeRelease(release models.Release) models.Release {
+	if !versionRef.MatchString(release.TagName) {
+		release.TagName = "release-" + pseudonym("tag:"+release.TagName)
+	}
+	release.Name = release.TagName
+	release.Description = ""
+	release.DescriptionHTML = ""
+	release.Links.Self = "#"
+	return release
+}
+
+// anonymizePipeline hides the ref and GitLab link of a pipeline
+func anonymizePipeline(pipeline models.Pipeline) models.Pipeline {
+	pipeline.Ref = anonymizeRef(pipeline.Ref)
+	pipeline.WebURL = "#"
+	return pipeline
+}
+
+// anonymizeStatuses returns the statuses with project names, paths, refs and GitLab links replaced by
+// stable pseudonyms and hides other names, for sharing screenshots. Pipeline statuses, dates and numbers
+// are kept.
+func anonymizeStatuses(statuses []models.RepositoryStatus) []models.RepositoryStatus {
+	anonymized := make([]models.RepositoryStatus, len(statuses))
+	for i, status := range statuses {
+		status.RepositoryPath = anonymizePath(status.RepositoryPath)
+		status.RepositoryName = status.RepositoryPath[strings.LastIndex(status.RepositoryPath, "/")+1:]
+		status.Version = anonymizeRef(status.Version)
+		status.WebURL = "#"
+		status.ProjectURL = "#"
+		status.HasAvatar = false
+		status.Planning = nil
+		status.LatestArtifact = nil
+		if status.Incident != "" {
+			status.Incident = "Active incident"
+		}
+		if status.Error != "" {
+			status.Error = "Details are hidden while anonymized"
+		}
+		if status.LastSuccessPipeline != nil {
+			lastSuccess := anonymizePipeline(*status.LastSuccessPipeline)
+			status.LastSuccessPipeline = &lastSuccess
+		}
+		recent := make([]models.Pipeline, len(status.RecentPipelines))
+		for j, pipeline := range status.RecentPipelines {
+			recent[j] = anonymizePipeline(pipeline)
+		}
+		status.RecentPipelines = recent
+		stages := make([]models.StageSummary, len(status.Stages))
+		for j, stage := range status.Stages {
+			stages[j] = anonymizeStage(stage)
+		}
+		status.Stages = stages
+		downstream := make([]models.Bridge, len(status.Downstream))
+		for j, bridge := range status.Downstream {
+			bridge.Name = "trigger-" + strconv.Itoa(j+1)
+			if bridge.DownstreamPipeline != nil {
+				pipeline := *bridge.DownstreamPipeline
+				pipeline.WebURL = "#"
+				bridge.DownstreamPipeline = &pipeline
+			}
+			downstream[j] = bridge
+		}
+		status.Downstream = downstream
+		agents := make([]models.ClusterAgent, len(status.ClusterAgents))
+		for j, agent := range status.ClusterAgents {
+			agent.Name = "agent-" + strconv.Itoa(j+1)
+			agents[j] = agent
+		}
+		status.ClusterAgents = agents
+		if status.LatestRelease != nil {
+			release := anonymizeRelease(*status.LatestRelease)
+			status.LatestRelease = &release
+		}
+		if len(status.ScheduleProblems) > 0 {
+			status.ScheduleProblems = []string{fmt.Sprintf("%d pipeline schedule problem(s)", len(status.ScheduleProblems))}
+		}
+		anonymized[i] = status
+	}
+	return anonymized
+}
+
+// anonymizeIncidents replaces the affected paths of incidents with the pseudonyms used for the statuses
+// and hides their titles
+func anonymizeIncidents(incidents []models.Incident) []models.Incident {
+	anonymized := make([]models.Incident, len(incidents))
+	for i, incident := range incidents {
+		incident.Title = "Incident " + strconv.FormatInt(incident.ID, 10)
+		paths := incident.Paths()
+		for j, path := range paths {
+			paths[j] = anonymizePath(path)
+		}
+		incident.AffectedPaths = strings.Join(paths, "\n")
+		anonymized[i] = incident
+	}
+	return anonymized
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"gitlab-status/models"
+)
+
+func TestPseudonymDependsOnSecret(t *testing.T) {
+	defer SetAnonymizeSecret("")
+
+	SetAnonymizeSecret("first")
+	first := pseudonym("path:acme/billing")
+	if again := pseudonym("path:acme/billing"); again != first {
+		t.Fatalf("pseudonym changed from %q to %q with the same secret", first, again)
+	}
+	SetAnonymizeSecret("second")
+	if second := pseudonym("path:acme/billing"); second == first {
+		t.Errorf("pseudonym %q is the same with another secret", second)
+	}
+}
+
+func TestAnonymizeStatusesHidesNames(t *testing.T) {
+	release := &models.Release{Name: "Acme launch", TagName: "acme-launch", Description: "For Acme Corp", DescriptionHTML: "<p>For Acme Corp</p>"}
+	statuses := anonymizeStatuses([]models.RepositoryStatus{{
+		RepositoryPath: "acme/billing",
+		RepositoryName: "billing",
+		Incident:       "Acme billing outage",
+		Stages: []models.StageSummary{
+			{Name: "build", Status: "success"},
+			{Name: "acme-deploy", Status: "failed", FailedJobs: []models.Job{{ID: 7, Name: "deploy-acme", Stage: "acme-deploy", WebURL: "https://gitlab.example.com/acme/billing/-/jobs/7"}}},
+		},
+		Downstream:     []models.Bridge{{Name: "trigger-acme-portal"}},
+		LatestRelease:  release,
+		LatestArtifact: &models.Job{Name: "package-acme"},
+	}})
+	status := statuses[0]
+
+	if status.Stages[0].Name != "build" {
+		t.Errorf("common stage name became %q", status.Stages[0].Name)
+	}
+	job := status.Stages[1].FailedJobs[0]
+	if job.ID != 7 || job.WebURL != "#" {
+		t.Errorf("failed job got ID %d and URL %q, want 7 and #", job.ID, job.WebURL)
+	}
+	if status.LatestArtifact != nil {
+		t.Error("artifact link is kept")
+	}
+	if status.LatestRelease.Description != "" || status.LatestRelease.DescriptionHTML != "" {
+		t.Error("release notes are kept")
+	}
+	if release.Name != "Acme launch" {
+		t.Error("the original release was changed")
+	}
+	for _, text := range []string{status.RepositoryPath, status.Incident, status.Stages[1].Name, job.Name, job.Stage,
+		status.Downstream[0].Name, status.LatestRelease.Name, status.LatestRelease.TagName} {
+		if strings.Contains(strings.ToLower(text), "acme") {
+			t.Errorf("anonymized status still shows %q", text)
+		}
+	}
+
+	incidents := anonymizeIncidents([]models.Incident{{ID: 3, Title: "Acme billing outage", AffectedPaths: "acme/billing"}})
+	if strings.Contains(incidents[0].Title, "Acme") || incidents[0].AffectedPaths != status.RepositoryPath {
+		t.Errorf("anonymized incident is %q affecting %q", incidents[0].Title, incidents[0].AffectedPaths)
+	}
+}
+
+func TestAnonymizeReleaseKeepsVersionTags(t *testing.T) {
+	release := anonymizeRelease(models.Release{Name: "Spring release", TagName: "v1.4.0"})
+	if release.TagName != "v1.4.0" || release.Name != "v1.4.0" {
+		t.Errorf("release became %q tagged %q, want both v1.4.0", release.Name, release.TagName)
+	}
+}
@@ -0,0 +1,464 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+// statusFields lists the fields available on /api/v1/statuses, in output order
+var statusFields = []string{
+	"id", "name", "path", "ref", "pipeline_id", "status", "date", "web_url",
+	"project_url", "last_success_id", "last_success_date", "stale", "error",
+	"ref_protected", "pipeline_required", "coverage", "released_version", "source",
+	"criticality", "iteration", "epics",
+}
+
+// statusFieldValues converts a repository status to its API representation
+func statusFieldValues(status models.RepositoryStatus) map[string]interface{} {
+	values := map[string]interface{}{
+		"id":                status.RepositoryID,
+		"name":              status.RepositoryName,
+		"path":              status.RepositoryPath,
+		"ref":               status.Version,
+		"pipeline_id":       status.PipelineID,
+		"status":            status.Status,
+		"date":              nil,
+		"web_url":           status.WebURL,
+		"project_url":       status.ProjectURL,
+		"last_success_id":   nil,
+		"last_success_date": nil,
+		"stale":             status.Stale,
+		"error":             nil,
+		"ref_protected":     nil,
+		"pipeline_required": nil,
+		"coverage":          status.Coverage,
+		"released_version":  nil,
+		"source":            status.Source,
+		"criticality":       models.NormalizeCriticality(status.Criticality),
+		"iteration":         nil,
+		"epics":             []models.EpicRef{},
+	}
+	if status.Planning != nil {
+		values["iteration"] = map[string]interface{}{
+			"id":         status.Planning.Iteration.ID,
+			"title":      status.Planning.Iteration.Name(),
+			"start_date": status.Planning.Iteration.StartDate,
+			"due_date":   status.Planning.Iteration.DueDate,
+			"web_url":    status.Planning.Iteration.WebURL,
+			"issues":     status.Planning.Issues,
+			"issues_url": status.Planning.IssuesURL,
+		}
+		if status.Planning.Epics != nil {
+			values["epics"] = status.Planning.Epics
+		}
+	}
+	if status.LatestRelease != nil {
+		values["released_version"] = status.LatestRelease.TagName
+	}
+	if status.Protection != nil {
+		if status.Protection.IsBranch {
+			values["ref_protected"] = status.Protection.Protected
+		}
+		values["pipeline_required"] = status.Protection.PipelineRequired
+	}
+	if status.Error != "" {
+		values["error"] = status.Error
+	}
+	if !status.Date.IsZero() {
+		values["date"] = status.Date
+	}
+	if status.LastSuccessPipeline != nil {
+		values["last_success_id"] = status.LastSuccessPipeline.ID
+		values["last_success_date"] = status.LastSuccessPipeline.CreatedAt
+	}
+	return values
+}
+
+// splitList splits a comma separated query parameter into trimmed, non-empty values
+func splitList(value string) []string {
+	var result []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// matchesStatus reports whether a status passes the status filter
+func matchesStatus(status string, statusFilter []string) bool {
+	if len(statusFilter) == 0 {
+		return true
+	}
+	for _, s := range statusFilter {
+		if strings.EqualFold(status, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// inGroups reports whether a project path belongs to one of the given group paths (or their subgroups)
+func inGroups(path string, groupFilter []string) bool {
+	if len(groupFilter) == 0 {
+		return true
+	}
+	for _, group := range groupFilter {
+		group = strings.Trim(group, "/")
+		if strings.HasPrefix(strings.ToLower(path), strings.ToLower(group)+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusesAPIHandler returns the pipeline statuses of the user's selected projects as JSON, critical
+// projects first, with their health weighted by criticality.
+// Supports ?status=failed,running, ?group=platform and ?fields=name,status,web_url.
+// With ?at=<RFC 3339 time> the statuses come from the last snapshot taken at or before that time.
+func StatusesAPIHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	statusFilter := splitList(c.QueryParam("status"))
+	groupFilter := splitList(c.QueryParam("group"))
+
+	fields := splitList(c.QueryParam("fields"))
+	if len(fields) == 0 {
+		fields = statusFields
+	}
+	for _, field := range fields {
+		known := false
+		for _, f := range statusFields {
+			if f == field {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return c.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error":            "unknown field: " + field,
+				"available_fields": statusFields,
+			})
+		}
+	}
+
+	var at time.Time
+	if atParam := c.QueryParam("at"); atParam != "" {
+		parsed, err := time.Parse(time.RFC3339, atParam)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "at must be an RFC 3339 timestamp, e.g. 2024-05-01T14:30:00Z"})
+		}
+		at = parsed
+	}
+
+	selectedProjects, err := db.GetSelectedProjects(userID)
+	if err != nil {
+		log.Printf("Error fetching selected projects: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to load selected projects"})
+	}
+
+	visible, err := visibleProjectIDs(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+
+	// Filter by group before fetching to avoid needless GitLab API calls
+	var groupProjects []models.SelectedProject
+	for _, sp := range sortByCriticality(filterVisibleSelectedProjects(selectedProjects, visible)) {
+		if inGroups(sp.Path, groupFilter) {
+			groupProjects = append(groupProjects, sp)
+		}
+	}
+
+	var statuses []models.RepositoryStatus
+	var snapshotAt time.Time
+	if at.IsZero() {
+		statuses = fetchRepositoryStatuses(gitlab.WithFeature(c.Request().Context(), gitlab.FeatureStatus), groupProjects, client)
+	} else {
+		projectIDs := make([]int, 0, len(groupProjects))
+		for _, sp := range groupProjects {
+			projectIDs = append(projectIDs, sp.ProjectID)
+		}
+		trackedRefs := make(map[int]string, len(groupProjects))
+		criticalities := make(map[int]string, len(groupProjects))
+		for _, sp := range groupProjects {
+			trackedRefs[sp.ProjectID] = sp.Ref
+			criticalities[sp.ProjectID] = sp.Criticality
+		}
+		var snapshots []models.StatusSnapshot
+		snapshotAt, snapshots, err = db.GetStatusSnapshotsAt(at, projectIDs)
+		if err != nil {
+			log.Printf("Error fetching status snapshots: %v", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to load status snapshots"})
+		}
+		if snapshotAt.IsZero() {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "no status snapshot was taken at or before " + at.Format(time.RFC3339)})
+		}
+		for _, snapshot := range snapshots {
+			// Other users may track a different ref of the same project
+			if snapshot.TrackedRef == trackedRefs[snapshot.ProjectID] {
+				status := statusFromSnapshot(snapshot)
+				status.Criticality = criticalities[snapshot.ProjectID]
+				statuses = append(statuses, status)
+			}
+		}
+		// Snapshots come ordered by path
+		sort.SliceStable(statuses, func(i, j int) bool {
+			return models.CriticalityWeight(statuses[i].Criticality) > models.CriticalityWeight(statuses[j].Criticality)
+		})
+	}
+
+	result := []map[string]interface{}{}
+	for _, status := range statuses {
+		if !matchesStatus(status.Status, statusFilter) {
+			continue
+		}
+
+		values := statusFieldValues(status)
+		item := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			item[field] = values[field]
+		}
+		result = append(result, item)
+	}
+
+	response := map[string]interface{}{
+		"count":    len(result),
+		"statuses": result,
+	}
+	// The health of all statuses, including the ones the status filter leaves out
+	if health, ok := models.WeightedHealth(statuses); ok {
+		response["health"] = health
+	}
+	if !snapshotAt.IsZero() {
+		response["snapshot_at"] = snapshotAt
+	}
+	if warning := callBudgetWarning(c); warning != "" {
+		response["warning"] = warning
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// GitLabUsageAPIHandler reports how many GitLab API calls each feature made in the current hour,
+// their configured budgets and the last known GitLab rate limit quota
+func GitLabUsageAPIHandler(c echo.Context) error {
+	rateLimit := gitlab.GetRateLimitStatus()
+	quota := map[string]interface{}{"known": rateLimit.Known(), "throttled": rateLimit.Throttled}
+	if rateLimit.Known() {
+		quota["limit"] = rateLimit.Limit
+		quota["remaining"] = rateLimit.Remaining
+		quota["reset_at"] = rateLimit.ResetAt
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"features":     gitlab.GetBudgetUsage(),
+		"rate_limit":   quota,
+		"circuit_open": gitlab.CircuitOpen(),
+	})
+}
+
+// selectionRefs identifies projects by GitLab ID and/or path with namespace
+type selectionRefs struct {
+	ProjectIDs   []int    `json:"project_ids"`
+	ProjectPaths []string `json:"project_paths"`
+}
+
+// selectionPatch adds and removes projects from the current selection
+type selectionPatch struct {
+	Add    selectionRefs `json:"add"`
+	Remove selectionRefs `json:"remove"`
+}
+
+// resolveSelectionRefs validates project references against the cache and returns their IDs.
+// References that are not in the cache or not in visible (unless nil) are returned as unknown.
+func resolveSelectionRefs(refs selectionRefs, visible map[int]bool) ([]int, []string) {
+	var ids []int
+	var unknown []string
+
+	for _, id := range refs.ProjectIDs {
+		if _, err := db.GetCachedProject(id); err != nil || (visible != nil && !visible[id]) {
+			unknown = append(unknown, strconv.Itoa(id))
+			continue
+		}
+		ids = append(ids, id)
+	}
+	for _, path := range refs.ProjectPaths {
+		project, err := db.GetCachedProjectByPath(strings.Trim(path, "/"))
+		if err != nil || (visible != nil && !visible[project.ID]) {
+			unknown = append(unknown, path)
+			continue
+		}
+		ids = append(ids, project.ID)
+	}
+
+	return ids, unknown
+}
+
+// selectionResponse returns the user's current selection as JSON
+func selectionResponse(c echo.Context, userID int64) error {
+	selectedProjects, err := db.GetSelectedProjects(userID)
+	if err != nil {
+		log.Printf("Error fetching selected projects: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to load selected projects"})
+	}
+
+	result := []map[string]interface{}{}
+	for _, sp := range selectedProjects {
+		result = append(result, map[string]interface{}{
+			"project_id":  sp.ProjectID,
+			"path":        sp.Path,
+			"ref":         sp.Ref,
+			"criticality": models.NormalizeCriticality(sp.Criticality),
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"count":      len(result),
+		"selections": result,
+	})
+}
+
+// SelectionsAPIHandler returns the user's selected projects
+func SelectionsAPIHandler(c echo.Context, store sessions.Store) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+	return selectionResponse(c, userID)
+}
+
+// ReplaceSelectionsAPIHandler replaces the user's selection with the given projects (PUT).
+// The whole request is rejected if any project is not in the cache.
+func ReplaceSelectionsAPIHandler(c echo.Context, store sessions.Store) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	var refs selectionRefs
+	if err := json.NewDecoder(c.Request().Body).Decode(&refs); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid JSON body: " + err.Error()})
+	}
+
+	visible, err := visibleProjectIDs(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+
+	ids, unknown := resolveSelectionRefs(refs, visible)
+	if len(unknown) > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":   "projects not found in cache",
+			"unknown": unknown,
+		})
+	}
+
+	if err := db.SaveSelectedProjects(userID, projectIDStrings(ids)); err != nil {
+		return saveSelectionError(c, err)
+	}
+
+	return selectionResponse(c, userID)
+}
+
+// PatchSelectionsAPIHandler adds projects to and removes projects from the user's selection (PATCH)
+func PatchSelectionsAPIHandler(c echo.Context, store sessions.Store) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	var patch selectionPatch
+	if err := json.NewDecoder(c.Request().Body).Decode(&patch); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid JSON body: " + err.Error()})
+	}
+
+	visible, err := visibleProjectIDs(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+
+	addIDs, unknown := resolveSelectionRefs(patch.Add, visible)
+	if len(unknown) > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":   "projects not found in cache",
+			"unknown": unknown,
+		})
+	}
+	// Removing projects that are no longer cached is allowed
+	removeIDs := make(map[int]bool)
+	for _, id := range patch.Remove.ProjectIDs {
+		removeIDs[id] = true
+	}
+	removePaths := make(map[string]bool)
+	for _, path := range patch.Remove.ProjectPaths {
+		removePaths[strings.Trim(path, "/")] = true
+	}
+
+	selectedProjects, err := db.GetSelectedProjects(userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	var ids []int
+	seen := make(map[int]bool)
+	for _, sp := range selectedProjects {
+		if removeIDs[sp.ProjectID] || removePaths[sp.Path] || seen[sp.ProjectID] {
+			continue
+		}
+		seen[sp.ProjectID] = true
+		ids = append(ids, sp.ProjectID)
+	}
+	for _, id := range addIDs {
+		if !seen[id] && !removeIDs[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	if err := db.SaveSelectedProjects(userID, projectIDStrings(ids)); err != nil {
+		return saveSelectionError(c, err)
+	}
+
+	return selectionResponse(c, userID)
+}
+
+// saveSelectionError reports a failed selection update, rejecting selections over the per-user limit with 422
+func saveSelectionError(c echo.Context, err error) error {
+	var limitErr *db.SelectionLimitError
+	if errors.As(err, &limitErr) {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":     err.Error(),
+			"limit":     limitErr.Limit,
+			"requested": limitErr.Requested,
+		})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
+
+// projectIDStrings converts project IDs to the string form used by the settings form
+func projectIDStrings(ids []int) []string {
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, strconv.Itoa(id))
+	}
+	return result
+}
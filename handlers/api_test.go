@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab/gitlabtest"
+	"gitlab-status/models"
+)
+
+// setupTestDatabase opens a fresh SQLite database with the default user and returns the user
+func setupTestDatabase(t *testing.T) *models.User {
+	t.Helper()
+	if err := db.Initialize(db.Options{DSN: filepath.Join(t.TempDir(), "gitlab-status.db")}); err != nil {
+		t.Fatalf("initializing database: %v", err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+	if err := db.CreateDefaultUser("admin", "admin"); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	user, err := db.GetUserByName("admin")
+	if err != nil {
+		t.Fatalf("loading user: %v", err)
+	}
+	return user
+}
+
+// selectTestProject caches a project and adds it to the user's selection
+func selectTestProject(t *testing.T, userID int64, project models.Project) {
+	t.Helper()
+	if _, err := db.CacheProject(project); err != nil {
+		t.Fatalf("caching project: %v", err)
+	}
+	if _, err := db.AddSelectedProject(userID, project.ID, project.PathWithNamespace); err != nil {
+		t.Fatalf("selecting project: %v", err)
+	}
+}
+
+// loggedInContext returns an echo context for a request from the logged-in user
+func loggedInContext(t *testing.T, store sessions.Store, user *models.User, req *http.Request) (echo.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	login := httptest.NewRecorder()
+	session, _ := store.Get(httptest.NewRequest(http.MethodGet, "/login", nil), "gitlab-status-session")
+	session.Values["logged_in"] = true
+	session.Values["username"] = user.Username
+	session.Values["user_id"] = user.ID
+	if err := session.Save(httptest.NewRequest(http.MethodGet, "/login", nil), login); err != nil {
+		t.Fatalf("saving session: %v", err)
+	}
+	for _, cookie := range login.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	return echo.New().NewContext(req, rec), rec
+}
+
+func TestStatusesAPIHandler(t *testing.T) {
+	user := setupTestDatabase(t)
+	store := sessions.NewCookieStore([]byte("test-session-secret"))
+
+	api := models.Project{ID: 1, Name: "api", PathWithNamespace: "platform/api", WebURL: "https://gitlab.example.com/platform/api"}
+	web := models.Project{ID: 2, Name: "web", PathWithNamespace: "platform/web", WebURL: "https://gitlab.example.com/platform/web"}
+	selectTestProject(t, user.ID, api)
+	selectTestProject(t, user.ID, web)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	client := &gitlabtest.FakeClient{
+		BaseURL:  "https://gitlab.example.com",
+		Projects: []models.Project{api, web},
+		Pipelines: map[string][]models.Pipeline{
+			"1": {
+				{ID: 102, Ref: "main", Status: "failed", CreatedAt: now},
+				{ID: 101, Ref: "main", Status: "success", CreatedAt: now.Add(-time.Hour)},
+			},
+			"2": {
+				{ID: 201, Ref: "main", Status: "success", CreatedAt: now},
+			},
+		},
+	}
+
+	c, rec := loggedInContext(t, store, user, httptest.NewRequest(http.MethodGet, "/api/v1/statuses?status=failed&fields=path,status,pipeline_id,last_success_id", nil))
+	if err := StatusesAPIHandler(c, store, client); err != nil {
+		t.Fatalf("StatusesAPIHandler: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	var response struct {
+		Count    int                      `json:"count"`
+		Health   int                      `json:"health"`
+		Statuses []map[string]interface{} `json:"statuses"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if response.Count != 1 || len(response.Statuses) != 1 {
+		t.Fatalf("got %d statuses, want only the failed project: %s", response.Count, rec.Body)
+	}
+	status := response.Statuses[0]
+	if status["path"] != "platform/api" || status["status"] != "failed" || status["pipeline_id"] != float64(102) || status["last_success_id"] != float64(101) {
+		t.Errorf("unexpected status %v", status)
+	}
+	if response.Health != 50 {
+		t.Errorf("health = %d, want 50 for one of two projects failing", response.Health)
+	}
+}
+
+func TestStatusesAPIHandlerUnauthenticated(t *testing.T) {
+	store := sessions.NewCookieStore([]byte("test-session-secret"))
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/statuses", nil), rec)
+	if err := StatusesAPIHandler(c, store, &gitlabtest.FakeClient{}); err != nil {
+		t.Fatalf("StatusesAPIHandler: %v", err)
+	}
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status code = %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/models"
+)
+
+// Actions users take in GitLab through the status page
+const (
+	ActionRunPipeline    = "run-pipeline"
+	ActionRetryJob       = "retry-job"
+	ActionCreateSchedule = "create-schedule"
+	ActionToggleSchedule = "toggle-schedule"
+)
+
+// maxAuditUserAgent is how much of a User-Agent header is stored
+const maxAuditUserAgent = 256
+
+// recordAction records an action of actor with the client address and User-Agent of the request.
+// Rejected actions are recorded too, with GitLab's error.
+func recordAction(c echo.Context, action, actor string, projectID int, target string, err error) {
+	userAgent := c.Request().UserAgent()
+	if len(userAgent) > maxAuditUserAgent {
+		userAgent = userAgent[:maxAuditUserAgent]
+	}
+	entry := &models.AuditEntry{
+		Action:    action,
+		Actor:     actor,
+		ProjectID: projectID,
+		Target:    target,
+		ClientIP:  c.RealIP(),
+		UserAgent: userAgent,
+		CreatedAt: time.Now(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if err := db.RecordAuditEntry(entry); err != nil {
+		log.Printf("Error recording %s by %s: %v", action, actor, err)
+	}
+}
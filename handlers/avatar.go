@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"container/list"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+)
+
+const (
+	// avatarTTL is how long a downloaded avatar is served from memory. GitLab gives a new avatar
+	// a new URL, so this only bounds how long removed avatars stay around.
+	avatarTTL = 24 * time.Hour
+	// maxCachedAvatars and maxCachedAvatarBytes bound the avatars kept in memory; the least
+	// recently served ones are dropped first
+	maxCachedAvatars     = 2000
+	maxCachedAvatarBytes = 32 << 20
+)
+
+// avatarEntry is a downloaded avatar image
+type avatarEntry struct {
+	url         string
+	image       []byte
+	contentType string
+	fetchedAt   time.Time
+}
+
+var (
+	avatarMu    sync.Mutex
+	avatarCache = make(map[string]*list.Element) // Elements of avatarLRU by URL
+	avatarLRU   = list.New()                     // Avatars from most to least recently served
+	avatarBytes int                              // Size of the cached images
+)
+
+// cachedAvatar returns the cached avatar of a URL unless it expired
+func cachedAvatar(avatarURL string) (avatarEntry, bool) {
+	avatarMu.Lock()
+	defer avatarMu.Unlock()
+	element, ok := avatarCache[avatarURL]
+	if !ok {
+		return avatarEntry{}, false
+	}
+	entry := element.Value.(avatarEntry)
+	if time.Since(entry.fetchedAt) >= avatarTTL {
+		removeAvatar(element)
+		return avatarEntry{}, false
+	}
+	avatarLRU.MoveToFront(element)
+	return entry, true
+}
+
+// cacheAvatar keeps a downloaded avatar, dropping the least recently served ones beyond the limits
+func cacheAvatar(entry avatarEntry) {
+	avatarMu.Lock()
+	defer avatarMu.Unlock()
+	if element, ok := avatarCache[entry.url]; ok {
+		removeAvatar(element)
+	}
+	avatarCache[entry.url] = avatarLRU.PushFront(entry)
+	avatarBytes += len(entry.image)
+	for avatarLRU.Len() > maxCachedAvatars || avatarBytes > maxCachedAvatarBytes {
+		removeAvatar(avatarLRU.Back())
+	}
+}
+
+// removeAvatar drops a cached avatar; avatarMu must be held
+func removeAvatar(element *list.Element) {
+	entry := avatarLRU.Remove(element).(avatarEntry)
+	delete(avatarCache, entry.url)
+	avatarBytes -= len(entry.image)
+}
+
+// AvatarHandler serves the avatar of a cached project or group. Avatars on the GitLab instance are
+// downloaded with the API token and kept in memory, so they show on private instances too; avatars
+// hosted elsewhere are redirected to.
+func AvatarHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.NoContent(http.StatusNotFound)
+	}
+	var avatarURL string
+	switch c.Param("kind") {
+	case "projects":
+		visible, err := visibleProjectIDs(c.Request().Context(), userID)
+		if err != nil || (visible != nil && !visible[id]) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		project, err := db.GetCachedProject(id)
+		if err != nil {
+			return c.NoContent(http.StatusNotFound)
+		}
+		avatarURL = project.AvatarURL
+	case "groups":
+		group, err := db.GetCachedGroup(id)
+		if err != nil {
+			return c.NoContent(http.StatusNotFound)
+		}
+		visible, err := visibleGroup(c.Request().Context(), userID, *group)
+		if err != nil || !visible {
+			return c.NoContent(http.StatusNotFound)
+		}
+		avatarURL = group.AvatarURL
+	default:
+		return c.NoContent(http.StatusNotFound)
+	}
+	if avatarURL == "" {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if !strings.HasPrefix(avatarURL, strings.TrimSuffix(client.URL(), "/")+"/") {
+		// Not on the instance, e.g. Gravatar, so the browser can load it without the token
+		return c.Redirect(http.StatusFound, avatarURL)
+	}
+
+	entry, ok := cachedAvatar(avatarURL)
+	if !ok {
+		image, err := client.FetchAvatar(gitlab.WithFeature(c.Request().Context(), gitlab.FeatureOther), avatarURL)
+		if err != nil {
+			log.Printf("Error fetching avatar %s: %v", avatarURL, err)
+			return c.NoContent(http.StatusNotFound)
+		}
+		entry = avatarEntry{url: avatarURL, image: image, contentType: http.DetectContentType(image), fetchedAt: time.Now()}
+		cacheAvatar(entry)
+	}
+	if !strings.HasPrefix(entry.contentType, "image/") {
+		return c.NoContent(http.StatusNotFound)
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "private, max-age=3600")
+	return c.Blob(http.StatusOK, entry.contentType, entry.image)
+}
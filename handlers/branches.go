@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/models"
+	"gitlab-status/templates"
+)
+
+// BranchesPageHandler shows the branch or tag tracked for each selected project and its criticality
+func BranchesPageHandler(c echo.Context, store sessions.Store) error {
+	return renderBranchesPage(c, store, "", "")
+}
+
+// SaveBranchesHandler stores the branch or tag tracked for each selected project and its criticality
+func SaveBranchesHandler(c echo.Context, store sessions.Store) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+
+	if err := c.Request().ParseForm(); err != nil {
+		return renderBranchesPage(c, store, "", "Invalid form: "+err.Error())
+	}
+
+	selectedProjects, err := db.GetSelectedProjects(userID)
+	if err != nil {
+		return renderBranchesPage(c, store, "", err.Error())
+	}
+
+	refs := make(map[int]string, len(selectedProjects))
+	criticalities := make(map[int]string, len(selectedProjects))
+	for _, sp := range selectedProjects {
+		field := "ref-" + strconv.Itoa(sp.ProjectID)
+		if _, submitted := c.Request().Form[field]; submitted {
+			refs[sp.ProjectID] = strings.TrimSpace(c.Request().Form.Get(field))
+		}
+		field = "criticality-" + strconv.Itoa(sp.ProjectID)
+		if _, submitted := c.Request().Form[field]; submitted {
+			criticalities[sp.ProjectID] = c.Request().Form.Get(field)
+		}
+	}
+
+	if err := db.SetSelectedProjectRefs(userID, refs); err != nil {
+		log.Printf("Error saving tracked branches: %v", err)
+		return renderBranchesPage(c, store, "", "Failed to save branches: "+err.Error())
+	}
+	if err := db.SetSelectedProjectCriticalities(userID, criticalities); err != nil {
+		log.Printf("Error saving project criticalities: %v", err)
+		return renderBranchesPage(c, store, "", "Failed to save criticalities: "+err.Error())
+	}
+	return renderBranchesPage(c, store, "Branches saved.", "")
+}
+
+// renderBranchesPage renders the tracked branches of the user's visible selected projects
+func renderBranchesPage(c echo.Context, store sessions.Store, message, apiError string) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+
+	selectedProjects, err := db.GetSelectedProjects(userID)
+	if err != nil {
+		log.Printf("Error fetching selected projects: %v", err)
+		apiError = "Failed to load selected projects"
+	}
+	visible, err := visibleProjectIDs(c.Request().Context(), userID)
+	if err != nil {
+		apiError = "Cannot show projects: " + err.Error()
+		selectedProjects = []models.SelectedProject{}
+	}
+
+	return templates.Branches(session.Values["username"].(string), csrfToken(c), filterVisibleSelectedProjects(selectedProjects, visible), message, apiError).
+		Render(c.Request().Context(), c.Response().Writer)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/gitlab"
+)
+
+// cappedRequests counts the requests that reached the GitLab API call cap since the start
+var cappedRequests atomic.Int64
+
+// GitLabCallBudgetMiddleware caps the GitLab API calls made while serving one request at limit.
+// Calls past the cap fail without contacting GitLab, and the status page and API serve the last
+// known statuses of the projects they couldn't fetch, so one large dashboard refreshing every few
+// seconds can't flood GitLab.
+func GitLabCallBudgetMiddleware(limit int) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := gitlab.WithRequestBudget(c.Request().Context(), limit)
+			c.SetRequest(c.Request().WithContext(ctx))
+			err := next(c)
+			if calls, rejected := gitlab.RequestCalls(ctx); rejected > 0 {
+				cappedRequests.Add(1)
+				log.Printf("WARNING: %s %s reached the limit of %d GitLab API calls per request, %d more calls were skipped",
+					c.Request().Method, c.Request().URL.Path, calls, rejected)
+			}
+			return err
+		}
+	}
+}
+
+// callBudgetWarning explains to the user that a page shows older statuses because it needed too
+// many GitLab API calls, empty if it didn't
+func callBudgetWarning(c echo.Context) string {
+	if !gitlab.RequestBudgetExceeded(c.Request().Context()) {
+		return ""
+	}
+	calls, _ := gitlab.RequestCalls(c.Request().Context())
+	return fmt.Sprintf("Loading this page needed more than %d GitLab API calls, the limit per page load. Projects marked stale show their last known status; select fewer projects to see all of them live.", calls)
+}
+
+// writeCallBudgetMetrics appends how many requests reached the GitLab API call cap in the Prometheus text format
+func writeCallBudgetMetrics(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP gitlab_status_request_call_limit_reached_total Requests that reached the GitLab API call limit per request.\n# TYPE gitlab_status_request_call_limit_reached_total counter\ngitlab_status_request_call_limit_reached_total %d\n", cappedRequests.Load())
+}
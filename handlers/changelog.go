@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/sync/errgroup"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+	"gitlab-status/templates"
+)
+
+// changelogDateLayout is the format of the from and to query parameters of the changelog
+const changelogDateLayout = "2006-01-02"
+
+// defaultChangelogDays is the range of the changelog when no dates are given, a typical sprint
+const defaultChangelogDays = 14
+
+// ChangelogHandler aggregates the releases of the selected projects within a date range into one page,
+// or a Markdown file with ?format=markdown
+func ChangelogHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+	username := session.Values["username"].(string)
+
+	// The range is in the user's export time zone, so the days match the dates of the Markdown export
+	formatting, err := exportFormatting(c, userID)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid export settings: "+err.Error())
+	}
+
+	to := time.Now().In(formatting.Location)
+	if toStr := c.QueryParam("to"); toStr != "" {
+		parsed, err := time.ParseInLocation(changelogDateLayout, toStr, formatting.Location)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "Invalid to date, expected YYYY-MM-DD")
+		}
+		// The range includes the whole last day
+		to = parsed.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	from := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, formatting.Location).AddDate(0, 0, -defaultChangelogDays+1)
+	if fromStr := c.QueryParam("from"); fromStr != "" {
+		parsed, err := time.ParseInLocation(changelogDateLayout, fromStr, formatting.Location)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "Invalid from date, expected YYYY-MM-DD")
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		return c.String(http.StatusBadRequest, "The from date must not be after the to date")
+	}
+
+	selectedProjects, err := db.GetSelectedProjects(userID)
+	if err != nil {
+		log.Printf("Error fetching selected projects: %v", err)
+		return c.String(http.StatusInternalServerError, "Failed to load selected projects")
+	}
+	visible, err := visibleProjectIDs(c.Request().Context(), userID)
+	if err != nil {
+		return c.String(http.StatusForbidden, "Cannot show projects: "+err.Error())
+	}
+	selectedProjects = filterVisibleSelectedProjects(selectedProjects, visible)
+
+	ctx := gitlab.WithFeature(c.Request().Context(), gitlab.FeatureStatus)
+	changelogs := make([]models.ProjectChangelog, len(selectedProjects))
+	var g errgroup.Group
+	g.SetLimit(statusFetchConcurrency)
+	for i, selectedProject := range selectedProjects {
+		g.Go(func() error {
+			changelogs[i] = fetchProjectChangelog(ctx, selectedProject, from, to, client)
+			return nil
+		})
+	}
+	g.Wait()
+
+	fromStr, toStr := from.Format(changelogDateLayout), to.Format(changelogDateLayout)
+	if c.QueryParam("format") == "markdown" {
+		c.Response().Header().Set(echo.HeaderContentType, "text/markdown; charset=utf-8")
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="changelog-%s-%s.md"`, fromStr, toStr))
+		c.Response().WriteHeader(http.StatusOK)
+		return writeChangelogMarkdown(c.Response(), formatting, from, to, changelogs)
+	}
+	return templates.Changelog(username, fromStr, toStr, changelogs).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// fetchProjectChangelog gets the releases of a selected project released between from and to
+func fetchProjectChangelog(ctx context.Context, selectedProject models.SelectedProject, from, to time.Time, client gitlab.Client) models.ProjectChangelog {
+	changelog := models.ProjectChangelog{
+		ProjectName: selectedProject.Path,
+		ProjectPath: selectedProject.Path,
+	}
+	if cachedProject, err := db.GetCachedProject(selectedProject.ProjectID); err == nil {
+		changelog.ProjectName = cachedProject.Name
+		changelog.ProjectPath = cachedProject.PathWithNamespace
+		changelog.ProjectURL = cachedProject.WebURL
+	}
+
+	releases, err := client.FetchReleasesSince(ctx, strconv.Itoa(selectedProject.ProjectID), from)
+	if err != nil {
+		log.Printf("Error fetching releases of %s: %v", changelog.ProjectPath, err)
+		changelog.Error = describeGitLabError(err)
+		return changelog
+	}
+	for _, release := range releases {
+		if !release.ReleasedAt.After(to) {
+			release.DescriptionHTML = sanitizeReleaseNotes(release.DescriptionHTML, changelog.ProjectURL)
+			changelog.Releases = append(changelog.Releases, release)
+		}
+	}
+	return changelog
+}
+
+// writeChangelogMarkdown writes the releases of every project with releases in the range as a Markdown
+// document, with dates in the export's locale and time zone
+func writeChangelogMarkdown(w io.Writer, formatting models.ExportFormatting, from, to time.Time, changelogs []models.ProjectChangelog) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Changelog %s to %s\n", formatting.Date(from), formatting.Date(to))
+	for _, changelog := range changelogs {
+		if len(changelog.Releases) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## %s\n", changelog.ProjectPath)
+		for _, release := range changelog.Releases {
+			name := release.Name
+			if name == "" {
+				name = release.TagName
+			}
+			fmt.Fprintf(&b, "\n### %s (%s)\n\n", name, formatting.Date(release.ReleasedAt))
+			if description := strings.TrimSpace(release.Description); description != "" {
+				// Shift the release notes' own headings below the release heading, leaving code blocks alone
+				inCode := false
+				for _, line := range strings.Split(description, "\n") {
+					if strings.HasPrefix(line, "```") {
+						inCode = !inCode
+					}
+					if !inCode && strings.HasPrefix(line, "#") {
+						line = "###" + line
+					}
+					b.WriteString(line + "\n")
+				}
+			} else {
+				b.WriteString("_No release notes._\n")
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
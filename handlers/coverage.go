@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+// pipelineCoverage returns the test coverage reported by a finished pipeline, or nil when it's still
+// running, reported none or couldn't be fetched. The coverage of finished pipelines is stored, so each
+// costs one API call at most; running pipelines would cost one on every refresh.
+func pipelineCoverage(ctx context.Context, client gitlab.Client, projectID int, pipeline models.Pipeline) *float64 {
+	if !finishedPipelineStatuses[pipeline.Status] {
+		return nil
+	}
+	stored, err := db.GetPipelineCoverage(pipeline.ID)
+	if err != nil {
+		log.Printf("Error reading stored coverage: %v", err)
+	}
+	if stored != nil {
+		return stored.Coverage
+	}
+
+	details, err := client.FetchPipeline(ctx, strconv.Itoa(projectID), pipeline.ID)
+	if err != nil {
+		log.Printf("Error fetching pipeline %d of project %d: %v", pipeline.ID, projectID, err)
+		return nil
+	}
+	return recordPipelineDetails(projectID, details)
+}
+
+// recordPipelineDetails returns the coverage in the details of a single pipeline. The coverage and
+// timing of finished pipelines are stored, since the same details carry both, and the details
+// complete the pipeline history.
+func recordPipelineDetails(projectID int, details *models.Pipeline) *float64 {
+	recordPipelineHistory(projectID, *details)
+
+	var coverage *float64
+	if details.Coverage != "" {
+		if value, err := strconv.ParseFloat(details.Coverage, 64); err == nil {
+			coverage = &value
+		}
+	}
+
+	if finishedPipelineStatuses[details.Status] {
+		if err := db.SavePipelineCoverage(&models.PipelineCoverage{PipelineID: details.ID, ProjectID: projectID, Coverage: coverage}); err != nil {
+			log.Printf("Error storing coverage: %v", err)
+		}
+		recordPipelineTiming(projectID, details)
+	}
+	return coverage
+}
+
+// previousFinishedPipeline returns the newest finished pipeline older than the latest one, or nil
+func previousFinishedPipeline(latest *models.Pipeline, recent []models.Pipeline) *models.Pipeline {
+	for i, pipeline := range recent {
+		if pipeline.ID < latest.ID && finishedPipelineStatuses[pipeline.Status] {
+			return &recent[i]
+		}
+	}
+	return nil
+}
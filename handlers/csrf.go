@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// csrfContextKey is where CSRFMiddleware puts the token forms have to send back
+const csrfContextKey = "csrf"
+
+// CSRFMiddleware protects the routes forms post to, like running pipelines, saving settings and
+// declaring incidents, against requests forged by other sites. The pages with their forms get a
+// token in a cookie, which the forms send back in the _csrf field and HTMX in the X-CSRF-Token header.
+func CSRFMiddleware() echo.MiddlewareFunc {
+	return middleware.CSRFWithConfig(middleware.CSRFConfig{
+		TokenLookup:    "header:" + echo.HeaderXCSRFToken + ",form:_csrf",
+		ContextKey:     csrfContextKey,
+		CookieName:     "_csrf",
+		CookiePath:     "/",
+		CookieHTTPOnly: true,
+		CookieSameSite: http.SameSiteStrictMode,
+	})
+}
+
+// csrfToken returns the token for the forms of a page served through CSRFMiddleware
+func csrfToken(c echo.Context) string {
+	token, _ := c.Get(csrfContextKey).(string)
+	return token
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	e := echo.New()
+	csrf := CSRFMiddleware()
+	e.GET("/form", func(c echo.Context) error { return c.String(http.StatusOK, csrfToken(c)) }, csrf)
+	e.POST("/form", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }, csrf)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/form", nil))
+	token := rec.Body.String()
+	cookies := rec.Result().Cookies()
+	if token == "" || len(cookies) == 0 {
+		t.Fatalf("form page got token %q and %d cookies, want both", token, len(cookies))
+	}
+
+	for _, tt := range []struct {
+		name   string
+		field  string
+		cookie bool
+		want   int
+	}{
+		{"token from the page", token, true, http.StatusNoContent},
+		{"no token", "", true, http.StatusBadRequest},
+		{"wrong token", "forged", true, http.StatusForbidden},
+		{"no cookie", token, false, http.StatusForbidden},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			if tt.field != "" {
+				form.Set("_csrf", tt.field)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/form", strings.NewReader(form.Encode()))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+			if tt.cookie {
+				for _, cookie := range cookies {
+					req.AddCookie(cookie)
+				}
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Optional details of the project statuses. Each costs one or more GitLab API calls per project
+// whenever its cached value expires, so they are off unless enabled.
+const (
+	detailProtection = "protection" // Ref protection and whether pipelines must succeed to merge
+	detailStages     = "stages"     // Stages and failed jobs of the latest pipeline and its newest artifacts
+	detailTests      = "tests"      // Test report counts of the latest pipeline
+	detailDownstream = "downstream" // Pipelines triggered by the latest pipeline, counted in its status
+	detailAgents     = "agents"     // Connection status of agents for Kubernetes
+	detailReleases   = "releases"   // Latest release or tag
+	detailSchedules  = "schedules"  // Paused, missed and stuck pipeline schedules
+)
+
+// statusDetailNames are the optional details that can be enabled
+var statusDetailNames = []string{detailProtection, detailStages, detailTests, detailDownstream, detailAgents, detailReleases, detailSchedules}
+
+// statusDetails are the enabled optional details
+var statusDetails = make(map[string]bool)
+
+// SetStatusDetails enables the optional status details in a comma-separated list, or all of them
+// for "all". Unknown details are an error and enable nothing.
+func SetStatusDetails(spec string) error {
+	enabled := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		name := strings.ToLower(strings.TrimSpace(part))
+		switch {
+		case name == "":
+		case name == "all":
+			for _, detail := range statusDetailNames {
+				enabled[detail] = true
+			}
+		case slices.Contains(statusDetailNames, name):
+			enabled[name] = true
+		default:
+			return fmt.Errorf("unknown status detail %q, use %s or all", name, strings.Join(statusDetailNames, ", "))
+		}
+	}
+	statusDetails = enabled
+
+	if len(enabled) > 0 {
+		names := make([]string, 0, len(enabled))
+		for name := range enabled {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		log.Printf("Fetching status details: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/models"
+	"gitlab-status/templates"
+)
+
+// DisplayPageHandler shows the user's choice of status colors and symbols
+func DisplayPageHandler(c echo.Context, store sessions.Store) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+
+	user, err := db.GetUser(userID)
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+
+	return templates.Display(user.Username, csrfToken(c), user.StatusDisplay(), user.ExportSettings(), "", "").
+		Render(c.Request().Context(), c.Response().Writer)
+}
+
+// SaveDisplayHandler stores how the user wants pipeline statuses rendered and exports written
+func SaveDisplayHandler(c echo.Context, store sessions.Store) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+
+	user, err := db.GetUser(userID)
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+
+	display := models.StatusDisplay{Palette: c.FormValue("palette"), Shapes: c.FormValue("shapes") == "on"}
+	if display.Palette != models.PaletteColorBlind {
+		display.Palette = models.PaletteStandard
+	}
+	exports := models.ExportSettings{Locale: c.FormValue("export_locale"), Timezone: strings.TrimSpace(c.FormValue("export_timezone"))}
+	formatting, err := exports.Formatting()
+	if err != nil {
+		return templates.Display(user.Username, csrfToken(c), user.StatusDisplay(), user.ExportSettings(), "", "Invalid export settings: "+err.Error()).
+			Render(c.Request().Context(), c.Response().Writer)
+	}
+	exports.Locale = formatting.Locale.Code
+	if err := db.SetUserStatusDisplay(userID, display); err != nil {
+		return templates.Display(user.Username, csrfToken(c), user.StatusDisplay(), user.ExportSettings(), "", err.Error()).
+			Render(c.Request().Context(), c.Response().Writer)
+	}
+	if err := db.SetUserExportSettings(userID, exports); err != nil {
+		return templates.Display(user.Username, csrfToken(c), display, user.ExportSettings(), "", err.Error()).
+			Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	return templates.Display(user.Username, csrfToken(c), display, exports, "Display settings saved.", "").
+		Render(c.Request().Context(), c.Response().Writer)
+}
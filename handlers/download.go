@@ -0,0 +1,501 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+// exportFormat describes a file format structure exports can be written in
+type exportFormat struct {
+	extension   string
+	contentType string
+}
+
+// exportFormats lists the supported ?format= values; Markdown is the default
+var exportFormats = map[string]exportFormat{
+	"markdown": {extension: "md", contentType: "text/markdown; charset=utf-8"},
+	"csv":      {extension: "csv", contentType: "text/csv; charset=utf-8"},
+	"json":     {extension: "json", contentType: "application/json"},
+}
+
+// exportBootID distinguishes ETags of different server runs, as cache generations restart at zero
+var exportBootID = time.Now().UnixNano()
+
+// exportSource is where an export's data comes from and how its dates and numbers are written
+type exportSource struct {
+	gitlabURL  string
+	syncedAt   time.Time // Last sync of the cache, zero before the first one
+	formatting models.ExportFormatting
+}
+
+// markdownExport streams the Markdown variant of an export
+type markdownExport func(w io.Writer, source exportSource, groups []models.CachedGroup, projects []models.CachedProject) error
+
+// exportFormatting returns how an export is written: the user's export settings, overridden by
+// the locale and tz query parameters of the request
+func exportFormatting(c echo.Context, userID int64) (models.ExportFormatting, error) {
+	var settings models.ExportSettings
+	if user, err := db.GetUser(userID); err == nil {
+		settings = user.ExportSettings()
+	}
+	if locale := c.QueryParam("locale"); locale != "" {
+		settings.Locale = locale
+	}
+	if timezone := c.QueryParam("tz"); timezone != "" {
+		settings.Timezone = timezone
+	}
+	return settings.Formatting()
+}
+
+// lastSyncTime returns when the cache was last synced, zero when that's unknown
+func lastSyncTime() time.Time {
+	state, err := db.GetSyncState()
+	if err != nil || state == nil {
+		return time.Time{}
+	}
+	return state.LastSync
+}
+
+// DownloadStructureHandler serves the cached GitLab group structure as a Markdown, CSV or JSON file
+func DownloadStructureHandler(c echo.Context, store sessions.Store, gitlabURL string) error {
+	return serveExport(c, store, "gitlab-group-structure", gitlabURL, writeGroupStructure)
+}
+
+// DownloadPathStructureHandler serves the cached project paths as a Markdown tree, CSV or JSON file
+func DownloadPathStructureHandler(c echo.Context, store sessions.Store, gitlabURL string) error {
+	return serveExport(c, store, "gitlab-path-structure", gitlabURL, writePathStructure)
+}
+
+// serveExport streams an export of the cached structure to the response.
+// The ETag only depends on the cache generation and the user's visible projects, so conditional
+// requests are answered with 304 without rendering anything until the next sync.
+func serveExport(c echo.Context, store sessions.Store, name, gitlabURL string, markdown markdownExport) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+
+	formatName := c.QueryParam("format")
+	if formatName == "" {
+		formatName = "markdown"
+	}
+	format, ok := exportFormats[formatName]
+	if !ok {
+		return c.String(http.StatusBadRequest, "Unsupported export format: "+formatName)
+	}
+	formatting, err := exportFormatting(c, userID)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid export settings: "+err.Error())
+	}
+
+	visible, err := visibleProjectIDs(c.Request().Context(), userID)
+	if err != nil {
+		return c.String(http.StatusForbidden, "Cannot export projects: "+err.Error())
+	}
+
+	etag := fmt.Sprintf(`"%s-%s-%s-%s-%x-%d-%x"`, name, formatName, formatting.Locale.Code, formatting.Location, exportBootID, db.CacheGeneration(), visibilityHash(visible))
+	c.Response().Header().Set("ETag", etag)
+	c.Response().Header().Set("Cache-Control", "private, no-cache")
+	if match := c.Request().Header.Get("If-None-Match"); match != "" && match == etag {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	groups, err := db.GetCachedGroups()
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to load groups from cache: "+err.Error())
+	}
+	projects, err := db.GetCachedProjects()
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to load projects from cache: "+err.Error())
+	}
+	projects = filterVisibleCachedProjects(projects, visible)
+
+	c.Response().Header().Set(echo.HeaderContentType, format.contentType)
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format.extension))
+	c.Response().WriteHeader(http.StatusOK)
+
+	// Write through a small buffer that is flushed to the client as it fills up
+	w := bufio.NewWriterSize(c.Response(), 32<<10)
+	switch formatName {
+	case "csv":
+		err = writeProjectsCSV(w, formatting, groups, projects)
+	case "json":
+		err = writeProjectsJSON(w, groups, projects)
+	default:
+		err = markdown(w, exportSource{gitlabURL: gitlabURL, syncedAt: lastSyncTime(), formatting: formatting}, groups, projects)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		// The status is already sent; all we can do is stop writing
+		log.Printf("Error streaming %s export: %v", name, err)
+	}
+	return nil
+}
+
+// visibilityHash fingerprints a set of visible project IDs so exports are rebuilt when memberships change
+func visibilityHash(visible map[int]bool) uint64 {
+	if visible == nil {
+		return 0
+	}
+	ids := make([]int, 0, len(visible))
+	for id, ok := range visible {
+		if ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	h := fnv.New64a()
+	for _, id := range ids {
+		fmt.Fprintf(h, "%d,", id)
+	}
+	return h.Sum64()
+}
+
+// writeGroupStructure writes groups as nested Markdown lists with their projects.
+// Groups without visible projects are left out.
+func writeGroupStructure(w io.Writer, source exportSource, groups []models.CachedGroup, projects []models.CachedProject) error {
+	subgroups := make(map[int][]models.CachedGroup)
+	groupIDs := make(map[int]bool)
+	for _, group := range groups {
+		groupIDs[group.ID] = true
+	}
+	for _, group := range groups {
+		parentID := group.ParentID
+		if !groupIDs[parentID] {
+			parentID = 0
+		}
+		subgroups[parentID] = append(subgroups[parentID], group)
+	}
+	groupProjects := make(map[int][]models.CachedProject)
+	for _, project := range projects {
+		groupProjects[project.GroupID] = append(groupProjects[project.GroupID], project)
+	}
+
+	// Count projects per group including subgroups to skip empty branches
+	var countProjects func(groupID int) int
+	countProjects = func(groupID int) int {
+		count := len(groupProjects[groupID])
+		for _, sub := range subgroups[groupID] {
+			count += countProjects(sub.ID)
+		}
+		return count
+	}
+
+	if _, err := fmt.Fprintf(w, "# GitLab Group Structure\n\nGroups and projects cached from %s%s.\n\n", source.gitlabURL, source.syncedOn()); err != nil {
+		return err
+	}
+
+	var writeGroup func(group models.CachedGroup, depth int) error
+	writeGroup = func(group models.CachedGroup, depth int) error {
+		indent := strings.Repeat("  ", depth)
+		if _, err := fmt.Fprintf(w, "%s- **%s** (`%s`)\n", indent, group.Name, group.FullPath); err != nil {
+			return err
+		}
+		children := subgroups[group.ID]
+		sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+		for _, sub := range children {
+			if countProjects(sub.ID) > 0 {
+				if err := writeGroup(sub, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		projects := groupProjects[group.ID]
+		sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+		for _, project := range projects {
+			if _, err := fmt.Fprintf(w, "%s  - [%s](%s) (`%s`)\n", indent, project.Name, project.WebURL, project.PathWithNamespace); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	roots := subgroups[0]
+	sort.Slice(roots, func(i, j int) bool { return roots[i].Name < roots[j].Name })
+	for _, group := range roots {
+		if countProjects(group.ID) > 0 {
+			if err := writeGroup(group, 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syncedOn describes when the exported cache was synced, in the export's locale and time zone
+func (s exportSource) syncedOn() string {
+	if s.syncedAt.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf(" on %s %s", s.formatting.DateTime(s.syncedAt), s.syncedAt.In(s.formatting.Location).Format("MST"))
+}
+
+// writePathStructure writes the project path tree as nested Markdown lists
+func writePathStructure(w io.Writer, source exportSource, groups []models.CachedGroup, projects []models.CachedProject) error {
+	root := buildProjectPathTree(projects, map[int]bool{}, "")
+
+	if _, err := fmt.Fprintf(w, "# GitLab Project Path Structure\n\n%d projects cached from %s%s.\n\n", CountProjects(root), source.gitlabURL, source.syncedOn()); err != nil {
+		return err
+	}
+
+	var writeNode func(node *PathNode, depth int) error
+	writeNode = func(node *PathNode, depth int) error {
+		indent := strings.Repeat("  ", depth)
+		if node.IsProject {
+			_, err := fmt.Fprintf(w, "%s- [%s](%s)\n", indent, node.Name, node.Project.WebURL)
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s- **%s/** (%d projects)\n", indent, node.Name, CountProjects(node)); err != nil {
+			return err
+		}
+		for _, key := range GetSortedChildKeys(node) {
+			if err := writeNode(node.Children[key], depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, key := range GetSortedChildKeys(root) {
+		if err := writeNode(root.Children[key], 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportRecord is one project in the CSV and JSON exports
+type exportRecord struct {
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	GroupID           int    `json:"group_id"`
+	GroupFullPath     string `json:"group_full_path"`
+	WebURL            string `json:"web_url"`
+}
+
+// exportRecords converts cached projects to export records sorted by path
+func exportRecords(groups []models.CachedGroup, projects []models.CachedProject) []exportRecord {
+	groupPaths := make(map[int]string, len(groups))
+	for _, group := range groups {
+		groupPaths[group.ID] = group.FullPath
+	}
+	records := make([]exportRecord, 0, len(projects))
+	for _, project := range projects {
+		records = append(records, exportRecord{
+			ID:                project.ID,
+			Name:              project.Name,
+			PathWithNamespace: project.PathWithNamespace,
+			GroupID:           project.GroupID,
+			GroupFullPath:     groupPaths[project.GroupID],
+			WebURL:            project.WebURL,
+		})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].PathWithNamespace < records[j].PathWithNamespace })
+	return records
+}
+
+// writeProjectsCSV writes one CSV row per project, separated the way spreadsheets of the locale expect
+func writeProjectsCSV(w io.Writer, formatting models.ExportFormatting, groups []models.CachedGroup, projects []models.CachedProject) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = formatting.Locale.CSVSeparator
+	if err := cw.Write([]string{"id", "name", "path_with_namespace", "group_id", "group_full_path", "web_url"}); err != nil {
+		return err
+	}
+	for _, r := range exportRecords(groups, projects) {
+		if err := cw.Write([]string{strconv.Itoa(r.ID), r.Name, r.PathWithNamespace, strconv.Itoa(r.GroupID), r.GroupFullPath, r.WebURL}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeStatusesCSV writes one CSV row per dashboard status, with dates and coverage in the export's locale
+func writeStatusesCSV(w io.Writer, formatting models.ExportFormatting, statuses []models.RepositoryStatus) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = formatting.Locale.CSVSeparator
+	if err := cw.Write([]string{"path", "ref", "criticality", "status", "pipeline_id", "date", "coverage", "web_url"}); err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		date, coverage := "", ""
+		if !status.Date.IsZero() {
+			date = formatting.DateTime(status.Date)
+		}
+		if status.Coverage != nil {
+			coverage = formatting.Decimal(*status.Coverage, 2)
+		}
+		record := []string{status.RepositoryPath, status.Version, models.NormalizeCriticality(status.Criticality), status.Status,
+			strconv.Itoa(status.PipelineID), date, coverage, status.WebURL}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeProjectsJSON writes a JSON array of projects one element at a time
+func writeProjectsJSON(w io.Writer, groups []models.CachedGroup, projects []models.CachedProject) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i, r := range exportRecords(groups, projects) {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
+
+// writeStructureDOT writes groups and projects as a Graphviz graph
+func writeStructureDOT(w io.Writer, groups []models.CachedGroup, projects []models.CachedProject) error {
+	if _, err := io.WriteString(w, "digraph gitlab {\n  rankdir=LR;\n  node [shape=box];\n"); err != nil {
+		return err
+	}
+	groupIDs := make(map[int]bool, len(groups))
+	for _, group := range groups {
+		groupIDs[group.ID] = true
+		if _, err := fmt.Fprintf(w, "  g%d [label=%s, style=filled, fillcolor=lightgrey];\n", group.ID, strconv.Quote(group.FullPath)); err != nil {
+			return err
+		}
+	}
+	for _, group := range groups {
+		if groupIDs[group.ParentID] {
+			if _, err := fmt.Fprintf(w, "  g%d -> g%d;\n", group.ParentID, group.ID); err != nil {
+				return err
+			}
+		}
+	}
+	for _, project := range projects {
+		if _, err := fmt.Fprintf(w, "  p%d [label=%s];\n", project.ID, strconv.Quote(project.Path)); err != nil {
+			return err
+		}
+		if groupIDs[project.GroupID] {
+			if _, err := fmt.Fprintf(w, "  g%d -> p%d;\n", project.GroupID, project.ID); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := io.WriteString(w, "}\n")
+	return err
+}
+
+// DownloadBundleHandler streams a ZIP archive with every structure export format and a snapshot
+// of the user's current pipeline statuses, for audits and offboarding documentation
+func DownloadBundleHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+
+	formatting, err := exportFormatting(c, userID)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid export settings: "+err.Error())
+	}
+
+	ctx := c.Request().Context()
+	visible, err := visibleProjectIDs(ctx, userID)
+	if err != nil {
+		return c.String(http.StatusForbidden, "Cannot export projects: "+err.Error())
+	}
+
+	groups, err := db.GetCachedGroups()
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to load groups from cache: "+err.Error())
+	}
+	projects, err := db.GetCachedProjects()
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to load projects from cache: "+err.Error())
+	}
+	projects = filterVisibleCachedProjects(projects, visible)
+
+	selectedProjects, err := db.GetSelectedProjects(userID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to load selected projects: "+err.Error())
+	}
+	// Fetch the dashboard before sending headers so GitLab errors don't leave a truncated archive
+	statuses := fetchRepositoryStatuses(gitlab.WithFeature(ctx, gitlab.FeatureStatus), filterVisibleSelectedProjects(selectedProjects, visible), client)
+	snapshot := []map[string]interface{}{}
+	for _, status := range statuses {
+		snapshot = append(snapshot, statusFieldValues(status))
+	}
+
+	now := time.Now()
+	c.Response().Header().Set(echo.HeaderContentType, "application/zip")
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="gitlab-status-export-%s.zip"`, now.Format("20060102-150405")))
+	c.Response().WriteHeader(http.StatusOK)
+
+	gitlabURL := client.URL()
+	source := exportSource{gitlabURL: gitlabURL, syncedAt: lastSyncTime(), formatting: formatting}
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"gitlab-group-structure.md", func(w io.Writer) error { return writeGroupStructure(w, source, groups, projects) }},
+		{"gitlab-path-structure.md", func(w io.Writer) error { return writePathStructure(w, source, groups, projects) }},
+		{"projects.csv", func(w io.Writer) error { return writeProjectsCSV(w, formatting, groups, projects) }},
+		{"projects.json", func(w io.Writer) error { return writeProjectsJSON(w, groups, projects) }},
+		{"gitlab-structure.dot", func(w io.Writer) error { return writeStructureDOT(w, groups, projects) }},
+		{"dashboard-snapshot.csv", func(w io.Writer) error { return writeStatusesCSV(w, formatting, statuses) }},
+		{"dashboard-snapshot.json", func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(map[string]interface{}{
+				"generated_at": now,
+				"username":     session.Values["username"],
+				"gitlab_url":   gitlabURL,
+				"statuses":     snapshot,
+			})
+		}},
+	}
+
+	zw := zip.NewWriter(c.Response())
+	for _, file := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: now})
+		if err == nil {
+			err = file.write(fw)
+		}
+		if err != nil {
+			// The status is already sent; all we can do is stop writing
+			log.Printf("Error streaming export bundle file %s: %v", file.name, err)
+			return nil
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("Error finishing export bundle: %v", err)
+	}
+	return nil
+}
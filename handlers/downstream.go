@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+// maxDownstreamDepth limits how many levels of triggered pipelines are followed
+const maxDownstreamDepth = 3
+
+// downstreamEntry is the downstream pipelines of a project's latest pipeline once all of them finished
+type downstreamEntry struct {
+	pipelineID int
+	bridges    []models.Bridge
+}
+
+// downstreamCache holds the downstream pipelines of the latest pipeline by project ID
+var downstreamCache = newTTLCache[int, downstreamEntry](detailCacheSize)
+
+// downstreamBridges returns the trigger jobs of a pipeline and of the pipelines they started, depth first,
+// or nil when it's disabled. Results are kept until the project has a newer pipeline once the pipeline and
+// all downstream pipelines finished.
+func downstreamBridges(ctx context.Context, client gitlab.Client, projectID int, pipeline *models.Pipeline) []models.Bridge {
+	if !statusDetails[detailDownstream] {
+		return nil
+	}
+	if entry, ok, err := downstreamCache.get(projectID); ok && entry.pipelineID == pipeline.ID {
+		if err != nil {
+			return nil
+		}
+		return entry.bridges
+	}
+
+	bridges, finished, err := collectBridges(ctx, client, projectID, pipeline.ID, 1)
+	if err != nil {
+		downstreamCache.set(projectID, downstreamEntry{pipelineID: pipeline.ID}, err, 0)
+		log.Printf("Error fetching trigger jobs of pipeline %d in project %d: %v", pipeline.ID, projectID, err)
+		return nil
+	}
+
+	if finished && finishedPipelineStatuses[pipeline.Status] {
+		downstreamCache.set(projectID, downstreamEntry{pipelineID: pipeline.ID, bridges: bridges}, nil, finishedPipelineTTL)
+	}
+	return bridges
+}
+
+// collectBridges fetches the trigger jobs of a pipeline and follows their downstream pipelines.
+// It reports whether every downstream pipeline finished and was fetched; downstream pipelines whose
+// trigger jobs can't be fetched are logged and left out.
+func collectBridges(ctx context.Context, client gitlab.Client, projectID, pipelineID, depth int) ([]models.Bridge, bool, error) {
+	bridges, err := client.FetchPipelineBridges(ctx, strconv.Itoa(projectID), pipelineID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var all []models.Bridge
+	finished := true
+	for _, bridge := range bridges {
+		all = append(all, bridge)
+		downstream := bridge.DownstreamPipeline
+		if downstream == nil {
+			if !finishedPipelineStatuses[bridge.Status] {
+				finished = false
+			}
+			continue
+		}
+		if !finishedPipelineStatuses[downstream.Status] {
+			finished = false
+		}
+		if depth < maxDownstreamDepth {
+			nested, nestedFinished, err := collectBridges(ctx, client, downstream.ProjectID, downstream.ID, depth+1)
+			if err != nil {
+				log.Printf("Error fetching trigger jobs of pipeline %d in project %d: %v", downstream.ID, downstream.ProjectID, err)
+			}
+			all = append(all, nested...)
+			finished = finished && nestedFinished
+		}
+	}
+	return all, finished, nil
+}
+
+// aggregateStatus combines the status of a pipeline with the statuses of its downstream pipelines,
+// so a parent pipeline isn't reported as passed while a pipeline it triggered fails or still runs.
+// Downstream failures of trigger jobs that are allowed to fail are ignored.
+func aggregateStatus(own string, bridges []models.Bridge) string {
+	aggregated := own
+	aggregatedRank := stageStatusRank[jobStageStatus(models.Job{Status: own})]
+	for _, bridge := range bridges {
+		if bridge.DownstreamPipeline == nil {
+			continue
+		}
+		status := jobStageStatus(models.Job{Status: bridge.DownstreamPipeline.Status, AllowFailure: bridge.AllowFailure})
+		if rank, ok := stageStatusRank[status]; ok && rank > aggregatedRank {
+			aggregated, aggregatedRank = status, rank
+		}
+	}
+	return aggregated
+}
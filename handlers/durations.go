@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/models"
+	"gitlab-status/templates"
+)
+
+// durationChartPipelines is how many of the newest stored pipelines are charted per project
+const durationChartPipelines = 20
+
+// recordPipelineTiming stores how long a finished pipeline waited for runners and ran
+func recordPipelineTiming(projectID int, pipeline *models.Pipeline) {
+	timing := &models.PipelineTiming{
+		PipelineID:     pipeline.ID,
+		ProjectID:      projectID,
+		Ref:            pipeline.Ref,
+		Status:         pipeline.Status,
+		WebURL:         pipeline.WebURL,
+		Duration:       pipeline.Duration,
+		QueuedDuration: pipeline.QueuedDuration,
+		PipelineDate:   pipeline.CreatedAt,
+	}
+	if err := db.SavePipelineTiming(timing); err != nil {
+		log.Printf("Error storing pipeline timing: %v", err)
+	}
+}
+
+// DurationsHandler charts the time the recent pipelines of the selected projects spent waiting
+// for runners against the time they spent running
+func DurationsHandler(c echo.Context, store sessions.Store) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+	username := session.Values["username"].(string)
+
+	selectedProjects, err := db.GetSelectedProjects(userID)
+	if err != nil {
+		log.Printf("Error fetching selected projects: %v", err)
+		return templates.Durations(username, nil, "Failed to load selected projects").Render(c.Request().Context(), c.Response().Writer)
+	}
+	visible, err := visibleProjectIDs(c.Request().Context(), userID)
+	if err != nil {
+		return templates.Durations(username, nil, "Cannot show projects: "+err.Error()).Render(c.Request().Context(), c.Response().Writer)
+	}
+	selectedProjects = filterVisibleSelectedProjects(selectedProjects, visible)
+
+	projects := make([]models.ProjectTimings, 0, len(selectedProjects))
+	for _, selectedProject := range selectedProjects {
+		project := models.ProjectTimings{
+			ProjectName: selectedProject.Path,
+			ProjectPath: selectedProject.Path,
+		}
+		if cachedProject, err := db.GetCachedProject(selectedProject.ProjectID); err == nil {
+			project.ProjectName = cachedProject.Name
+			project.ProjectPath = cachedProject.PathWithNamespace
+			project.ProjectURL = cachedProject.WebURL
+		}
+		project.Timings, err = db.GetPipelineTimings(selectedProject.ProjectID, durationChartPipelines)
+		if err != nil {
+			log.Printf("Error loading pipeline timings: %v", err)
+			project.Error = "Failed to load pipeline timings"
+		}
+		projects = append(projects, project)
+	}
+
+	return templates.Durations(username, projects, "").Render(c.Request().Context(), c.Response().Writer)
+}
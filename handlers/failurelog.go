@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+	"gitlab-status/templates"
+)
+
+// failureLogLines is how many lines at the end of a failed job's log are shown
+const failureLogLines = 100
+
+// firstFailedJob returns the earliest job of a pipeline that failed without being allowed to, or nil
+func firstFailedJob(jobs []models.Job) *models.Job {
+	var first *models.Job
+	for i, job := range jobs {
+		if job.Status != "failed" || job.AllowFailure {
+			continue
+		}
+		if first == nil || job.ID < first.ID {
+			first = &jobs[i]
+		}
+	}
+	return first
+}
+
+// FailureLogHandler renders the end of the log of the first failed job of a pipeline,
+// so the failure reason can be read without opening GitLab
+func FailureLogHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+
+	projectID, err := strconv.Atoi(c.Param("projectID"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "Invalid project ID")
+	}
+	pipelineID, err := strconv.Atoi(c.Param("pipelineID"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "Invalid pipeline ID")
+	}
+
+	ctx := c.Request().Context()
+	visible, err := visibleProjectIDs(ctx, userID)
+	if err != nil {
+		return c.String(http.StatusForbidden, err.Error())
+	}
+	if _, err := db.GetCachedProject(projectID); err != nil || (visible != nil && !visible[projectID]) {
+		return c.String(http.StatusNotFound, "Project not found")
+	}
+
+	ctx = gitlab.WithFeature(ctx, gitlab.FeatureStatus)
+	jobs, err := client.FetchPipelineJobs(ctx, strconv.Itoa(projectID), pipelineID)
+	if err != nil {
+		log.Printf("Error fetching jobs of pipeline %d in project %d: %v", pipelineID, projectID, err)
+		return templates.FailureLog(nil, "", describeGitLabError(err)).Render(ctx, c.Response().Writer)
+	}
+	job := firstFailedJob(jobs)
+	if job == nil {
+		return templates.FailureLog(nil, "", "The pipeline has no failed jobs").Render(ctx, c.Response().Writer)
+	}
+
+	trace, err := client.FetchJobTrace(ctx, strconv.Itoa(projectID), job.ID, failureLogLines)
+	if err != nil {
+		log.Printf("Error fetching log of job %d in project %d: %v", job.ID, projectID, err)
+		return templates.FailureLog(job, "", describeGitLabError(err)).Render(ctx, c.Response().Writer)
+	}
+	return templates.FailureLog(job, trace, "").Render(ctx, c.Response().Writer)
+}
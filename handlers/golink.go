@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+// Deep link targets for /go/:projectID/<target>
+const (
+	DeepLinkLatest      = "latest"
+	DeepLinkLastSuccess = "last-success"
+)
+
+// DeepLinkHandler redirects to a project's latest or last successful pipeline in GitLab, so chat
+// messages and docs can link stably through this service. When the pipeline can't be resolved
+// it falls back to the project's pipeline list.
+func DeepLinkHandler(c echo.Context, store sessions.Store, client gitlab.Client, target string) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+
+	projectID, err := strconv.Atoi(c.Param("projectID"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "Invalid project ID")
+	}
+
+	ctx := c.Request().Context()
+	visible, err := visibleProjectIDs(ctx, userID)
+	if err != nil {
+		return c.String(http.StatusForbidden, err.Error())
+	}
+	cachedProject, err := db.GetCachedProject(projectID)
+	if err != nil || (visible != nil && !visible[projectID]) {
+		return c.String(http.StatusNotFound, "Project not found")
+	}
+
+	// Follow the branch the user tracks for the project, if any
+	ref := c.QueryParam("ref")
+	if ref == "" {
+		if selectedProjects, err := db.GetSelectedProjects(userID); err == nil {
+			for _, sp := range selectedProjects {
+				if sp.ProjectID == projectID {
+					ref = sp.Ref
+				}
+			}
+		}
+	}
+
+	var pipeline *models.Pipeline
+	ctx = gitlab.WithFeature(ctx, gitlab.FeatureStatus)
+	switch target {
+	case DeepLinkLatest:
+		pipeline, err = client.FetchLatestPipeline(ctx, strconv.Itoa(projectID), ref)
+		if errors.Is(err, gitlab.ErrNoPipelines) {
+			err = nil
+		}
+	case DeepLinkLastSuccess:
+		pipeline, err = client.FetchLastSuccessPipeline(ctx, strconv.Itoa(projectID), ref)
+	}
+	if err != nil {
+		log.Printf("Error resolving %s pipeline for project %d: %v", target, projectID, err)
+	}
+
+	if err := db.RecordDeepLinkHit(projectID, target); err != nil {
+		log.Printf("Error recording deep link to project %d: %v", projectID, err)
+	}
+
+	if pipeline == nil || pipeline.WebURL == "" {
+		return c.Redirect(http.StatusFound, cachedProject.WebURL+"/-/pipelines")
+	}
+	return c.Redirect(http.StatusFound, pipeline.WebURL)
+}
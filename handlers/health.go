@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+	"gitlab-status/templates"
+)
+
+var (
+	databaseMu sync.RWMutex
+	// databaseDownSince is when the database stopped answering, zero while it's available
+	databaseDownSince time.Time
+	databaseErr       error
+
+	// userSelections keeps the projects each user's status page showed last, so it can still be
+	// rendered from the last known statuses while the database is unavailable
+	userSelectionsMu sync.RWMutex
+	userSelections   = make(map[int64][]models.SelectedProject)
+)
+
+// RecordDatabaseHealth records the result of a database check. While it fails, pages are served
+// from memory by DatabaseFallbackMiddleware and /healthz reports the database as down.
+func RecordDatabaseHealth(err error) {
+	databaseMu.Lock()
+	defer databaseMu.Unlock()
+	switch {
+	case err != nil && databaseDownSince.IsZero():
+		log.Printf("Database unavailable, serving the last known statuses from memory: %v", err)
+		databaseDownSince = time.Now()
+	case err == nil && !databaseDownSince.IsZero():
+		log.Printf("Database available again after %v", time.Since(databaseDownSince).Round(time.Second))
+		databaseDownSince = time.Time{}
+	}
+	databaseErr = err
+}
+
+// databaseDown returns since when and why the database is unavailable, the zero time while it's available
+func databaseDown() (time.Time, error) {
+	databaseMu.RLock()
+	defer databaseMu.RUnlock()
+	return databaseDownSince, databaseErr
+}
+
+// rememberSelections keeps the projects a user's status page showed
+func rememberSelections(userID int64, selectedProjects []models.SelectedProject) {
+	userSelectionsMu.Lock()
+	defer userSelectionsMu.Unlock()
+	userSelections[userID] = selectedProjects
+}
+
+// writeHealthMetrics appends whether the database answers in the Prometheus text format
+func writeHealthMetrics(b *strings.Builder) {
+	up := 1
+	if since, _ := databaseDown(); !since.IsZero() {
+		up = 0
+	}
+	fmt.Fprintf(b, "# HELP gitlab_status_database_up 1 if the last database check succeeded.\n# TYPE gitlab_status_database_up gauge\ngitlab_status_database_up %d\n", up)
+}
+
+// HealthHandler reports whether the database answers and GitLab is reachable. It answers 503 while
+// the database is unavailable; an unreachable GitLab keeps 200, as the last known statuses are served.
+// It needs no login.
+func HealthHandler(c echo.Context) error {
+	health := map[string]interface{}{
+		"status":   "ok",
+		"database": "ok",
+		"gitlab":   "ok",
+	}
+	code := http.StatusOK
+	if gitlab.CircuitOpen() {
+		health["status"] = "degraded"
+		health["gitlab"] = "unreachable"
+	}
+	if since, err := databaseDown(); !since.IsZero() {
+		code = http.StatusServiceUnavailable
+		health["status"] = "unavailable"
+		health["database"] = err.Error()
+		health["database_down_since"] = since
+	}
+	return c.JSON(code, health)
+}
+
+// DatabaseFallbackMiddleware serves a minimal status page from memory while the database is
+// unavailable, instead of failing every page. The status page of logged-in users shows the last
+// known statuses of their projects, API clients get 503, and the endpoints needing no login keep working.
+func DatabaseFallbackMiddleware(store sessions.Store) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			since, _ := databaseDown()
+			if since.IsZero() || c.Path() == "/healthz" || c.Path() == "/metrics" || c.Path() == "/version" || c.Path() == "/favicon.ico" {
+				return next(c)
+			}
+			if strings.HasPrefix(c.Path(), "/api/") {
+				return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "database unavailable"})
+			}
+
+			// Cookie and Redis sessions still know logged-in users; sessions kept in the database don't load
+			var statuses []models.RepositoryStatus
+			username := ""
+			session, _ := store.Get(c.Request(), "gitlab-status-session")
+			if userID, ok := session.Values["user_id"].(int64); ok {
+				username, _ = session.Values["username"].(string)
+				userSelectionsMu.RLock()
+				selectedProjects := userSelections[userID]
+				userSelectionsMu.RUnlock()
+				for _, selectedProject := range selectedProjects {
+					// GitLab may be fine, so these aren't marked stale; the warning explains their age
+					if status, ok := rememberedStatus(selectedProject.ProjectID, selectedProject.Ref); ok {
+						status.Criticality = models.NormalizeCriticality(selectedProject.Criticality)
+						statuses = append(statuses, status)
+					}
+				}
+				if anonymize, _ := session.Values["anonymize"].(bool); anonymize {
+					statuses = anonymizeStatuses(statuses)
+					username = "demo"
+				}
+			}
+
+			// Only the status page itself is answered normally, so it keeps refreshing
+			code := http.StatusServiceUnavailable
+			if c.Path() == "/" && c.Request().Method == http.MethodGet {
+				code = http.StatusOK
+			}
+			warning := fmt.Sprintf("The database is unavailable since %s. Showing the last known pipeline statuses; settings, logins and other pages are back once it recovers.",
+				since.Format("15:04"))
+			if c.Request().Header.Get("HX-Request") != "" && code != http.StatusOK {
+				return c.String(code, "Database unavailable")
+			}
+			c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+			c.Response().WriteHeader(code)
+			if c.Request().Header.Get("HX-Request") != "" {
+				return templates.StatusTable(statuses).Render(c.Request().Context(), c.Response().Writer)
+			}
+			return templates.Degraded(username, warning, statuses).Render(c.Request().Context(), c.Response().Writer)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gitlab-status/db"
+	"gitlab-status/models"
+)
+
+// maxRecordedPipelineStates bounds how many pipelines are remembered as already stored
+const maxRecordedPipelineStates = 10000
+
+var (
+	recordedPipelinesMu sync.Mutex
+	// recordedPipelines is the state each pipeline was last stored in, so polling the same
+	// pipelines again doesn't write them again
+	recordedPipelines = make(map[int]string)
+)
+
+// pipelineState identifies what of a pipeline is stored in the history
+func pipelineState(pipeline models.Pipeline) string {
+	return fmt.Sprintf("%s %d %t", pipeline.Status, pipeline.UpdatedAt.UnixNano(), pipeline.FinishedAt != nil)
+}
+
+// recordPipelineHistory stores pipelines of a project seen while polling GitLab in the pipeline
+// history, skipping the ones that didn't change since they were last stored. Durations and the
+// finish time are only known from the details of single pipelines.
+func recordPipelineHistory(projectID int, pipelines ...models.Pipeline) {
+	now := time.Now()
+	records := make([]models.PipelineRecord, 0, len(pipelines))
+	recordedPipelinesMu.Lock()
+	if len(recordedPipelines) > maxRecordedPipelineStates {
+		// Forgetting them only means they are written once more
+		clear(recordedPipelines)
+	}
+	for _, pipeline := range pipelines {
+		state := pipelineState(pipeline)
+		if pipeline.ID == 0 || recordedPipelines[pipeline.ID] == state {
+			continue
+		}
+		recordedPipelines[pipeline.ID] = state
+		record := models.PipelineRecord{
+			PipelineID:  pipeline.ID,
+			ProjectID:   projectID,
+			Ref:         pipeline.Ref,
+			Status:      pipeline.Status,
+			Source:      pipeline.Source,
+			WebURL:      pipeline.WebURL,
+			CreatedAt:   pipeline.CreatedAt,
+			UpdatedAt:   pipeline.UpdatedAt,
+			FirstSeenAt: now,
+		}
+		if pipeline.FinishedAt != nil {
+			record.Duration = &pipeline.Duration
+			record.QueuedDuration = &pipeline.QueuedDuration
+			record.FinishedAt = *pipeline.FinishedAt
+		}
+		records = append(records, record)
+	}
+	recordedPipelinesMu.Unlock()
+
+	if err := db.RecordPipelines(records); err != nil {
+		log.Printf("Error recording pipeline history of project %d: %v", projectID, err)
+		// Try again the next time they are seen
+		recordedPipelinesMu.Lock()
+		for _, record := range records {
+			delete(recordedPipelines, record.PipelineID)
+		}
+		recordedPipelinesMu.Unlock()
+	}
+}
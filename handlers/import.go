@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+const (
+	// importRequestInterval spaces the GitLab API calls of a history import, so it doesn't
+	// starve the status page of the instance's rate limit
+	importRequestInterval = 250 * time.Millisecond
+	// maxImportMonths is the longest history that can be imported at once
+	maxImportMonths = 24
+)
+
+var (
+	historyImportMu sync.Mutex
+	historyImport   models.HistoryImport
+)
+
+// currentHistoryImport returns a copy of the progress of the running or last history import
+func currentHistoryImport() models.HistoryImport {
+	historyImportMu.Lock()
+	defer historyImportMu.Unlock()
+	progress := historyImport
+	progress.Paths = append([]string(nil), historyImport.Paths...)
+	progress.Errors = append([]string(nil), historyImport.Errors...)
+	return progress
+}
+
+// updateHistoryImport changes the progress of the history import
+func updateHistoryImport(update func(progress *models.HistoryImport)) {
+	historyImportMu.Lock()
+	defer historyImportMu.Unlock()
+	update(&historyImport)
+}
+
+// ImportHistoryHandler starts importing the finished pipelines of the given project paths over the
+// last months, storing their coverage and timings as if the status page had seen them finish
+func ImportHistoryHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	username, ok := currentAdmin(c, store)
+	if !ok {
+		return c.String(http.StatusForbidden, "Admin access required")
+	}
+
+	months, err := strconv.Atoi(c.FormValue("months"))
+	if err != nil || months < 1 || months > maxImportMonths {
+		return renderAdminPage(c, username, client, fmt.Sprintf("Import between 1 and %d months", maxImportMonths))
+	}
+	var projects []models.CachedProject
+	for _, path := range strings.Split(c.FormValue("paths"), "\n") {
+		path = strings.Trim(strings.TrimSpace(path), "/")
+		if path == "" {
+			continue
+		}
+		project, err := db.GetCachedProjectByPath(path)
+		if err != nil {
+			return renderAdminPage(c, username, client, fmt.Sprintf("Unknown project %q, sync the GitLab structure first", path))
+		}
+		projects = append(projects, *project)
+	}
+	if len(projects) == 0 {
+		return renderAdminPage(c, username, client, "List at least one project path to import")
+	}
+
+	historyImportMu.Lock()
+	if historyImport.Running {
+		historyImportMu.Unlock()
+		return renderAdminPage(c, username, client, "A history import is already running")
+	}
+	historyImport = models.HistoryImport{
+		Running:   true,
+		Since:     time.Now().AddDate(0, -months, 0),
+		StartedBy: username,
+		StartedAt: time.Now(),
+	}
+	for _, project := range projects {
+		historyImport.Paths = append(historyImport.Paths, project.PathWithNamespace)
+	}
+	since, startedAt := historyImport.Since, historyImport.StartedAt
+	historyImportMu.Unlock()
+
+	log.Printf("History import of %d projects since %s started by %s", len(projects), since.Format("2006-01-02"), username)
+	go func() {
+		if err := RunRecovered(func() {
+			runHistoryImport(gitlab.WithFeature(context.Background(), gitlab.FeatureImport), client, projects, since)
+		}); err != nil {
+			updateHistoryImport(func(progress *models.HistoryImport) {
+				progress.Running = false
+				progress.FinishedAt = time.Now()
+				progress.Errors = append(progress.Errors, err.Error())
+			})
+			RecordJobRun(JobHistoryImport, startedAt, 0, err)
+		}
+	}()
+	return c.Redirect(http.StatusSeeOther, "/admin")
+}
+
+// runHistoryImport pages through the finished pipelines of each project and stores the details of
+// the ones not stored yet, one API call per importRequestInterval
+func runHistoryImport(ctx context.Context, client gitlab.Client, projects []models.CachedProject, since time.Time) {
+	startedAt := time.Now()
+	throttle := time.NewTicker(importRequestInterval)
+	defer throttle.Stop()
+
+	for _, project := range projects {
+		updateHistoryImport(func(progress *models.HistoryImport) { progress.Current = project.PathWithNamespace })
+		projectID := strconv.Itoa(project.ID)
+
+		for page := 1; ; page++ {
+			<-throttle.C
+			pipelines, err := client.FetchFinishedPipelines(ctx, projectID, since, page)
+			if err != nil {
+				log.Printf("Error importing pipelines of %s: %v", project.PathWithNamespace, err)
+				updateHistoryImport(func(progress *models.HistoryImport) {
+					progress.Errors = append(progress.Errors, project.PathWithNamespace+": "+describeGitLabError(err))
+				})
+				break
+			}
+
+			for _, pipeline := range pipelines {
+				if stored, err := db.GetPipelineTiming(pipeline.ID); err == nil && stored != nil {
+					updateHistoryImport(func(progress *models.HistoryImport) { progress.Skipped++ })
+					continue
+				}
+				<-throttle.C
+				details, err := client.FetchPipeline(ctx, projectID, pipeline.ID)
+				if err != nil {
+					log.Printf("Error importing pipeline %d of %s: %v", pipeline.ID, project.PathWithNamespace, err)
+					continue
+				}
+				recordPipelineDetails(project.ID, details)
+				updateHistoryImport(func(progress *models.HistoryImport) { progress.Imported++ })
+			}
+			if len(pipelines) < gitlab.PipelineHistoryPageSize {
+				break
+			}
+		}
+	}
+
+	var imported int
+	var importErr error
+	updateHistoryImport(func(progress *models.HistoryImport) {
+		progress.Running = false
+		progress.Current = ""
+		progress.FinishedAt = time.Now()
+		log.Printf("History import finished: %d pipelines imported, %d already stored", progress.Imported, progress.Skipped)
+		imported = progress.Imported
+		if len(progress.Errors) > 0 {
+			importErr = errors.New(strings.Join(progress.Errors, "; "))
+		}
+	})
+	RecordJobRun(JobHistoryImport, startedAt, imported, importErr)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"time"
+
+	"gitlab-status/db"
+	"gitlab-status/models"
+)
+
+// autoIncidentDeclarer is recorded as the declarer of incidents opened from correlated failures
+const autoIncidentDeclarer = "automatic"
+
+var (
+	// autoIncidentThreshold is how many projects of a group must fail to open an incident, 0 disables it
+	autoIncidentThreshold int
+	// autoIncidentWindow is how close together the failed pipelines must have started
+	autoIncidentWindow = 30 * time.Minute
+)
+
+// SetAutoIncidents opens incidents automatically when at least threshold projects of the same group
+// fail within window, which usually means a shared runner or dependency is down
+func SetAutoIncidents(threshold int, window time.Duration) {
+	autoIncidentThreshold = threshold
+	autoIncidentWindow = window
+	if threshold > 0 {
+		log.Printf("Opening incidents when %d projects of a group fail within %v", threshold, window)
+	}
+}
+
+// openCorrelatedIncidents groups recently failed projects by their parent group and declares an
+// incident for every group with at least autoIncidentThreshold failures that isn't covered yet
+func openCorrelatedIncidents(statuses []models.RepositoryStatus, now time.Time) {
+	if autoIncidentThreshold <= 0 {
+		return
+	}
+
+	failedByGroup := make(map[string][]string)
+	for _, status := range statuses {
+		if status.Status != "failed" || status.Stale || now.Sub(status.Date) > autoIncidentWindow {
+			continue
+		}
+		group := path.Dir(status.RepositoryPath)
+		failedByGroup[group] = append(failedByGroup[group], status.RepositoryPath)
+	}
+
+	active, err := db.GetActiveIncidents()
+	if err != nil {
+		log.Printf("Error fetching active incidents: %v", err)
+		return
+	}
+
+	groups := make([]string, 0, len(failedByGroup))
+	for group := range failedByGroup {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	for _, group := range groups {
+		projects := failedByGroup[group]
+		if group == "." || len(projects) < autoIncidentThreshold || incidentCovers(active, projects) {
+			continue
+		}
+
+		incident := models.Incident{
+			Title:         fmt.Sprintf("%d projects failing in %s", len(projects), group),
+			AffectedPaths: group,
+			StartedAt:     now,
+			DeclaredBy:    autoIncidentDeclarer,
+		}
+		if err := db.CreateIncident(&incident); err != nil {
+			log.Printf("Error opening incident for %s: %v", group, err)
+			continue
+		}
+		active = append(active, incident)
+		log.Printf("Opened incident %d: %s (%v)", incident.ID, incident.Title, projects)
+	}
+}
+
+// incidentCovers reports whether all project paths are affected by one of the incidents
+func incidentCovers(incidents []models.Incident, projectPaths []string) bool {
+	for _, incident := range incidents {
+		covered := true
+		for _, projectPath := range projectPaths {
+			if !incident.Affects(projectPath) {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
+
+// applyIncidents marks the statuses affected by active incidents and moves them to the top,
+// grouped per incident, keeping the order within each group
+func applyIncidents(statuses []models.RepositoryStatus, incidents []models.Incident) []models.RepositoryStatus {
+	if len(incidents) == 0 {
+		return statuses
+	}
+	grouped := make([]models.RepositoryStatus, 0, len(statuses))
+	affected := make(map[int]bool)
+	for _, incident := range incidents {
+		for i, status := range statuses {
+			if !affected[i] && incident.Affects(status.RepositoryPath) {
+				affected[i] = true
+				status.Incident = incident.Title
+				grouped = append(grouped, status)
+			}
+		}
+	}
+	for i, status := range statuses {
+		if !affected[i] {
+			grouped = append(grouped, status)
+		}
+	}
+	return grouped
+}
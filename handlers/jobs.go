@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/models"
+)
+
+// Background jobs whose runs are recorded
+const (
+	JobFullSync        = "full-sync"
+	JobIncrementalSync = "incremental-sync"
+	JobStatusSnapshot  = "status-snapshot"
+	JobHistoryImport   = "history-import"
+	JobRetentionPrune  = "retention-prune"
+	// The loops running the periodic jobs, whose runs are only recorded when they panic
+	JobSyncLoop      = "sync-loop"
+	JobSnapshotLoop  = "snapshot-loop"
+	JobHealthLoop    = "health-loop"
+	JobRetentionLoop = "retention-loop"
+)
+
+// jobRunRetention is how long job runs are kept for the admin page
+const jobRunRetention = 30 * 24 * time.Hour
+
+// jobMetrics are the counters of one background job since startup
+type jobMetrics struct {
+	runs          int
+	failures      int
+	items         int
+	lastDuration  time.Duration
+	lastSuccessAt time.Time
+}
+
+var (
+	jobMetricsMu sync.Mutex
+	jobMetricsBy = make(map[string]*jobMetrics)
+)
+
+// RecordJobRun records a finished run of a background job in the database and the metrics,
+// logging it when it failed
+func RecordJobRun(job string, startedAt time.Time, items int, err error) {
+	duration := time.Since(startedAt)
+	run := &models.JobRun{
+		Job:        job,
+		StartedAt:  startedAt,
+		DurationMs: duration.Milliseconds(),
+		Items:      items,
+	}
+	if err != nil {
+		run.Error = err.Error()
+		log.Printf("Background job %s failed after %v: %v", job, duration.Round(time.Millisecond), err)
+	}
+
+	jobMetricsMu.Lock()
+	metrics, ok := jobMetricsBy[job]
+	if !ok {
+		metrics = &jobMetrics{}
+		jobMetricsBy[job] = metrics
+	}
+	metrics.runs++
+	metrics.items += items
+	metrics.lastDuration = duration
+	if err != nil {
+		metrics.failures++
+	} else {
+		metrics.lastSuccessAt = startedAt.Add(duration)
+	}
+	jobMetricsMu.Unlock()
+
+	if err := db.RecordJobRun(run, time.Now().Add(-jobRunRetention)); err != nil {
+		log.Printf("Error recording job run: %v", err)
+	}
+}
+
+// RunRecovered runs job and returns a panic in it as an error, logging the stack trace
+func RunRecovered(job func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("PANIC: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	job()
+	return nil
+}
+
+// MetricsHandler exposes the background job counters and the database health in the Prometheus
+// text format, followed by the pipeline status of the tracked projects when enabled and the
+// request is authorized to see them
+func MetricsHandler(c echo.Context, store sessions.Store) error {
+	jobMetricsMu.Lock()
+	jobs := make([]string, 0, len(jobMetricsBy))
+	for job := range jobMetricsBy {
+		jobs = append(jobs, job)
+	}
+	sort.Strings(jobs)
+
+	var b strings.Builder
+	metric := func(name, kind, help string, value func(*jobMetrics) float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, job := range jobs {
+			fmt.Fprintf(&b, "%s{job=%q} %g\n", name, job, value(jobMetricsBy[job]))
+		}
+	}
+	metric("gitlab_status_job_runs_total", "counter", "Runs of the background job.",
+		func(m *jobMetrics) float64 { return float64(m.runs) })
+	metric("gitlab_status_job_failures_total", "counter", "Failed runs of the background job.",
+		func(m *jobMetrics) float64 { return float64(m.failures) })
+	metric("gitlab_status_job_items_total", "counter", "Items processed by the background job.",
+		func(m *jobMetrics) float64 { return float64(m.items) })
+	metric("gitlab_status_job_last_duration_seconds", "gauge", "Duration of the last run of the background job.",
+		func(m *jobMetrics) float64 { return m.lastDuration.Seconds() })
+	metric("gitlab_status_job_last_success_timestamp_seconds", "gauge", "Unix time the background job last succeeded, 0 if it hasn't.",
+		func(m *jobMetrics) float64 {
+			if m.lastSuccessAt.IsZero() {
+				return 0
+			}
+			return float64(m.lastSuccessAt.Unix())
+		})
+	jobMetricsMu.Unlock()
+	writeHealthMetrics(&b)
+	writeCallBudgetMetrics(&b)
+	if pipelineMetricsAuthorized(c, store) {
+		writePipelineMetrics(&b)
+	}
+
+	return c.Blob(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
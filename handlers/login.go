@@ -2,34 +2,36 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/sessions"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
 
 	"gitlab-status/db"
+	"gitlab-status/gitlab"
 	"gitlab-status/templates"
 )
 
 // LoginPageHandler handles the login page request
 func LoginPageHandler(c echo.Context) error {
-	return templates.Login("").Render(c.Request().Context(), c.Response().Writer)
+	return templates.Login(csrfToken(c), "").Render(c.Request().Context(), c.Response().Writer)
 }
 
-// LoginSubmitHandler handles the login form submission
-func LoginSubmitHandler(c echo.Context, store *sessions.CookieStore) error {
+// LoginSubmitHandler handles the login form submission and starts warming the user's statuses
+func LoginSubmitHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
 	username := c.FormValue("username")
 	password := c.FormValue("password")
 
 	// Check if user exists
 	user, err := db.GetUserByName(username)
 	if err != nil {
-		return templates.Login("Invalid username or password").Render(c.Request().Context(), c.Response().Writer)
+		return templates.Login(csrfToken(c), "Invalid username or password").Render(c.Request().Context(), c.Response().Writer)
 	}
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return templates.Login("Invalid username or password").Render(c.Request().Context(), c.Response().Writer)
+		return templates.Login(csrfToken(c), "Invalid username or password").Render(c.Request().Context(), c.Response().Writer)
 	}
 
 	// Create session
@@ -38,42 +40,47 @@ func LoginSubmitHandler(c echo.Context, store *sessions.CookieStore) error {
 	session.Values["username"] = username
 	session.Values["user_id"] = user.ID
 	if err := session.Save(c.Request(), c.Response()); err != nil {
-		return templates.Login("Failed to create session").Render(c.Request().Context(), c.Response().Writer)
+		return templates.Login(csrfToken(c), "Failed to create session").Render(c.Request().Context(), c.Response().Writer)
 	}
+	prewarmStatuses(user.ID, client)
 
 	// Redirect to status page
 	return c.Redirect(http.StatusSeeOther, "/")
 }
 
 // LogoutHandler handles the logout request
-func LogoutHandler(c echo.Context, store *sessions.CookieStore) error {
+func LogoutHandler(c echo.Context, store sessions.Store) error {
 	session, _ := store.Get(c.Request(), "gitlab-status-session")
 	session.Values["logged_in"] = false
 	session.Values["username"] = ""
+	// Also deletes sessions kept in the database
+	session.Options.MaxAge = -1
 	session.Save(c.Request(), c.Response())
 	return c.Redirect(http.StatusSeeOther, "/login")
 }
 
 // AuthMiddleware checks if a user is authenticated
-func AuthMiddleware(store *sessions.CookieStore) echo.MiddlewareFunc {
+func AuthMiddleware(store sessions.Store) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			// Skip authentication for login page and static assets
-			if c.Path() == "/login" || c.Path() == "/favicon.ico" {
+			// Skip authentication for login page, static assets, signed registration requests,
+			// the metrics scraped by Prometheus, whose per-project series need an admin session or the
+			// metrics token (see pipelineMetricsAuthorized), the version and health
+			if c.Path() == "/login" || c.Path() == "/favicon.ico" || c.Path() == "/api/v1/register" || c.Path() == "/metrics" || c.Path() == "/version" || c.Path() == "/healthz" {
 				return next(c)
 			}
 
 			session, err := store.Get(c.Request(), "gitlab-status-session")
 			if err != nil {
 				// Session error, redirect to login
-				return c.Redirect(http.StatusSeeOther, "/login")
+				return unauthenticated(c)
 			}
 
 			// Check if user is logged in
 			isLoggedIn, ok := session.Values["logged_in"].(bool)
 			if !ok || !isLoggedIn {
 				// Not logged in, redirect to login
-				return c.Redirect(http.StatusSeeOther, "/login")
+				return unauthenticated(c)
 			}
 
 			// Continue with the request
@@ -81,3 +88,11 @@ func AuthMiddleware(store *sessions.CookieStore) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// unauthenticated redirects browsers to the login page and answers API clients with 401
+func unauthenticated(c echo.Context) error {
+	if strings.HasPrefix(c.Path(), "/api/") {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+	return c.Redirect(http.StatusSeeOther, "/login")
+}
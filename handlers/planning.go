@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+// planningTTL is how long the planning context of a project is reused; iterations and their
+// issues change far less often than pipelines
+const planningTTL = 10 * time.Minute
+
+var (
+	// planningEnabled looks up the current iteration and epics of failing projects
+	planningEnabled bool
+
+	// planningCache holds the planning context by project ID, nil for projects without any
+	planningCache = newTTLCache[int, *models.PlanningContext](detailCacheSize)
+)
+
+// SetPlanningContext sets whether failing projects are linked to the work planned in their group's
+// current iteration. It needs iterations, and epics for those, which are GitLab Premium features.
+func SetPlanningContext(enabled bool) {
+	planningEnabled = enabled
+	if enabled {
+		log.Println("Linking failing projects to their current iteration and epics")
+	}
+}
+
+// planningContext returns the current iteration of a failing project's group with the project's
+// open issues in it and their epics, or nil when it's disabled, the pipeline didn't fail or the
+// group has no current iteration. Failed lookups are cached too, so instances without iterations
+// aren't asked on every refresh.
+func planningContext(ctx context.Context, client gitlab.Client, project models.CachedProject, status string) *models.PlanningContext {
+	if !planningEnabled || status != "failed" || project.GroupID == 0 {
+		return nil
+	}
+	if planning, ok, err := planningCache.get(project.ID); ok {
+		if err != nil {
+			return nil
+		}
+		return planning
+	}
+
+	planning, err := fetchPlanningContext(ctx, client, project)
+	planningCache.set(project.ID, planning, err, planningTTL)
+	if err != nil {
+		log.Printf("Error fetching the current iteration of project %d: %v", project.ID, err)
+		return nil
+	}
+	return planning
+}
+
+// fetchPlanningContext looks up the planning context of a project, nil when its group has no current iteration
+func fetchPlanningContext(ctx context.Context, client gitlab.Client, project models.CachedProject) (*models.PlanningContext, error) {
+	iterations, err := client.FetchCurrentIterations(ctx, strconv.Itoa(project.GroupID))
+	if err != nil || len(iterations) == 0 {
+		return nil, err
+	}
+	// Prefer the cadence of the project's own group over the ones of its ancestor groups
+	iteration := iterations[0]
+	for _, candidate := range iterations {
+		if candidate.GroupID == project.GroupID {
+			iteration = candidate
+			break
+		}
+	}
+
+	issues, err := client.FetchIterationIssues(ctx, strconv.Itoa(project.ID), iteration.ID)
+	if err != nil {
+		return nil, err
+	}
+	planning := &models.PlanningContext{
+		Iteration: iteration,
+		IssuesURL: fmt.Sprintf("%s/-/issues?iteration_id=%d", project.WebURL, iteration.ID),
+	}
+	seen := make(map[int]bool)
+	for _, issue := range issues {
+		issue.Iteration = nil
+		if issue.Epic != nil && !seen[issue.Epic.ID] {
+			seen[issue.Epic.ID] = true
+			epic := *issue.Epic
+			if strings.HasPrefix(epic.URL, "/") {
+				epic.URL = client.URL() + epic.URL
+			}
+			planning.Epics = append(planning.Epics, epic)
+		}
+		planning.Issues = append(planning.Issues, issue)
+	}
+	return planning, nil
+}
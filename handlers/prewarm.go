@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+)
+
+const (
+	// prewarmTimeout bounds a background pre-warm of a user's statuses
+	prewarmTimeout = 2 * time.Minute
+	// prewarmInterval is how often the statuses of one user are pre-warmed at most
+	prewarmInterval = 5 * time.Minute
+)
+
+var (
+	prewarmMu   sync.Mutex
+	prewarmedAt = make(map[int64]time.Time)
+)
+
+// prewarmStatuses fetches the statuses of a user's selected projects in the background, filling the
+// response and per-project caches, so the first status page after logging in mostly hits caches or
+// joins the requests already in flight instead of starting a burst of GitLab calls
+func prewarmStatuses(userID int64, client gitlab.Client) {
+	prewarmMu.Lock()
+	if time.Since(prewarmedAt[userID]) < prewarmInterval {
+		prewarmMu.Unlock()
+		return
+	}
+	prewarmedAt[userID] = time.Now()
+	prewarmMu.Unlock()
+
+	go func() {
+		startedAt := time.Now()
+		err := RunRecovered(func() {
+			ctx, cancel := context.WithTimeout(gitlab.WithFeature(context.Background(), gitlab.FeatureStatus), prewarmTimeout)
+			defer cancel()
+
+			selectedProjects, err := db.GetSelectedProjects(userID)
+			if err != nil {
+				log.Printf("Error fetching selected projects of user %d to pre-warm: %v", userID, err)
+				return
+			}
+			visible, err := visibleProjectIDs(ctx, userID)
+			if err != nil {
+				log.Printf("Error resolving GitLab memberships of user %d to pre-warm: %v", userID, err)
+				return
+			}
+			selectedProjects = filterVisibleSelectedProjects(selectedProjects, visible)
+			if len(selectedProjects) == 0 {
+				return
+			}
+			fetchRepositoryStatuses(ctx, selectedProjects, client)
+			log.Printf("Pre-warmed %d statuses of user %d in %v", len(selectedProjects), userID, time.Since(startedAt).Round(time.Millisecond))
+		})
+		if err != nil {
+			log.Printf("Pre-warming statuses of user %d failed: %v", userID, err)
+		}
+	}()
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+// protectionTTL is how long the protection of a ref is reused; it rarely changes
+const protectionTTL = time.Hour
+
+// protectionCache holds the protection of refs by project ID and ref
+var protectionCache = newTTLCache[string, *models.RefProtection](detailCacheSize)
+
+// refProtection returns whether a project's ref is protected and whether pipelines must succeed to merge,
+// or nil when it's disabled or can't be determined
+func refProtection(ctx context.Context, client gitlab.Client, projectID int, ref string) *models.RefProtection {
+	if !statusDetails[detailProtection] || ref == "" {
+		return nil
+	}
+	key := fmt.Sprintf("%d:%s", projectID, ref)
+	if protection, ok, err := protectionCache.get(key); ok {
+		if err != nil {
+			return nil
+		}
+		return protection
+	}
+
+	protection, err := client.FetchRefProtection(ctx, strconv.Itoa(projectID), ref)
+	protectionCache.set(key, protection, err, protectionTTL)
+	if err != nil {
+		log.Printf("Error fetching protection of %s in project %d: %v", ref, projectID, err)
+		return nil
+	}
+	return protection
+}
+
+// failureBlocksNothing reports whether a failed pipeline on a protected branch doesn't prevent merges,
+// because the project doesn't require pipelines to succeed
+func failureBlocksNothing(status models.RepositoryStatus) bool {
+	return status.Status == "failed" && status.Protection != nil && status.Protection.Protected && !status.Protection.PipelineRequired
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+)
+
+// maxRegistrationBody limits the size of registration requests
+const maxRegistrationBody = 64 * 1024
+
+// registrationRequest is the body sent by a project's CI job to register itself
+type registrationRequest struct {
+	ProjectID   int    `json:"project_id"`
+	ProjectPath string `json:"project_path"`
+}
+
+// validRegistrationSignature checks the X-Signature header ("sha256=<hex HMAC of body>")
+func validRegistrationSignature(body []byte, signature, secret string) bool {
+	signature = strings.TrimPrefix(signature, "sha256=")
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// RegisterProjectHandler lets a GitLab project add itself to the registration user's selection.
+// Requests must be signed with REGISTRATION_SECRET; typically called from the project's CI job:
+//
+//	BODY='{"project_id": '$CI_PROJECT_ID'}'
+//	SIG=$(printf '%s' "$BODY" | openssl dgst -sha256 -hmac "$REGISTRATION_SECRET" | cut -d' ' -f2)
+//	curl -X POST -H "X-Signature: sha256=$SIG" -d "$BODY" https://status.example.com/api/v1/register
+func RegisterProjectHandler(c echo.Context, secret, username string, client gitlab.Client) error {
+	if secret == "" || username == "" {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "project registration is disabled"})
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxRegistrationBody))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "failed to read request body"})
+	}
+
+	if !validRegistrationSignature(body, c.Request().Header.Get("X-Signature"), secret) {
+		log.Printf("Rejected project registration with invalid signature from %s", c.RealIP())
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid signature"})
+	}
+
+	var request registrationRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid JSON body: " + err.Error()})
+	}
+
+	user, err := db.GetUserByName(username)
+	if err != nil {
+		log.Printf("Registration user %s not found: %v", username, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "registration user not found"})
+	}
+
+	// Resolve the project from the cache, falling back to GitLab for projects created since the last sync
+	var projectID int
+	var projectPath string
+	switch {
+	case request.ProjectID != 0:
+		if cached, err := db.GetCachedProject(request.ProjectID); err == nil {
+			projectID, projectPath = cached.ID, cached.PathWithNamespace
+		}
+	case request.ProjectPath != "":
+		if cached, err := db.GetCachedProjectByPath(strings.Trim(request.ProjectPath, "/")); err == nil {
+			projectID, projectPath = cached.ID, cached.PathWithNamespace
+		}
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "project_id or project_path is required"})
+	}
+
+	if projectID == 0 {
+		ref := request.ProjectPath
+		if request.ProjectID != 0 {
+			ref = strconv.Itoa(request.ProjectID)
+		}
+		project, err := client.GetProject(gitlab.WithFeature(c.Request().Context(), gitlab.FeatureRegistration), strings.Trim(ref, "/"))
+		if err != nil {
+			log.Printf("Error looking up project %s for registration: %v", ref, err)
+			if errors.Is(err, gitlab.ErrNotFound) {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "project not found in GitLab"})
+			}
+			return c.JSON(http.StatusBadGateway, map[string]string{"error": "failed to look up project in GitLab: " + describeGitLabError(err)})
+		}
+		cached, err := db.CacheProject(*project)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		projectID, projectPath = cached.ID, cached.PathWithNamespace
+	}
+
+	added, err := db.AddSelectedProject(user.ID, projectID, projectPath)
+	var limitErr *db.SelectionLimitError
+	if errors.As(err, &limitErr) {
+		log.Printf("Rejected registration of %s for user %s: %v", projectPath, username, err)
+		return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "limit": limitErr.Limit})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if added {
+		log.Printf("Project %s registered itself for user %s", projectPath, username)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"project_id": projectID,
+		"path":       projectPath,
+		"registered": added,
+	})
+}
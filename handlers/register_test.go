@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestValidRegistrationSignature(t *testing.T) {
+	const secret = "registration-secret"
+	body := []byte(`{"project_id": 42}`)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	for _, tt := range []struct {
+		name      string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"valid", body, "sha256=" + signature, true},
+		{"valid without prefix", body, signature, true},
+		{"missing", body, "", false},
+		{"prefix only", body, "sha256=", false},
+		{"truncated", body, "sha256=" + signature[:len(signature)-2], false},
+		{"odd length", body, "sha256=" + signature[:len(signature)-1], false},
+		{"not hex", body, "sha256=" + signature[:len(signature)-1] + "z", false},
+		{"other secret", body, "sha256=" + hex.EncodeToString(hmac.New(sha256.New, []byte("other")).Sum(nil)), false},
+		{"changed body", []byte(`{"project_id": 43}`), "sha256=" + signature, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validRegistrationSignature(tt.body, tt.signature, secret); got != tt.want {
+				t.Errorf("validRegistrationSignature(%q) = %v, want %v", tt.signature, got, tt.want)
+			}
+		})
+	}
+}
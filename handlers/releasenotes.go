@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// releaseNoteElements are the elements kept in release notes, with the attributes kept on each.
+// Other elements are dropped with their tags, keeping their text.
+var releaseNoteElements = map[atom.Atom][]string{
+	atom.P: nil, atom.Br: nil, atom.Hr: nil, atom.Div: nil, atom.Span: nil,
+	atom.H1: nil, atom.H2: nil, atom.H3: nil, atom.H4: nil, atom.H5: nil, atom.H6: nil,
+	atom.Ul: nil, atom.Ol: {"start"}, atom.Li: nil, atom.Dl: nil, atom.Dt: nil, atom.Dd: nil,
+	atom.Strong: nil, atom.B: nil, atom.Em: nil, atom.I: nil, atom.S: nil, atom.Del: nil, atom.Ins: nil,
+	atom.Sup: nil, atom.Sub: nil, atom.Kbd: nil, atom.Code: nil, atom.Pre: nil, atom.Blockquote: nil,
+	atom.Details: nil, atom.Summary: nil,
+	atom.Table: nil, atom.Thead: nil, atom.Tbody: nil, atom.Tr: nil,
+	atom.Th: {"align", "colspan", "rowspan"}, atom.Td: {"align", "colspan", "rowspan"},
+	atom.A:   {"href", "title"},
+	atom.Img: {"src", "alt", "title", "width", "height"},
+}
+
+// releaseNoteDroppedElements are dropped with everything in them
+var releaseNoteDroppedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Object: true, atom.Embed: true,
+	atom.Template: true, atom.Noscript: true, atom.Textarea: true, atom.Select: true, atom.Title: true,
+	atom.Svg: true, atom.Math: true, atom.Form: true,
+}
+
+// sanitizeReleaseNotes keeps only the formatting elements and safe links of release notes rendered
+// by GitLab, so a compromised or misconfigured instance can't inject scripts or styles into the page.
+// Links and images relative to the instance, such as /uploads or /-/ paths, are made absolute with
+// the project's URL, as the page isn't served by GitLab.
+func sanitizeReleaseNotes(descriptionHTML, projectURL string) string {
+	nodes, err := html.ParseFragment(strings.NewReader(descriptionHTML), &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div})
+	if err != nil {
+		return ""
+	}
+	base, err := url.Parse(strings.TrimSuffix(projectURL, "/") + "/")
+	if err != nil || !base.IsAbs() {
+		base = nil
+	}
+	var b strings.Builder
+	for _, node := range nodes {
+		writeReleaseNoteNode(&b, node, base)
+	}
+	return b.String()
+}
+
+func writeReleaseNoteNode(b *strings.Builder, node *html.Node, base *url.URL) {
+	switch node.Type {
+	case html.TextNode:
+		b.WriteString(html.EscapeString(node.Data))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if releaseNoteDroppedElements[node.DataAtom] {
+		return
+	}
+	allowed, ok := releaseNoteElements[node.DataAtom]
+	if ok {
+		b.WriteString("<" + node.Data)
+		for _, attr := range releaseNoteAttributes(node, allowed, base) {
+			b.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) + `"`)
+		}
+		b.WriteString(">")
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeReleaseNoteNode(b, child, base)
+	}
+	if ok && node.DataAtom != atom.Br && node.DataAtom != atom.Hr && node.DataAtom != atom.Img {
+		b.WriteString("</" + node.Data + ">")
+	}
+}
+
+// releaseNoteAttributes returns the allowed attributes of an element, with URLs made absolute and
+// dropped unless they are web or mail links
+func releaseNoteAttributes(node *html.Node, allowed []string, base *url.URL) []html.Attribute {
+	values := make(map[string]string, len(node.Attr))
+	for _, attr := range node.Attr {
+		if attr.Namespace == "" {
+			values[attr.Key] = attr.Val
+		}
+	}
+	// GitLab loads images lazily, with the real source in data-src
+	if node.DataAtom == atom.Img && values["data-src"] != "" {
+		values["src"] = values["data-src"]
+	}
+	var attrs []html.Attribute
+	for _, key := range allowed {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		if key == "href" || key == "src" {
+			if value, ok = releaseNoteURL(value, base); !ok {
+				continue
+			}
+		}
+		attrs = append(attrs, html.Attribute{Key: key, Val: value})
+	}
+	if node.DataAtom == atom.A {
+		attrs = append(attrs, html.Attribute{Key: "target", Val: "_blank"}, html.Attribute{Key: "rel", Val: "noopener noreferrer"})
+	}
+	return attrs
+}
+
+// releaseNoteURL resolves a link of the release notes against the project URL and reports whether
+// it's safe to keep
+func releaseNoteURL(raw string, base *url.URL) (string, bool) {
+	ref, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", false
+	}
+	if !ref.IsAbs() {
+		if base == nil {
+			// Without the project's URL only links within the page can be kept
+			return ref.String(), ref.Host == "" && ref.Path == "" && ref.RawQuery == ""
+		}
+		ref = base.ResolveReference(ref)
+	}
+	switch ref.Scheme {
+	case "http", "https", "mailto":
+		return ref.String(), true
+	}
+	return "", false
+}
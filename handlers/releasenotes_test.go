@@ -0,0 +1,38 @@
+package handlers
+
+import "testing"
+
+func TestSanitizeReleaseNotes(t *testing.T) {
+	const project = "https://gitlab.example.com/acme/billing"
+	for _, tt := range []struct {
+		name string
+		html string
+		want string
+	}{
+		{"formatting", `<h2>Fixes</h2><ul><li><strong>Faster</strong> exports</li></ul>`, `<h2>Fixes</h2><ul><li><strong>Faster</strong> exports</li></ul>`},
+		{"script", `<p>Notes<script>alert(1)</script></p>`, `<p>Notes</p>`},
+		{"event handler and style", `<p onclick="alert(1)" style="position:fixed">Notes</p>`, `<p>Notes</p>`},
+		{"unknown element keeps its text", `<marquee>Notes</marquee>`, `Notes`},
+		{"javascript link", `<a href="javascript:alert(1)">x</a>`, `<a target="_blank" rel="noopener noreferrer">x</a>`},
+		{"absolute link", `<a href="https://docs.example.com/">docs</a>`, `<a href="https://docs.example.com/" target="_blank" rel="noopener noreferrer">docs</a>`},
+		{"instance link", `<a href="/acme/billing/-/issues/4">#4</a>`, `<a href="https://gitlab.example.com/acme/billing/-/issues/4" target="_blank" rel="noopener noreferrer">#4</a>`},
+		{"lazy upload image", `<img src="data:image/gif;base64,R0lGOD" data-src="/uploads/abc/screen.png" alt="screen" class="lazy">`, `<img src="https://gitlab.example.com/uploads/abc/screen.png" alt="screen">`},
+		{"relative upload", `<img src="uploads/abc/screen.png">`, `<img src="https://gitlab.example.com/acme/billing/uploads/abc/screen.png">`},
+		{"unclosed table", `<table><tr><td>1`, `<table><tbody><tr><td>1</td></tr></tbody></table>`},
+		{"escaped text", `<p>a &lt;b&gt; &amp; c</p>`, `<p>a &lt;b&gt; &amp; c</p>`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeReleaseNotes(tt.html, project); got != tt.want {
+				t.Errorf("sanitizeReleaseNotes(%q) = %q, want %q", tt.html, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeReleaseNotesWithoutProjectURL(t *testing.T) {
+	got := sanitizeReleaseNotes(`<a href="/uploads/x.png">x</a><a href="#fixes">fixes</a>`, "")
+	want := `<a target="_blank" rel="noopener noreferrer">x</a><a href="#fixes" target="_blank" rel="noopener noreferrer">fixes</a>`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/sync/errgroup"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+	"gitlab-status/templates"
+)
+
+// releaseBlockerLabels are the labels of merge requests that block a release, comma separated
+var releaseBlockerLabels = "release-blocker"
+
+// SetReleaseBlockerLabels sets the labels that mark merge requests as release blockers;
+// empty makes every open merge request to the default branch a blocker
+func SetReleaseBlockerLabels(labels string) {
+	releaseBlockerLabels = labels
+	log.Printf("Merge requests labeled %q block releases", labels)
+}
+
+// ReleaseReadinessHandler shows, for each selected project, the latest tag, the commits since then,
+// the default branch pipeline and the merge requests blocking a release
+func ReleaseReadinessHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+	username := session.Values["username"].(string)
+
+	selectedProjects, err := db.GetSelectedProjects(userID)
+	if err != nil {
+		log.Printf("Error fetching selected projects: %v", err)
+		return templates.Releases(username, releaseBlockerLabels, nil, "Failed to load selected projects").Render(c.Request().Context(), c.Response().Writer)
+	}
+	visible, err := visibleProjectIDs(c.Request().Context(), userID)
+	if err != nil {
+		return templates.Releases(username, releaseBlockerLabels, nil, "Cannot show projects: "+err.Error()).Render(c.Request().Context(), c.Response().Writer)
+	}
+	selectedProjects = filterVisibleSelectedProjects(selectedProjects, visible)
+
+	ctx := gitlab.WithFeature(c.Request().Context(), gitlab.FeatureStatus)
+	readiness := make([]models.ReleaseReadiness, len(selectedProjects))
+	var g errgroup.Group
+	g.SetLimit(statusFetchConcurrency)
+	for i, selectedProject := range selectedProjects {
+		g.Go(func() error {
+			readiness[i] = fetchReleaseReadiness(ctx, selectedProject, client)
+			return nil
+		})
+	}
+	g.Wait()
+
+	return templates.Releases(username, releaseBlockerLabels, readiness, "").Render(c.Request().Context(), c.Response().Writer)
+}
+
+// fetchReleaseReadiness checks the release readiness of a single selected project
+func fetchReleaseReadiness(ctx context.Context, selectedProject models.SelectedProject, client gitlab.Client) models.ReleaseReadiness {
+	readiness := models.ReleaseReadiness{
+		ProjectID:   selectedProject.ProjectID,
+		ProjectName: selectedProject.Path,
+		ProjectPath: selectedProject.Path,
+	}
+	projectID := strconv.Itoa(selectedProject.ProjectID)
+
+	// The default branch isn't cached, so the project is always read from GitLab
+	project, err := client.GetProject(ctx, projectID)
+	if err != nil {
+		log.Printf("Error fetching project %d: %v", selectedProject.ProjectID, err)
+		readiness.Error = describeGitLabError(err)
+		return readiness
+	}
+	readiness.ProjectName = project.Name
+	readiness.ProjectPath = project.PathWithNamespace
+	readiness.ProjectURL = project.WebURL
+	readiness.DefaultBranch = project.DefaultBranch
+	if project.DefaultBranch == "" {
+		readiness.Error = "Project has no default branch"
+		return readiness
+	}
+
+	readiness.LatestTag, err = client.FetchLatestTag(ctx, projectID)
+	if err != nil {
+		log.Printf("Error fetching latest tag of %s: %v", project.PathWithNamespace, err)
+		readiness.Error = describeGitLabError(err)
+		return readiness
+	}
+	if readiness.LatestTag != nil {
+		readiness.UnreleasedCommits, err = client.CountCommitsBetween(ctx, projectID, readiness.LatestTag.Name, project.DefaultBranch)
+		if err != nil {
+			log.Printf("Error counting unreleased commits of %s: %v", project.PathWithNamespace, err)
+			readiness.Error = describeGitLabError(err)
+			return readiness
+		}
+	}
+
+	readiness.Pipeline, err = client.FetchLatestPipeline(ctx, projectID, project.DefaultBranch)
+	if err != nil && !errors.Is(err, gitlab.ErrNoPipelines) {
+		log.Printf("Error fetching default branch pipeline of %s: %v", project.PathWithNamespace, err)
+		readiness.Error = describeGitLabError(err)
+		return readiness
+	}
+
+	readiness.BlockingMRs, err = client.FetchOpenMergeRequests(ctx, projectID, project.DefaultBranch, releaseBlockerLabels)
+	if err != nil {
+		log.Printf("Error fetching blocking merge requests of %s: %v", project.PathWithNamespace, err)
+		readiness.Error = describeGitLabError(err)
+	}
+	return readiness
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+// runnersTTL is how long the status of runners is reused
+const runnersTTL = 2 * time.Minute
+
+// runnersEntry is the cached runners of a project or the instance
+type runnersEntry struct {
+	runners   []models.Runner
+	err       error
+	fetchedAt time.Time
+}
+
+var (
+	runnersMu    sync.Mutex
+	runnersCache = make(map[string]runnersEntry)
+)
+
+// runnerStatuses returns the runners of a project, or of the instance when projectID is empty, with
+// when they were fetched. Failures are cached too, so a token without admin rights isn't retried on every load.
+func runnerStatuses(ctx context.Context, client gitlab.Client, projectID string) ([]models.Runner, time.Time, error) {
+	runnersMu.Lock()
+	entry, ok := runnersCache[projectID]
+	runnersMu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < runnersTTL {
+		return entry.runners, entry.fetchedAt, entry.err
+	}
+
+	runners, err := client.FetchRunners(ctx, projectID)
+	entry = runnersEntry{runners: runners, err: err, fetchedAt: time.Now()}
+
+	runnersMu.Lock()
+	runnersCache[projectID] = entry
+	runnersMu.Unlock()
+	return entry.runners, entry.fetchedAt, entry.err
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+	"gitlab-status/templates"
+)
+
+// variableKey matches the names GitLab accepts for CI/CD variables
+var variableKey = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// parsePipelineVariables parses KEY=value lines, ignoring empty lines
+func parsePipelineVariables(text string) ([]models.PipelineVariable, error) {
+	var variables []models.PipelineVariable
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !variableKey.MatchString(key) {
+			return nil, fmt.Errorf("line %d is not a KEY=value variable", i+1)
+		}
+		variables = append(variables, models.PipelineVariable{Key: key, Value: value})
+	}
+	return variables, nil
+}
+
+// runPipelineProject returns the cached project of the :projectID parameter if the user can see it
+func runPipelineProject(c echo.Context, userID int64) (*models.CachedProject, error) {
+	projectID, err := strconv.Atoi(c.Param("projectID"))
+	if err != nil {
+		return nil, err
+	}
+	return visibleCachedProject(c, userID, projectID)
+}
+
+// visibleCachedProject returns a cached project if the user can see it
+func visibleCachedProject(c echo.Context, userID int64, projectID int) (*models.CachedProject, error) {
+	visible, err := visibleProjectIDs(c.Request().Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	if visible != nil && !visible[projectID] {
+		return nil, gitlab.ErrNotFound
+	}
+	return db.GetCachedProject(projectID)
+}
+
+// userGitLabClient returns a client using the user's own GitLab token, so actions are only possible
+// where the user could take them in GitLab. Without a client it returns why, for actionName, e.g.
+// "Running pipelines".
+func userGitLabClient(userID int64, client gitlab.Client, actionName string) (gitlab.Client, string) {
+	user, err := db.GetUser(userID)
+	if err != nil {
+		log.Printf("Error loading user %d: %v", userID, err)
+		return nil, "Failed to load your account"
+	}
+	if user.GitLabToken == "" {
+		return nil, actionName + " needs your personal GitLab token with the api scope, set it under Settings > GitLab Access"
+	}
+	return gitlab.NewHTTPClient(client.URL(), user.GitLabToken), ""
+}
+
+// describeActionError explains why GitLab didn't take an action, preferring GitLab's own message.
+// what names the rejected thing and unauthorized explains missing permissions.
+func describeActionError(err error, what, unauthorized string) string {
+	var apiErr *gitlab.APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Message != "":
+		return "GitLab rejected the " + what + ": " + apiErr.Message
+	case errors.Is(err, gitlab.ErrUnauthorized):
+		return unauthorized
+	default:
+		return describeGitLabError(err)
+	}
+}
+
+// RunPipelinePageHandler shows the form to run a pipeline of a project with variables
+func RunPipelinePageHandler(c echo.Context, store sessions.Store) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+	project, err := runPipelineProject(c, userID)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Project not found")
+	}
+	return templates.RunPipeline(session.Values["username"].(string), *project, c.QueryParam("ref"), "", csrfToken(c), "").Render(c.Request().Context(), c.Response().Writer)
+}
+
+// RunPipelineHandler runs a pipeline with the user's own GitLab token, so it is only possible where the
+// user could run it in GitLab, and shows the status page with the new pipeline
+func RunPipelineHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+	username := session.Values["username"].(string)
+	project, err := runPipelineProject(c, userID)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Project not found")
+	}
+
+	ref := strings.TrimSpace(c.FormValue("ref"))
+	variablesText := c.FormValue("variables")
+	render := func(message string) error {
+		return templates.RunPipeline(username, *project, ref, variablesText, csrfToken(c), message).Render(c.Request().Context(), c.Response().Writer)
+	}
+	if ref == "" {
+		return render("Enter the branch or tag to run the pipeline for")
+	}
+	variables, err := parsePipelineVariables(variablesText)
+	if err != nil {
+		return render(err.Error())
+	}
+	userClient, message := userGitLabClient(userID, client, "Running pipelines")
+	if userClient == nil {
+		return render(message)
+	}
+
+	ctx := gitlab.WithActor(gitlab.WithFeature(c.Request().Context(), gitlab.FeatureOther), username)
+	pipeline, err := userClient.CreatePipeline(ctx, strconv.Itoa(project.ID), ref, variables)
+	recordAction(c, ActionRunPipeline, username, project.ID, "ref "+ref, err)
+	if err != nil {
+		log.Printf("Error running pipeline of %s on %s for %s: %v", project.PathWithNamespace, ref, username, err)
+		return render(describeActionError(err, "pipeline", "Your GitLab token can't run pipelines in this project, it needs the api scope and at least the Developer role"))
+	}
+	log.Printf("Pipeline %d of %s on %s run by %s", pipeline.ID, project.PathWithNamespace, ref, username)
+	return c.Redirect(http.StatusSeeOther, "/")
+}
+
+// RetryJobHandler retries one failed job of a pipeline with the user's own GitLab token, which is much
+// cheaper than running the whole pipeline again for a flaky job. It renders the outcome in place of the
+// retry button.
+func RetryJobHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+	username := session.Values["username"].(string)
+	project, err := runPipelineProject(c, userID)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Project not found")
+	}
+	jobID, err := strconv.Atoi(c.Param("jobID"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "Invalid job ID")
+	}
+
+	ctx := c.Request().Context()
+	render := func(message string) error {
+		return templates.JobRetry(nil, message).Render(ctx, c.Response().Writer)
+	}
+	userClient, message := userGitLabClient(userID, client, "Retrying jobs")
+	if userClient == nil {
+		return render(message)
+	}
+
+	job, err := userClient.RetryJob(gitlab.WithActor(gitlab.WithFeature(ctx, gitlab.FeatureOther), username), strconv.Itoa(project.ID), jobID)
+	recordAction(c, ActionRetryJob, username, project.ID, "job "+strconv.Itoa(jobID), err)
+	if err != nil {
+		log.Printf("Error retrying job %d of %s for %s: %v", jobID, project.PathWithNamespace, username, err)
+		return render(describeActionError(err, "retry", "Your GitLab token can't retry jobs in this project, it needs the api scope and at least the Developer role"))
+	}
+	forgetPipelineStages(project.ID)
+	log.Printf("Job %d of %s retried as job %d by %s", jobID, project.PathWithNamespace, job.ID, username)
+	return templates.JobRetry(job, "").Render(ctx, c.Response().Writer)
+}
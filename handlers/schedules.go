@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/sync/errgroup"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+	"gitlab-status/templates"
+)
+
+const (
+	// scheduleTTL is how long the schedule problems of a project are reused
+	scheduleTTL = 10 * time.Minute
+	// scheduleGracePeriod is how late a scheduled pipeline may run or start before it's reported
+	scheduleGracePeriod = time.Hour
+)
+
+// scheduleCache holds the schedule problems by project ID
+var scheduleCache = newTTLCache[int, []string](detailCacheSize)
+
+// scheduleProblems compares the pipeline schedules of a project with what actually ran. A schedule is
+// reported when it's paused, when its next run is overdue (GitLab didn't start it) or when the last
+// pipeline it started is still waiting for a runner. It returns nil when it's disabled or schedules
+// can't be fetched.
+func scheduleProblems(ctx context.Context, client gitlab.Client, projectID int) []string {
+	if !statusDetails[detailSchedules] {
+		return nil
+	}
+	if problems, ok, err := scheduleCache.get(projectID); ok {
+		if err != nil {
+			return nil
+		}
+		return problems
+	}
+
+	schedules, err := client.FetchPipelineSchedules(ctx, strconv.Itoa(projectID))
+	if err != nil {
+		scheduleCache.set(projectID, nil, err, 0)
+		log.Printf("Error fetching pipeline schedules of project %d: %v", projectID, err)
+		return nil
+	}
+
+	var problems []string
+	now := time.Now()
+	for _, schedule := range schedules {
+		name := schedule.Description
+		if name == "" {
+			name = fmt.Sprintf("#%d", schedule.ID)
+		}
+		if !schedule.Active {
+			problems = append(problems, fmt.Sprintf("Schedule %q (%s) is paused", name, schedule.Cron))
+			continue
+		}
+		if !schedule.NextRunAt.IsZero() && now.Sub(schedule.NextRunAt) > scheduleGracePeriod {
+			problems = append(problems, fmt.Sprintf("Schedule %q (%s) didn't run at %s", name, schedule.Cron, schedule.NextRunAt.Format("2006-01-02 15:04")))
+			continue
+		}
+
+		detail, err := client.FetchPipelineSchedule(ctx, strconv.Itoa(projectID), schedule.ID)
+		if err != nil {
+			log.Printf("Error fetching pipeline schedule %d of project %d: %v", schedule.ID, projectID, err)
+			continue
+		}
+		if last := detail.LastPipeline; last != nil && (last.Status == "created" || last.Status == "pending") && now.Sub(last.CreatedAt) > scheduleGracePeriod {
+			problems = append(problems, fmt.Sprintf("Schedule %q (%s) started pipeline #%d at %s, which is still %s", name, schedule.Cron, last.ID, last.CreatedAt.Format("2006-01-02 15:04"), last.Status))
+		}
+	}
+	for _, problem := range problems {
+		log.Printf("Project %d: %s", projectID, problem)
+	}
+
+	scheduleCache.set(projectID, problems, nil, scheduleTTL)
+	return problems
+}
+
+// forgetScheduleProblems drops the cached schedule problems of a project after its schedules changed
+func forgetScheduleProblems(projectID int) {
+	scheduleCache.forget(projectID)
+}
+
+// SchedulesHandler lists the pipeline schedules of the selected projects with their next run
+func SchedulesHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+	username := session.Values["username"].(string)
+	return renderSchedulesPage(c, userID, username, client, "", models.ScheduleForm{CronTimezone: "UTC", Active: true})
+}
+
+// renderSchedulesPage renders the schedules of the user's selected projects with the form to create
+// a schedule and an optional message why an action failed
+func renderSchedulesPage(c echo.Context, userID int64, username string, client gitlab.Client, actionError string, form models.ScheduleForm) error {
+	selectedProjects, err := db.GetSelectedProjects(userID)
+	if err != nil {
+		log.Printf("Error fetching selected projects: %v", err)
+		return templates.Schedules(username, nil, csrfToken(c), "Failed to load selected projects", "", form).Render(c.Request().Context(), c.Response().Writer)
+	}
+	visible, err := visibleProjectIDs(c.Request().Context(), userID)
+	if err != nil {
+		return templates.Schedules(username, nil, csrfToken(c), "Cannot show projects: "+err.Error(), "", form).Render(c.Request().Context(), c.Response().Writer)
+	}
+	selectedProjects = filterVisibleSelectedProjects(selectedProjects, visible)
+
+	ctx := gitlab.WithFeature(c.Request().Context(), gitlab.FeatureStatus)
+	projects := make([]models.ProjectSchedules, len(selectedProjects))
+	var g errgroup.Group
+	g.SetLimit(statusFetchConcurrency)
+	for i, selectedProject := range selectedProjects {
+		g.Go(func() error {
+			projects[i] = fetchProjectSchedules(ctx, selectedProject, client)
+			return nil
+		})
+	}
+	g.Wait()
+
+	return templates.Schedules(username, projects, csrfToken(c), "", actionError, form).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// CreateScheduleHandler creates a pipeline schedule in a selected project with the user's own GitLab token
+func CreateScheduleHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+	username := session.Values["username"].(string)
+
+	form := models.ScheduleForm{
+		Description:  strings.TrimSpace(c.FormValue("description")),
+		Ref:          strings.TrimSpace(c.FormValue("ref")),
+		Cron:         strings.TrimSpace(c.FormValue("cron")),
+		CronTimezone: strings.TrimSpace(c.FormValue("cron_timezone")),
+		Active:       c.FormValue("active") == "on",
+	}
+	form.ProjectID, _ = strconv.Atoi(c.FormValue("project_id"))
+	render := func(message string) error {
+		return renderSchedulesPage(c, userID, username, client, message, form)
+	}
+	project, err := visibleCachedProject(c, userID, form.ProjectID)
+	if err != nil {
+		return render("Select one of your projects")
+	}
+	if form.Description == "" || form.Ref == "" || form.Cron == "" {
+		return render("A schedule needs a description, a branch or tag and a cron expression")
+	}
+	if len(strings.Fields(form.Cron)) != 5 {
+		return render("The cron expression needs five fields: minute, hour, day of month, month and day of week")
+	}
+	userClient, message := userGitLabClient(userID, client, "Creating schedules")
+	if userClient == nil {
+		return render(message)
+	}
+
+	ctx := gitlab.WithActor(gitlab.WithFeature(c.Request().Context(), gitlab.FeatureOther), username)
+	schedule, err := userClient.CreatePipelineSchedule(ctx, strconv.Itoa(project.ID), models.PipelineSchedule{
+		Description:  form.Description,
+		Ref:          form.Ref,
+		Cron:         form.Cron,
+		CronTimezone: form.CronTimezone,
+		Active:       form.Active,
+	})
+	recordAction(c, ActionCreateSchedule, username, project.ID, fmt.Sprintf("%q on %s at %s", form.Description, form.Ref, form.Cron), err)
+	if err != nil {
+		log.Printf("Error creating schedule of %s for %s: %v", project.PathWithNamespace, username, err)
+		return render(describeActionError(err, "schedule", "Your GitLab token can't create schedules in this project, it needs the api scope and at least the Developer role"))
+	}
+	forgetScheduleProblems(project.ID)
+	log.Printf("Schedule %d of %s created by %s", schedule.ID, project.PathWithNamespace, username)
+	return c.Redirect(http.StatusSeeOther, "/schedules")
+}
+
+// ToggleScheduleHandler pauses or resumes a pipeline schedule with the user's own GitLab token
+func ToggleScheduleHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+	username := session.Values["username"].(string)
+	render := func(message string) error {
+		return renderSchedulesPage(c, userID, username, client, message, models.ScheduleForm{CronTimezone: "UTC", Active: true})
+	}
+
+	project, err := runPipelineProject(c, userID)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Project not found")
+	}
+	scheduleID, err := strconv.Atoi(c.Param("scheduleID"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "Invalid schedule ID")
+	}
+	active := c.FormValue("active") == "true"
+	userClient, message := userGitLabClient(userID, client, "Changing schedules")
+	if userClient == nil {
+		return render(message)
+	}
+
+	ctx := gitlab.WithActor(gitlab.WithFeature(c.Request().Context(), gitlab.FeatureOther), username)
+	_, err = userClient.SetPipelineScheduleActive(ctx, strconv.Itoa(project.ID), scheduleID, active)
+	target := fmt.Sprintf("schedule %d: pause", scheduleID)
+	if active {
+		target = fmt.Sprintf("schedule %d: resume", scheduleID)
+	}
+	recordAction(c, ActionToggleSchedule, username, project.ID, target, err)
+	if err != nil {
+		log.Printf("Error changing schedule %d of %s for %s: %v", scheduleID, project.PathWithNamespace, username, err)
+		return render(describeActionError(err, "change", "Only the owner of a schedule or a Maintainer of the project can pause or resume it"))
+	}
+	forgetScheduleProblems(project.ID)
+	return c.Redirect(http.StatusSeeOther, "/schedules")
+}
+
+// fetchProjectSchedules gets the pipeline schedules of a selected project, the next to run first
+func fetchProjectSchedules(ctx context.Context, selectedProject models.SelectedProject, client gitlab.Client) models.ProjectSchedules {
+	project := models.ProjectSchedules{
+		ProjectID:   selectedProject.ProjectID,
+		ProjectName: selectedProject.Path,
+		ProjectPath: selectedProject.Path,
+	}
+	if cachedProject, err := db.GetCachedProject(selectedProject.ProjectID); err == nil {
+		project.ProjectName = cachedProject.Name
+		project.ProjectPath = cachedProject.PathWithNamespace
+		project.ProjectURL = cachedProject.WebURL
+	}
+
+	schedules, err := client.FetchPipelineSchedules(ctx, strconv.Itoa(selectedProject.ProjectID))
+	if err != nil {
+		log.Printf("Error fetching pipeline schedules of %s: %v", project.ProjectPath, err)
+		project.Error = describeGitLabError(err)
+		return project
+	}
+	// Paused schedules have no meaningful next run and go last
+	sort.SliceStable(schedules, func(i, j int) bool {
+		if schedules[i].Active != schedules[j].Active {
+			return schedules[i].Active
+		}
+		return schedules[i].NextRunAt.Before(schedules[j].NextRunAt)
+	})
+	project.Schedules = schedules
+	return project
+}
@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"html"
 	"log"
 	"net/http"
 	"sort"
@@ -49,6 +52,8 @@ func ConvertToTemplateNode(node *PathNode) *templates.PathNode {
 		templateNode.ProjectID = node.Project.ID
 		templateNode.ProjectName = node.Project.Name
 		templateNode.ProjectPath = node.Project.PathWithNamespace
+		templateNode.Archived = node.Project.Archived
+		templateNode.HasAvatar = node.Project.AvatarURL != ""
 	}
 
 	// Convert all children recursively
@@ -199,7 +204,7 @@ func applyExpandedState(node *PathNode, expandedPaths map[string]bool) {
 }
 
 // SettingsPageHandler handles the settings page request with path-based tree view
-func SettingsPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL string) error {
+func SettingsPageHandler(c echo.Context, store sessions.Store, gitlabURL string) error {
 	session, _ := store.Get(c.Request(), "gitlab-status-session")
 	userID, ok := session.Values["user_id"].(int64)
 	if !ok {
@@ -229,6 +234,7 @@ func SettingsPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL
 		log.Printf("Error checking cached items: %v", err)
 		return templates.Settings(
 			session.Values["username"].(string),
+			csrfToken(c),
 			true,
 			false,
 			"Failed to check database cache: "+err.Error(),
@@ -244,6 +250,7 @@ func SettingsPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL
 		log.Printf("No cached projects found in database")
 		return templates.Settings(
 			session.Values["username"].(string),
+			csrfToken(c),
 			true,
 			true,
 			"No projects found in database. Click Refresh Data to load GitLab projects.",
@@ -260,6 +267,7 @@ func SettingsPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL
 		log.Printf("Error loading projects from cache: %v", err)
 		return templates.Settings(
 			session.Values["username"].(string),
+			csrfToken(c),
 			true,
 			false,
 			"Failed to load projects from cache: "+err.Error(),
@@ -270,6 +278,24 @@ func SettingsPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL
 		).Render(c.Request().Context(), c.Response().Writer)
 	}
 
+	// Only offer projects the user is a member of when membership enforcement is enabled
+	visible, err := visibleProjectIDs(c.Request().Context(), userID)
+	if err != nil {
+		log.Printf("Error resolving GitLab memberships for user %d: %v", userID, err)
+		return templates.Settings(
+			session.Values["username"].(string),
+			csrfToken(c),
+			true,
+			false,
+			"Cannot show projects: "+err.Error(),
+			gitlabURL,
+			nil,
+			nil,
+			"",
+		).Render(c.Request().Context(), c.Response().Writer)
+	}
+	cachedProjects = filterVisibleCachedProjects(cachedProjects, visible)
+
 	// Get currently selected projects from database
 	selectedProjects, _ := db.GetSelectedProjects(userID)
 	selectedProjectMap := make(map[int]bool)
@@ -334,6 +360,7 @@ func SettingsPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL
 
 	return templates.Settings(
 		session.Values["username"].(string),
+		csrfToken(c),
 		true,
 		false,
 		"",
@@ -539,6 +566,8 @@ func convertNodeToGroup(name string, node *PathNode) models.Group {
 				Path:              childNode.Project.Path,
 				PathWithNamespace: childNode.Project.PathWithNamespace,
 				WebURL:            childNode.Project.WebURL,
+				AvatarURL:         childNode.Project.AvatarURL,
+				Archived:          childNode.Project.Archived,
 				Level:             childNode.Level - 1, // Adjust level
 				Selected:          childNode.Selected,
 			}
@@ -554,7 +583,7 @@ func convertNodeToGroup(name string, node *PathNode) models.Group {
 }
 
 // ProjectsPageHandler handles the projects page request (flat list of all projects)
-func ProjectsPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL string) error {
+func ProjectsPageHandler(c echo.Context, store sessions.Store, gitlabURL string) error {
 	session, _ := store.Get(c.Request(), "gitlab-status-session")
 
 	// Get user ID from session
@@ -574,6 +603,7 @@ func ProjectsPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL
 		log.Printf("No cached projects found in database")
 		return templates.Settings(
 			session.Values["username"].(string),
+			csrfToken(c),
 			false,
 			true,
 			"No projects found in database. Click Refresh Data to load GitLab projects.",
@@ -594,6 +624,7 @@ func ProjectsPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL
 		log.Printf("Error loading projects from cache: %v", err)
 		return templates.Settings(
 			session.Values["username"].(string),
+			csrfToken(c),
 			false,
 			false,
 			"Failed to load projects from cache: "+err.Error(),
@@ -604,6 +635,24 @@ func ProjectsPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL
 		).Render(c.Request().Context(), c.Response().Writer)
 	}
 
+	// Only offer projects the user is a member of when membership enforcement is enabled
+	visible, err := visibleProjectIDs(c.Request().Context(), userID)
+	if err != nil {
+		log.Printf("Error resolving GitLab memberships for user %d: %v", userID, err)
+		return templates.Settings(
+			session.Values["username"].(string),
+			csrfToken(c),
+			false,
+			false,
+			"Cannot show projects: "+err.Error(),
+			gitlabURL,
+			nil,
+			nil,
+			"",
+		).Render(c.Request().Context(), c.Response().Writer)
+	}
+	cachedProjects = filterVisibleCachedProjects(cachedProjects, visible)
+
 	// Convert cached projects to Project objects
 	var allProjects []models.Project
 	for _, cp := range cachedProjects {
@@ -614,6 +663,8 @@ func ProjectsPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL
 			Path:              cp.Path,
 			PathWithNamespace: cp.PathWithNamespace,
 			WebURL:            cp.WebURL,
+			AvatarURL:         cp.AvatarURL,
+			Archived:          cp.Archived,
 		}
 
 		// Set namespace info
@@ -647,6 +698,7 @@ func ProjectsPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL
 
 	return templates.Settings(
 		session.Values["username"].(string),
+		csrfToken(c),
 		false,
 		false,
 		"",
@@ -658,7 +710,7 @@ func ProjectsPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL
 }
 
 // RenderPathTreeHandler handles HTMX requests to render just the path tree component
-func RenderPathTreeHandler(c echo.Context, store *sessions.CookieStore, gitlabURL string) error {
+func RenderPathTreeHandler(c echo.Context, store sessions.Store, gitlabURL string) error {
 	session, _ := store.Get(c.Request(), "gitlab-status-session")
 	userID, ok := session.Values["user_id"].(int64)
 	if !ok {
@@ -687,6 +739,11 @@ func RenderPathTreeHandler(c echo.Context, store *sessions.CookieStore, gitlabUR
 	if err != nil {
 		return c.String(http.StatusInternalServerError, "Failed to load projects from database")
 	}
+	visible, err := visibleProjectIDs(c.Request().Context(), userID)
+	if err != nil {
+		return c.String(http.StatusForbidden, "Cannot show projects: "+err.Error())
+	}
+	cachedProjects = filterVisibleCachedProjects(cachedProjects, visible)
 
 	// Get currently selected projects from database
 	selectedProjects, _ := db.GetSelectedProjects(userID)
@@ -736,7 +793,7 @@ func RenderPathTreeHandler(c echo.Context, store *sessions.CookieStore, gitlabUR
 }
 
 // CacheHandler handles direct navigation to cache refresh
-func CacheHandler(c echo.Context, store *sessions.CookieStore, gitlabURL, token string) error {
+func CacheHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
 	session, _ := store.Get(c.Request(), "gitlab-status-session")
 
 	// Get user ID from session
@@ -745,35 +802,41 @@ func CacheHandler(c echo.Context, store *sessions.CookieStore, gitlabURL, token
 		return c.Redirect(http.StatusSeeOther, "/logout")
 	}
 
-	// Start caching in a goroutine to not block the response
+	// Start caching in a goroutine to not block the response; the refresh outlives the request
+	ctx := gitlab.WithFeature(context.WithoutCancel(c.Request().Context()), gitlab.FeatureSync)
 	go func() {
+		startedAt := time.Now()
+
 		// Fetch groups and projects
-		groups, err := gitlab.FetchGroups(gitlabURL, token)
+		groups, err := client.FetchGroups(ctx)
 		if err != nil {
 			log.Printf("Error fetching groups: %v", err)
 			return
 		}
 
-		projects, err := gitlab.FetchProjects(gitlabURL, token)
+		projects, err := client.FetchProjects(ctx)
 		if err != nil {
 			log.Printf("Error fetching projects: %v", err)
 			return
 		}
 
 		// Store in database
-		err = db.CacheGitLabStructure(groups, projects)
+		err = db.CacheGitLabStructure(groups, projects, startedAt)
 		if err != nil {
 			log.Printf("Error caching GitLab structure: %v", err)
 		}
+
+		log.Printf("GitLab API quota after refresh: %s", gitlab.GetRateLimitStatus())
 	}()
 
 	// Redirect to settings page with caching message
 	return templates.Settings(
 		session.Values["username"].(string),
+		csrfToken(c),
 		true,
 		true,
 		"Refreshing GitLab data. Please wait and refresh the page in a few moments.",
-		gitlabURL,
+		client.URL(),
 		nil,
 		nil,
 		"",
@@ -781,7 +844,7 @@ func CacheHandler(c echo.Context, store *sessions.CookieStore, gitlabURL, token
 }
 
 // SaveSettingsHandler handles the form submission to save settings
-func SaveSettingsHandler(c echo.Context, store *sessions.CookieStore) error {
+func SaveSettingsHandler(c echo.Context, store sessions.Store) error {
 	session, _ := store.Get(c.Request(), "gitlab-status-session")
 	userID, ok := session.Values["user_id"].(int64)
 	if !ok {
@@ -796,9 +859,30 @@ func SaveSettingsHandler(c echo.Context, store *sessions.CookieStore) error {
 	// Get selected projects from form
 	selectedIDs := c.Request().Form["projects"]
 
-	// Save to database
-	err := db.SaveSelectedProjects(userID, selectedIDs)
+	// Drop projects the user is not a member of when membership enforcement is enabled
+	visible, err := visibleProjectIDs(c.Request().Context(), userID)
 	if err != nil {
+		return c.String(http.StatusForbidden, "Failed to save settings: "+err.Error())
+	}
+	if visible != nil {
+		var allowedIDs []string
+		for _, idStr := range selectedIDs {
+			if id, err := strconv.Atoi(idStr); err == nil && visible[id] {
+				allowedIDs = append(allowedIDs, idStr)
+			}
+		}
+		selectedIDs = allowedIDs
+	}
+
+	// Save to database
+	if err := db.SaveSelectedProjects(userID, selectedIDs); err != nil {
+		var limitErr *db.SelectionLimitError
+		if errors.As(err, &limitErr) {
+			if c.Request().Header.Get("HX-Request") == "true" {
+				return c.HTML(http.StatusOK, "<div class='alert alert-danger'>"+html.EscapeString(limitErr.Error())+". Deselect some projects and save again.</div>")
+			}
+			return c.String(http.StatusUnprocessableEntity, "Failed to save settings: "+err.Error())
+		}
 		return c.String(http.StatusInternalServerError, "Failed to save settings: "+err.Error())
 	}
 
@@ -825,3 +909,53 @@ func collectSelectedProjectIDs(node *PathNode) []string {
 
 	return result
 }
+
+// SyncPreviewHandler fetches the GitLab structure and reports what a refresh would change without writing to the cache.
+// It fetches every group and project of the instance with the server's token and lists their names, so it's for admins only.
+func SyncPreviewHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
+	username, ok := currentAdmin(c, store)
+	if !ok {
+		return c.String(http.StatusForbidden, "Admin access required")
+	}
+
+	startTime := time.Now()
+
+	groups, err := client.FetchGroups(gitlab.WithFeature(c.Request().Context(), gitlab.FeatureSync))
+	if err != nil {
+		log.Printf("Error fetching groups for sync preview: %v", err)
+		return templates.SyncPreview(username, client.URL(), nil, "Failed to fetch groups: "+err.Error()).
+			Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	projects, err := client.FetchProjects(gitlab.WithFeature(c.Request().Context(), gitlab.FeatureSync))
+	if err != nil {
+		log.Printf("Error fetching projects for sync preview: %v", err)
+		return templates.SyncPreview(username, client.URL(), nil, "Failed to fetch projects: "+err.Error()).
+			Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	diff, err := db.DiffGitLabStructure(groups, projects)
+	if err != nil {
+		log.Printf("Error comparing GitLab structure with cache: %v", err)
+		return templates.SyncPreview(username, client.URL(), nil, "Failed to compare with cache: "+err.Error()).
+			Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	log.Printf("Sync preview completed in %.2f seconds: +%d/-%d/~%d groups, +%d/-%d/~%d projects",
+		time.Since(startTime).Seconds(),
+		len(diff.AddedGroups), len(diff.RemovedGroups), len(diff.RenamedGroups),
+		len(diff.AddedProjects), len(diff.RemovedProjects), len(diff.RenamedProjects))
+
+	return templates.SyncPreview(username, client.URL(), diff, "").Render(c.Request().Context(), c.Response().Writer)
+}
+
+// TokenStatusHandler validates the GitLab API token and renders a warning on the settings page when it can't be used
+func TokenStatusHandler(c echo.Context, client gitlab.Client) error {
+	validation, err := client.ValidateToken(gitlab.WithFeature(c.Request().Context(), gitlab.FeatureOther))
+	if err != nil {
+		log.Printf("Error validating GitLab token: %v", err)
+		return templates.TokenStatus(nil, describeGitLabError(err)).Render(c.Request().Context(), c.Response().Writer)
+	}
+	gitlab.SetTokenValidation(validation)
+	return templates.TokenStatus(validation, "").Render(c.Request().Context(), c.Response().Writer)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+// TakeStatusSnapshot records the current pipeline status of every project selected by any user,
+// so /api/v1/statuses?at= can answer what the dashboards showed at a point in time.
+// Snapshots older than retention are deleted. It returns how many projects were recorded.
+func TakeStatusSnapshot(ctx context.Context, client gitlab.Client, retention time.Duration) (int, error) {
+	selectedProjects, err := db.GetAllSelectedProjects()
+	if err != nil {
+		return 0, err
+	}
+
+	takenAt := time.Now().UTC()
+	statuses := fetchRepositoryStatuses(gitlab.WithFeature(ctx, gitlab.FeatureStatus), selectedProjects, client)
+	snapshots := make([]models.StatusSnapshot, 0, len(statuses))
+	for i, status := range statuses {
+		if status.RepositoryID == 0 {
+			// Not in the cache anymore, nothing meaningful to record
+			continue
+		}
+		snapshot := snapshotFromStatus(takenAt, status)
+		snapshot.TrackedRef = selectedProjects[i].Ref
+		snapshots = append(snapshots, snapshot)
+	}
+
+	if err := db.SaveStatusSnapshots(snapshots, takenAt.Add(-retention)); err != nil {
+		return 0, err
+	}
+	log.Printf("Recorded status snapshot of %d projects", len(snapshots))
+	recordPipelineMetrics(snapshots)
+
+	openCorrelatedIncidents(statuses, takenAt)
+	return len(snapshots), nil
+}
+
+// snapshotFromStatus converts a fetched status to a snapshot row
+func snapshotFromStatus(takenAt time.Time, status models.RepositoryStatus) models.StatusSnapshot {
+	snapshot := models.StatusSnapshot{
+		TakenAt:      takenAt,
+		ProjectID:    status.RepositoryID,
+		ProjectName:  status.RepositoryName,
+		ProjectPath:  status.RepositoryPath,
+		Ref:          status.Version,
+		PipelineID:   status.PipelineID,
+		Status:       status.Status,
+		PipelineDate: status.Date,
+		WebURL:       status.WebURL,
+		ProjectURL:   status.ProjectURL,
+		Stale:        status.Stale,
+		Error:        status.Error,
+	}
+	if status.LastSuccessPipeline != nil {
+		snapshot.LastSuccessID = status.LastSuccessPipeline.ID
+		snapshot.LastSuccessDate = status.LastSuccessPipeline.CreatedAt
+	}
+	return snapshot
+}
+
+// statusFromSnapshot converts a snapshot row back to the status it recorded
+func statusFromSnapshot(snapshot models.StatusSnapshot) models.RepositoryStatus {
+	status := models.RepositoryStatus{
+		RepositoryID:   snapshot.ProjectID,
+		RepositoryName: snapshot.ProjectName,
+		RepositoryPath: snapshot.ProjectPath,
+		Version:        snapshot.Ref,
+		PipelineID:     snapshot.PipelineID,
+		Status:         snapshot.Status,
+		Date:           snapshot.PipelineDate,
+		WebURL:         snapshot.WebURL,
+		ProjectURL:     snapshot.ProjectURL,
+		Stale:          snapshot.Stale,
+		Error:          snapshot.Error,
+	}
+	if snapshot.LastSuccessID != 0 {
+		status.LastSuccessPipeline = &models.Pipeline{ID: snapshot.LastSuccessID, CreatedAt: snapshot.LastSuccessDate}
+	}
+	return status
+}
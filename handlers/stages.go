@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+// finishedPipelineStatuses are the pipeline statuses whose jobs no longer change
+var finishedPipelineStatuses = map[string]bool{
+	"success":  true,
+	"failed":   true,
+	"canceled": true,
+	"skipped":  true,
+}
+
+// finishedPipelineTTL is how long details of a finished pipeline are reused. They don't change, so
+// this only bounds how long the details of projects no longer shown are kept.
+const finishedPipelineTTL = 24 * time.Hour
+
+// stagesEntry is the stage summary and newest artifacts of a project's latest finished pipeline
+type stagesEntry struct {
+	pipelineID int
+	stages     []models.StageSummary
+	artifact   *models.Job
+}
+
+// stagesCache holds the stages of the latest pipeline by project ID
+var stagesCache = newTTLCache[int, stagesEntry](detailCacheSize)
+
+// pipelineStages returns the stage summary of a pipeline and its newest job with artifacts to download,
+// or nil when it's disabled or its jobs can't be fetched. Results of finished pipelines are kept until
+// the project has a newer pipeline.
+func pipelineStages(ctx context.Context, client gitlab.Client, projectID int, pipeline *models.Pipeline) ([]models.StageSummary, *models.Job) {
+	if !statusDetails[detailStages] {
+		return nil, nil
+	}
+	if entry, ok, err := stagesCache.get(projectID); ok && entry.pipelineID == pipeline.ID {
+		if err != nil {
+			return nil, nil
+		}
+		return entry.stages, unexpiredArtifact(entry.artifact)
+	}
+
+	jobs, err := client.FetchPipelineJobs(ctx, strconv.Itoa(projectID), pipeline.ID)
+	if err != nil {
+		stagesCache.set(projectID, stagesEntry{pipelineID: pipeline.ID}, err, 0)
+		log.Printf("Error fetching jobs of pipeline %d in project %d: %v", pipeline.ID, projectID, err)
+		return nil, nil
+	}
+	stages := summarizeStages(jobs)
+	artifact := latestArtifactJob(jobs)
+
+	if finishedPipelineStatuses[pipeline.Status] {
+		stagesCache.set(projectID, stagesEntry{pipelineID: pipeline.ID, stages: stages, artifact: artifact}, nil, finishedPipelineTTL)
+	}
+	return stages, artifact
+}
+
+// latestArtifactJob returns the newest job with an artifacts archive that hasn't expired, or nil
+func latestArtifactJob(jobs []models.Job) *models.Job {
+	var latest *models.Job
+	for i, job := range jobs {
+		if job.ArtifactsFile == nil || unexpiredArtifact(&jobs[i]) == nil {
+			continue
+		}
+		if latest == nil || job.ID > latest.ID {
+			latest = &jobs[i]
+		}
+	}
+	return latest
+}
+
+// unexpiredArtifact returns job unless its artifacts have expired since its jobs were fetched
+func unexpiredArtifact(job *models.Job) *models.Job {
+	if job == nil || (job.ArtifactsExpireAt != nil && !job.ArtifactsExpireAt.After(time.Now())) {
+		return nil
+	}
+	return job
+}
+
+// forgetPipelineStages drops the cached stage summary of a project, whose latest pipeline is running again
+func forgetPipelineStages(projectID int) {
+	stagesCache.forget(projectID)
+}
+
+// stageStatusRank orders job statuses by how much they matter for the status of their stage
+var stageStatusRank = map[string]int{
+	"skipped":  0,
+	"success":  1,
+	"manual":   2,
+	"canceled": 3,
+	"pending":  4,
+	"running":  5,
+	"failed":   6,
+}
+
+// jobStageStatus returns the status a job contributes to its stage. Failures that are allowed count
+// as success and the statuses of jobs waiting to run are reported as pending.
+func jobStageStatus(job models.Job) string {
+	switch job.Status {
+	case "failed":
+		if job.AllowFailure {
+			return "success"
+		}
+		return "failed"
+	case "created", "waiting_for_resource", "preparing", "scheduled":
+		return "pending"
+	case "canceling":
+		return "canceled"
+	default:
+		return job.Status
+	}
+}
+
+// summarizeStages groups the jobs of a pipeline by stage, in the order the stages run,
+// and gives each stage the most significant status of its jobs
+func summarizeStages(jobs []models.Job) []models.StageSummary {
+	// GitLab returns the newest jobs first, jobs are created in stage order
+	sorted := make([]models.Job, len(jobs))
+	copy(sorted, jobs)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	var stages []models.StageSummary
+	index := make(map[string]int)
+	for _, job := range sorted {
+		i, ok := index[job.Stage]
+		if !ok {
+			i = len(stages)
+			index[job.Stage] = i
+			stages = append(stages, models.StageSummary{Name: job.Stage, Status: "skipped"})
+		}
+
+		status := jobStageStatus(job)
+		if stageStatusRank[status] > stageStatusRank[stages[i].Status] {
+			stages[i].Status = status
+		}
+		if status == "failed" {
+			stages[i].FailedJobs = append(stages[i].FailedJobs, job)
+		}
+	}
+	return stages
+}
@@ -1,13 +1,18 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/gorilla/sessions"
 	"github.com/labstack/echo/v4"
+	"golang.org/x/sync/errgroup"
 
 	"gitlab-status/db"
 	"gitlab-status/gitlab"
@@ -15,8 +20,142 @@ import (
 	"gitlab-status/templates"
 )
 
+// lastKnownStatuses keeps the most recent successfully fetched status per project and tracked ref,
+// used to serve stale data while GitLab is unavailable. They are also stored in the database, so
+// the status page survives a restart during a GitLab outage, and in the shared status cache if set.
+var (
+	lastKnownMu       sync.RWMutex
+	lastKnownStatuses = make(map[string]models.RepositoryStatus)
+	lastKnownSavedAt  = make(map[string]time.Time) // When the status was last written to the database
+)
+
+// StatusCache shares the last known statuses between the instances of a deployment
+type StatusCache interface {
+	Get(ctx context.Context, key string) (models.RepositoryStatus, bool, error)
+	Set(ctx context.Context, key string, status models.RepositoryStatus) error
+}
+
+// sharedStatusTimeout bounds the calls to the shared status cache, so a slow cache doesn't hold up pages
+const sharedStatusTimeout = 2 * time.Second
+
+// sharedStatuses is the status cache shared with other instances, nil when there is none
+var sharedStatuses StatusCache
+
+// SetStatusCache shares the last known statuses through cache, so every instance can serve the
+// statuses any of them fetched while GitLab is unavailable
+func SetStatusCache(cache StatusCache) {
+	sharedStatuses = cache
+}
+
+// lastKnownKey identifies a project's status for a tracked ref, empty for any ref
+func lastKnownKey(projectID int, ref string) string {
+	return fmt.Sprintf("%d:%s", projectID, ref)
+}
+
+// lastKnownPersistInterval is how often an unchanged status is written to the database again,
+// so page views don't write every project on every refresh
+const lastKnownPersistInterval = 5 * time.Minute
+
+// rememberStatus stores a successfully fetched status for the tracked ref
+func rememberStatus(status models.RepositoryStatus, ref string) {
+	key := lastKnownKey(status.RepositoryID, ref)
+	lastKnownMu.Lock()
+	previous, ok := lastKnownStatuses[key]
+	lastKnownStatuses[key] = status
+	unchanged := ok && previous.PipelineID == status.PipelineID && previous.Status == status.Status &&
+		status.FetchedAt.Sub(lastKnownSavedAt[key]) < lastKnownPersistInterval
+	if !unchanged {
+		lastKnownSavedAt[key] = status.FetchedAt
+	}
+	lastKnownMu.Unlock()
+
+	if sharedStatuses != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sharedStatusTimeout)
+		if err := sharedStatuses.Set(ctx, key, status); err != nil {
+			log.Printf("Error sharing last known status: %v", err)
+		}
+		cancel()
+	}
+	if unchanged {
+		return
+	}
+	if err := db.SaveLastKnownStatus(status, ref); err != nil {
+		log.Printf("Error saving last known status: %v", err)
+	}
+}
+
+// rememberedStatus returns the last successfully fetched status of a project kept in memory, or
+// the one in the shared status cache when another instance fetched it more recently
+func rememberedStatus(projectID int, ref string) (models.RepositoryStatus, bool) {
+	key := lastKnownKey(projectID, ref)
+	lastKnownMu.RLock()
+	status, ok := lastKnownStatuses[key]
+	lastKnownMu.RUnlock()
+	if sharedStatuses == nil {
+		return status, ok
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sharedStatusTimeout)
+	defer cancel()
+	shared, found, err := sharedStatuses.Get(ctx, key)
+	if err != nil {
+		log.Printf("Error loading shared last known status: %v", err)
+	}
+	if found && (!ok || shared.FetchedAt.After(status.FetchedAt)) {
+		return shared, true
+	}
+	return status, ok
+}
+
+// lastKnownStatus returns the last successfully fetched status of a project marked as stale,
+// falling back to the stored one when it wasn't fetched since the start
+func lastKnownStatus(projectID int, ref string) (models.RepositoryStatus, bool) {
+	status, ok := rememberedStatus(projectID, ref)
+	if !ok {
+		stored, err := db.GetLastKnownStatus(projectID, ref)
+		if err != nil {
+			return status, false
+		}
+		status = stored.Status
+		status.FetchedAt = stored.FetchedAt
+		lastKnownMu.Lock()
+		lastKnownStatuses[lastKnownKey(projectID, ref)] = status
+		lastKnownMu.Unlock()
+	}
+	status.Stale = true
+	return status, true
+}
+
+// statusNoPipelines is the status of projects that never ran a pipeline
+const statusNoPipelines = "none"
+
+// errUnauthorizedMessage describes pipelines that couldn't be fetched because the token was rejected
+const errUnauthorizedMessage = "GitLab token is invalid or lacks access to this project"
+
+// describeGitLabError turns a GitLab client error into a short explanation for the status page
+func describeGitLabError(err error) string {
+	switch {
+	case errors.Is(err, gitlab.ErrUnauthorized):
+		return errUnauthorizedMessage
+	case errors.Is(err, gitlab.ErrNotFound):
+		return "Project not found in GitLab"
+	case errors.Is(err, gitlab.ErrRateLimited):
+		return "GitLab API rate limit exceeded"
+	case errors.Is(err, gitlab.ErrTimeout):
+		return "GitLab did not respond in time"
+	case errors.Is(err, gitlab.ErrCircuitOpen):
+		return "GitLab is currently unreachable"
+	case errors.Is(err, gitlab.ErrBudgetExceeded):
+		return "GitLab API call budget exhausted"
+	case errors.Is(err, gitlab.ErrRequestBudgetExceeded):
+		return "Skipped, this page load reached its GitLab API call limit"
+	default:
+		return "GitLab API error"
+	}
+}
+
 // StatusPageHandler handles the status page request
-func StatusPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL, token string) error {
+func StatusPageHandler(c echo.Context, store sessions.Store, client gitlab.Client) error {
 	session, _ := store.Get(c.Request(), "gitlab-status-session")
 
 	// Get user ID from session
@@ -25,6 +164,19 @@ func StatusPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL, t
 		return c.Redirect(http.StatusSeeOther, "/logout")
 	}
 
+	// ?anonymize=on or off toggles stable pseudonyms for project names, for sharing screenshots
+	if toggle := c.QueryParam("anonymize"); toggle != "" {
+		session.Values["anonymize"] = toggle == "on"
+		session.Save(c.Request(), c.Response())
+		return c.Redirect(http.StatusSeeOther, "/")
+	}
+	anonymize, _ := session.Values["anonymize"].(bool)
+	username := session.Values["username"].(string)
+	display := models.StatusDisplay{Palette: models.PaletteStandard}
+	if user, err := db.GetUser(userID); err == nil {
+		display = user.StatusDisplay()
+	}
+
 	// Get selected projects from database
 	selectedProjects, err := db.GetSelectedProjects(userID)
 	if err != nil {
@@ -32,87 +184,225 @@ func StatusPageHandler(c echo.Context, store *sessions.CookieStore, gitlabURL, t
 	}
 
 	var statuses []models.RepositoryStatus
+	var warnings []string
+
+	incidents, err := db.GetActiveIncidents()
+	if err != nil {
+		log.Printf("Error fetching active incidents: %v", err)
+	}
+
+	// Hide selected projects the user is no longer a member of
+	visible, err := visibleProjectIDs(c.Request().Context(), userID)
+	if err != nil {
+		log.Printf("Error resolving GitLab memberships for user %d: %v", userID, err)
+		warnings = append(warnings, "Cannot show projects: "+err.Error())
+		selectedProjects = nil
+	}
+	selectedProjects = sortByCriticality(filterVisibleSelectedProjects(selectedProjects, visible))
+	rememberSelections(userID, selectedProjects)
 
 	// If no projects are selected yet, show a message
 	if len(selectedProjects) == 0 {
 		// Return status template with no projects flag
-		return templates.Status(session.Values["username"].(string), true, statuses).Render(c.Request().Context(), c.Response().Writer)
+		return templates.Status(username, display, csrfToken(c), anonymize, true, warnings, incidents, statuses).Render(c.Request().Context(), c.Response().Writer)
 	}
 
-	for _, selectedProject := range selectedProjects {
-		// Get project details from cache
-		cachedProject, err := db.GetCachedProject(selectedProject.ProjectID)
-		if err != nil {
-			log.Printf("Error fetching project from cache for ID %d: %v", selectedProject.ProjectID, err)
-			statuses = append(statuses, models.RepositoryStatus{
-				RepositoryName: selectedProject.Path,
-				RepositoryPath: selectedProject.Path,
-				Version:        "N/A",
-				PipelineID:     0,
-				Status:         "Error",
-				Date:           time.Time{},
-			})
-			continue
-		}
+	statuses = fetchRepositoryStatuses(gitlab.WithFeature(c.Request().Context(), gitlab.FeatureStatus), selectedProjects, client)
+	statuses = applyIncidents(statuses, incidents)
+	if anonymize {
+		statuses = anonymizeStatuses(statuses)
+		incidents = anonymizeIncidents(incidents)
+		username = "demo"
+	}
 
-		// Convert cached project to Project
-		project := models.Project{
-			ID:                cachedProject.ID,
-			Name:              cachedProject.Name,
-			NameWithNamespace: cachedProject.NameWithNamespace,
-			Path:              cachedProject.Path,
-			PathWithNamespace: cachedProject.PathWithNamespace,
-			WebURL:            cachedProject.WebURL,
-		}
+	// If the request is an HTMX request, render the partial table only
+	if c.Request().Header.Get("HX-Request") != "" {
+		return templates.StatusTable(statuses).Render(c.Request().Context(), c.Response().Writer)
+	}
 
-		// Get latest pipeline
-		latestPipeline, err := gitlab.FetchLatestPipeline(gitlabURL, fmt.Sprintf("%d", project.ID), token)
-		if err != nil {
-			log.Printf("Error fetching pipeline for %s: %v", project.PathWithNamespace, err)
-			statuses = append(statuses, models.RepositoryStatus{
-				RepositoryID:   project.ID,
-				RepositoryName: project.Name,
-				RepositoryPath: project.PathWithNamespace,
-				Version:        "N/A",
-				PipelineID:     0,
-				Status:         "Error",
-				Date:           time.Time{},
-				ProjectURL:     project.WebURL,
-			})
-			continue
+	if warning := gitlab.TokenExpiryWarning(); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	if warning := callBudgetWarning(c); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	stale := false
+	for _, status := range statuses {
+		stale = stale || status.Stale
+	}
+	// The status table explains stale rows itself
+	if gitlab.CircuitOpen() && !stale {
+		warnings = append(warnings, "GitLab is currently unreachable. Showing the last known pipeline statuses where available.")
+	}
+	unblocking := 0
+	for _, status := range statuses {
+		if failureBlocksNothing(status) {
+			unblocking++
+		}
+	}
+	if unblocking > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d project(s) have failing pipelines on a protected branch that don't block merges, because \"Pipelines must succeed\" is disabled.", unblocking))
+	}
+	for _, status := range statuses {
+		if status.Error == errUnauthorizedMessage {
+			warnings = append(warnings, "GitLab rejected the API token for some projects. Check that it is valid and has the read_api scope.")
+			break
 		}
+	}
 
-		// Get recent pipelines for hover view
-		recentPipelines, err := gitlab.FetchPipelines(gitlabURL, fmt.Sprintf("%d", project.ID), token, 10)
-		if err != nil {
-			recentPipelines = []models.Pipeline{}
+	return templates.Status(username, display, csrfToken(c), anonymize, false, warnings, incidents, statuses).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// statusFetchConcurrency limits how many projects are fetched from GitLab in parallel
+var statusFetchConcurrency = 8
+
+// SetStatusFetchConcurrency sets how many projects the status page fetches in parallel
+func SetStatusFetchConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	statusFetchConcurrency = n
+	log.Printf("Fetching pipeline statuses with concurrency %d", n)
+}
+
+// sortByCriticality orders selected projects by their criticality, critical ones first, keeping
+// the order of projects of the same criticality
+func sortByCriticality(selectedProjects []models.SelectedProject) []models.SelectedProject {
+	sort.SliceStable(selectedProjects, func(i, j int) bool {
+		return models.CriticalityWeight(selectedProjects[i].Criticality) > models.CriticalityWeight(selectedProjects[j].Criticality)
+	})
+	return selectedProjects
+}
+
+// fetchRepositoryStatuses fetches the pipeline status of every selected project
+// using a bounded worker pool, keeping the order of the selected projects
+func fetchRepositoryStatuses(ctx context.Context, selectedProjects []models.SelectedProject, client gitlab.Client) []models.RepositoryStatus {
+	statuses := make([]models.RepositoryStatus, len(selectedProjects))
+
+	var g errgroup.Group
+	g.SetLimit(statusFetchConcurrency)
+	for i, selectedProject := range selectedProjects {
+		g.Go(func() error {
+			statuses[i] = fetchRepositoryStatus(ctx, selectedProject, client)
+			// Remembered statuses are shared by users who may weigh the project differently
+			statuses[i].Criticality = models.NormalizeCriticality(selectedProject.Criticality)
+			return nil
+		})
+	}
+	g.Wait()
+
+	return statuses
+}
+
+// fetchRepositoryStatus fetches the pipeline status of a single selected project
+func fetchRepositoryStatus(ctx context.Context, selectedProject models.SelectedProject, client gitlab.Client) models.RepositoryStatus {
+	// Get project details from cache
+	cachedProject, err := db.GetCachedProject(selectedProject.ProjectID)
+	if err != nil {
+		log.Printf("Error fetching project from cache for ID %d: %v", selectedProject.ProjectID, err)
+		return models.RepositoryStatus{
+			RepositoryName: selectedProject.Path,
+			RepositoryPath: selectedProject.Path,
+			Version:        "N/A",
+			PipelineID:     0,
+			Status:         "Error",
+			Date:           time.Time{},
 		}
+	}
 
-		// Get last successful pipeline
-		lastSuccess, err := gitlab.FetchLastSuccessPipeline(gitlabURL, fmt.Sprintf("%d", project.ID), token)
-		if err != nil {
-			lastSuccess = nil
+	// Convert cached project to Project
+	project := models.Project{
+		ID:                cachedProject.ID,
+		Name:              cachedProject.Name,
+		NameWithNamespace: cachedProject.NameWithNamespace,
+		Path:              cachedProject.Path,
+		PathWithNamespace: cachedProject.PathWithNamespace,
+		WebURL:            cachedProject.WebURL,
+	}
+
+	// Get latest pipeline, of the preferred branch if the user chose one
+	ref := selectedProject.Ref
+	latestPipeline, err := client.FetchLatestPipeline(ctx, fmt.Sprintf("%d", project.ID), ref)
+	if errors.Is(err, gitlab.ErrNoPipelines) {
+		return models.RepositoryStatus{
+			RepositoryID:   project.ID,
+			RepositoryName: project.Name,
+			RepositoryPath: project.PathWithNamespace,
+			Version:        ref,
+			Status:         statusNoPipelines,
+			ProjectURL:     project.WebURL,
+		}
+	}
+	if err != nil {
+		log.Printf("Error fetching pipeline for %s: %v", project.PathWithNamespace, err)
+		if stale, ok := lastKnownStatus(project.ID, ref); ok {
+			return stale
+		}
+		return models.RepositoryStatus{
+			RepositoryID:   project.ID,
+			RepositoryName: project.Name,
+			RepositoryPath: project.PathWithNamespace,
+			Version:        "N/A",
+			PipelineID:     0,
+			Status:         "Error",
+			Date:           time.Time{},
+			ProjectURL:     project.WebURL,
+			Error:          describeGitLabError(err),
 		}
+	}
 
-		statuses = append(statuses, models.RepositoryStatus{
-			RepositoryID:        project.ID,
-			RepositoryName:      project.Name,
-			RepositoryPath:      project.PathWithNamespace,
-			Version:             latestPipeline.Ref,
-			PipelineID:          latestPipeline.ID,
-			Status:              latestPipeline.Status,
-			Date:                latestPipeline.CreatedAt,
-			WebURL:              latestPipeline.WebURL,
-			LastSuccessPipeline: lastSuccess,
-			RecentPipelines:     recentPipelines,
-			ProjectURL:          project.WebURL,
-		})
+	// Get recent pipelines for hover view
+	recentPipelines, err := client.FetchPipelines(ctx, fmt.Sprintf("%d", project.ID), ref, 10)
+	if err != nil {
+		recentPipelines = []models.Pipeline{}
 	}
 
-	// If the request is an HTMX request, render the partial table only
-	if c.Request().Header.Get("HX-Request") != "" {
-		return templates.StatusTable(statuses).Render(c.Request().Context(), c.Response().Writer)
+	// Get last successful pipeline
+	lastSuccess, err := client.FetchLastSuccessPipeline(ctx, fmt.Sprintf("%d", project.ID), ref)
+	if err != nil {
+		lastSuccess = nil
 	}
 
-	return templates.Status(session.Values["username"].(string), false, statuses).Render(c.Request().Context(), c.Response().Writer)
+	seen := append([]models.Pipeline{*latestPipeline}, recentPipelines...)
+	if lastSuccess != nil {
+		seen = append(seen, *lastSuccess)
+	}
+	recordPipelineHistory(project.ID, seen...)
+
+	status := models.RepositoryStatus{
+		RepositoryID:        project.ID,
+		RepositoryName:      project.Name,
+		RepositoryPath:      project.PathWithNamespace,
+		Version:             latestPipeline.Ref,
+		PipelineID:          latestPipeline.ID,
+		Status:              latestPipeline.Status,
+		Source:              latestPipeline.Source,
+		Date:                latestPipeline.CreatedAt,
+		WebURL:              latestPipeline.WebURL,
+		LastSuccessPipeline: lastSuccess,
+		RecentPipelines:     recentPipelines,
+		TestReport:          pipelineTestReport(ctx, client, project.ID, latestPipeline),
+		Coverage:            pipelineCoverage(ctx, client, project.ID, *latestPipeline),
+		ProjectURL:          project.WebURL,
+		HasAvatar:           cachedProject.AvatarURL != "",
+		Protection:          refProtection(ctx, client, project.ID, latestPipeline.Ref),
+		ClusterAgents:       clusterAgents(ctx, client, project.ID),
+		LatestRelease:       latestRelease(ctx, client, project.ID, project.WebURL),
+		ScheduleProblems:    scheduleProblems(ctx, client, project.ID),
+		FetchedAt:           time.Now(),
+	}
+	status.Stages, status.LatestArtifact = pipelineStages(ctx, client, project.ID, latestPipeline)
+	if previous := previousFinishedPipeline(latestPipeline, recentPipelines); previous != nil && status.Coverage != nil {
+		status.PreviousCoverage = pipelineCoverage(ctx, client, project.ID, *previous)
+	}
+	if status.Downstream = downstreamBridges(ctx, client, project.ID, latestPipeline); len(status.Downstream) > 0 {
+		status.OwnStatus = latestPipeline.Status
+		status.Status = aggregateStatus(latestPipeline.Status, status.Downstream)
+	}
+	status.Planning = planningContext(ctx, client, *cachedProject, status.Status)
+	// Details skipped for the request's API call limit would replace complete ones
+	if !gitlab.RequestBudgetExceeded(ctx) {
+		rememberStatus(status, ref)
+	}
+	return status
 }
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+func TestStatusPageHandlerReplaysFixtures(t *testing.T) {
+	user := setupTestDatabase(t)
+	store := sessions.NewCookieStore([]byte("test-session-secret"))
+	if err := gitlab.Initialize(10*time.Second, gitlab.TransportOptions{ReplayDir: "../testdata/gitlab"}); err != nil {
+		t.Fatalf("initializing GitLab client: %v", err)
+	}
+	client := gitlab.NewHTTPClient("https://gitlab.example.com", "replay")
+
+	selectTestProject(t, user.ID, models.Project{ID: 1, Name: "api", PathWithNamespace: "platform/api", WebURL: "https://gitlab.example.com/platform/api"})
+	selectTestProject(t, user.ID, models.Project{ID: 2, Name: "web", PathWithNamespace: "platform/web", WebURL: "https://gitlab.example.com/platform/web"})
+
+	c, rec := loggedInContext(t, store, user, httptest.NewRequest(http.MethodGet, "/", nil))
+	if err := StatusPageHandler(c, store, client); err != nil {
+		t.Fatalf("StatusPageHandler: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want 200", rec.Code)
+	}
+
+	page := rec.Body.String()
+	for _, want := range []string{
+		"platform/api",
+		"platform/web",
+		`/platform/api/-/pipelines/1102`, // Latest pipeline of api, failed
+		`/platform/api/-/pipelines/1101`, // Last successful pipeline of api
+		`/platform/web/-/pipelines/2201`,
+		"status-failed",
+		"78.4%", // Coverage of the failed pipeline
+		"-1.7",  // Change since the previous pipeline's 80.1%
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("status page doesn't contain %q", want)
+		}
+	}
+	if strings.Contains(page, `status-badge status-error`) {
+		t.Error("status page shows an error, a request had no fixture")
+	}
+}
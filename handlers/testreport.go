@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+// testReportEntry is the test report of a project's latest finished pipeline
+type testReportEntry struct {
+	pipelineID int
+	report     *models.TestReportSummary
+}
+
+// testReportCache holds the test report of the latest pipeline by project ID
+var testReportCache = newTTLCache[int, testReportEntry](detailCacheSize)
+
+// pipelineTestReport returns the test case counts of a pipeline, or nil when it's disabled, the pipeline
+// has no test reports or they can't be fetched. Reports of finished pipelines are kept until the project
+// has a newer pipeline.
+func pipelineTestReport(ctx context.Context, client gitlab.Client, projectID int, pipeline *models.Pipeline) *models.TestReportSummary {
+	if !statusDetails[detailTests] {
+		return nil
+	}
+	if entry, ok, err := testReportCache.get(projectID); ok && entry.pipelineID == pipeline.ID {
+		if err != nil {
+			return nil
+		}
+		return entry.report
+	}
+
+	report, err := client.FetchTestReportSummary(ctx, strconv.Itoa(projectID), pipeline.ID)
+	if err != nil {
+		testReportCache.set(projectID, testReportEntry{pipelineID: pipeline.ID}, err, 0)
+		log.Printf("Error fetching test report of pipeline %d in project %d: %v", pipeline.ID, projectID, err)
+		return nil
+	}
+
+	if finishedPipelineStatuses[pipeline.Status] {
+		testReportCache.set(projectID, testReportEntry{pipelineID: pipeline.ID, report: report}, nil, finishedPipelineTTL)
+	}
+	return report
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gitlab-status/gitlab"
+)
+
+const (
+	// detailCacheSize is how many entries each cache of optional status details holds, enough for
+	// every selected project of a large deployment
+	detailCacheSize = 5000
+	// detailErrorTTL is how long a failed lookup of a status detail is reused, so projects whose
+	// lookups fail, e.g. for a missing permission, aren't asked again on every refresh
+	detailErrorTTL = 5 * time.Minute
+)
+
+// ttlEntry is a cached value or the error looking it up
+type ttlEntry[V any] struct {
+	value     V
+	err       error
+	expiresAt time.Time
+}
+
+// ttlCache keeps looked up values and errors per key until they expire. It holds at most size
+// entries; when full, expired entries are dropped first, then the one expiring soonest.
+type ttlCache[K comparable, V any] struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[K]ttlEntry[V]
+}
+
+// newTTLCache returns an empty cache holding at most size entries
+func newTTLCache[K comparable, V any](size int) *ttlCache[K, V] {
+	return &ttlCache[K, V]{size: size, entries: make(map[K]ttlEntry[V])}
+}
+
+// get returns the value or error cached for key and whether there is one that hasn't expired
+func (c *ttlCache[K, V]) get(key K) (V, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		var zero V
+		return zero, false, nil
+	}
+	return entry.value, true, entry.err
+}
+
+// set keeps value for ttl, or err for detailErrorTTL when the lookup failed; a zero ttl keeps
+// only errors. Errors of lookups that didn't fail at GitLab, because the request's call limit was
+// reached or it was canceled, aren't kept, so the next page load tries again.
+func (c *ttlCache[K, V]) set(key K, value V, err error, ttl time.Duration) {
+	if err != nil {
+		if errors.Is(err, gitlab.ErrRequestBudgetExceeded) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return
+		}
+		ttl = detailErrorTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		c.evict()
+	}
+	c.entries[key] = ttlEntry[V]{value: value, err: err, expiresAt: time.Now().Add(ttl)}
+}
+
+// evict makes room for one entry, dropping the expired entries or else the one expiring soonest
+func (c *ttlCache[K, V]) evict() {
+	now := time.Now()
+	var soonest K
+	var soonestAt time.Time
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+			continue
+		}
+		if soonestAt.IsZero() || entry.expiresAt.Before(soonestAt) {
+			soonest, soonestAt = key, entry.expiresAt
+		}
+	}
+	if len(c.entries) >= c.size {
+		delete(c.entries, soonest)
+	}
+}
+
+// forget drops the entry of key, e.g. after the looked up data changed
+func (c *ttlCache[K, V]) forget(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
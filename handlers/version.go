@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+)
+
+// releaseTTL is how long the latest release of a project is reused
+const releaseTTL = 10 * time.Minute
+
+// releaseCache holds the latest release of projects by project ID, nil for projects without any
+var releaseCache = newTTLCache[int, *models.Release](detailCacheSize)
+
+// latestRelease returns the latest release of a project. Projects that only tag their versions get
+// their latest tag as a release without notes. It returns nil when it's disabled, there are neither
+// or they can't be fetched.
+func latestRelease(ctx context.Context, client gitlab.Client, projectID int, projectURL string) *models.Release {
+	if !statusDetails[detailReleases] {
+		return nil
+	}
+	if release, ok, err := releaseCache.get(projectID); ok {
+		if err != nil {
+			return nil
+		}
+		return release
+	}
+
+	release, err := fetchLatestRelease(ctx, client, projectID, projectURL)
+	releaseCache.set(projectID, release, err, releaseTTL)
+	if err != nil {
+		log.Printf("Error fetching latest release of project %d: %v", projectID, err)
+		return nil
+	}
+	return release
+}
+
+// fetchLatestRelease looks up the latest release of a project, or its latest tag as a release
+func fetchLatestRelease(ctx context.Context, client gitlab.Client, projectID int, projectURL string) (*models.Release, error) {
+	release, err := client.FetchLatestRelease(ctx, strconv.Itoa(projectID))
+	if err != nil || release != nil {
+		return release, err
+	}
+	tag, err := client.FetchLatestTag(ctx, strconv.Itoa(projectID))
+	if err != nil || tag == nil {
+		return nil, err
+	}
+	release = &models.Release{Name: tag.Name, TagName: tag.Name, ReleasedAt: tag.Commit.CreatedAt}
+	release.Links.Self = projectURL + "/-/tags/" + tag.Name
+	return release, nil
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+	"gitlab-status/models"
+	"gitlab-status/templates"
+)
+
+// errNoGitLabToken is returned when membership enforcement is enabled and the user has no personal token
+var errNoGitLabToken = errors.New("set your personal GitLab token under Settings > GitLab Access to see projects")
+
+// membershipTTL is how long a user's resolved GitLab memberships are reused
+const membershipTTL = 10 * time.Minute
+
+// membershipEntry holds the project IDs a user is a member of
+type membershipEntry struct {
+	projectIDs map[int]bool
+	fetchedAt  time.Time
+}
+
+var (
+	enforceMembership bool
+	membershipURL     string
+
+	membershipMu    sync.Mutex
+	membershipCache = make(map[int64]membershipEntry)
+)
+
+// SetMembershipEnforcement restricts the cached projects a user can see and select to the projects
+// their personal GitLab token is a member of, so the shared server token doesn't leak project names
+func SetMembershipEnforcement(enabled bool, gitlabURL string) {
+	enforceMembership = enabled
+	membershipURL = gitlabURL
+	if enabled {
+		log.Printf("Restricting visible projects to each user's GitLab memberships")
+	}
+}
+
+// visibleProjectIDs returns the IDs of the projects a user may see, or nil when membership enforcement is disabled
+func visibleProjectIDs(ctx context.Context, userID int64) (map[int]bool, error) {
+	if !enforceMembership {
+		return nil, nil
+	}
+
+	membershipMu.Lock()
+	entry, ok := membershipCache[userID]
+	membershipMu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < membershipTTL {
+		return entry.projectIDs, nil
+	}
+
+	user, err := db.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.GitLabToken == "" {
+		return nil, errNoGitLabToken
+	}
+
+	projectIDs, err := fetchMemberships(ctx, user.GitLabToken)
+	if err != nil {
+		return nil, err
+	}
+
+	membershipMu.Lock()
+	membershipCache[userID] = membershipEntry{projectIDs: projectIDs, fetchedAt: time.Now()}
+	membershipMu.Unlock()
+
+	return projectIDs, nil
+}
+
+// fetchMemberships resolves the projects a personal token is a member of
+func fetchMemberships(ctx context.Context, token string) (map[int]bool, error) {
+	projects, err := gitlab.NewHTTPClient(membershipURL, token).FetchMemberProjects(gitlab.WithFeature(ctx, gitlab.FeatureMembership))
+	if err != nil {
+		return nil, err
+	}
+	projectIDs := make(map[int]bool, len(projects))
+	for _, project := range projects {
+		projectIDs[project.ID] = true
+	}
+	return projectIDs, nil
+}
+
+// forgetMemberships drops the cached memberships of a user, e.g. after their token changed
+func forgetMemberships(userID int64) {
+	membershipMu.Lock()
+	defer membershipMu.Unlock()
+	delete(membershipCache, userID)
+}
+
+// visibleGroup reports whether a user may see a cached group: always when membership enforcement
+// is disabled, otherwise when one of the projects they may see is in the group or its subgroups
+func visibleGroup(ctx context.Context, userID int64, group models.CachedGroup) (bool, error) {
+	visible, err := visibleProjectIDs(ctx, userID)
+	if err != nil || visible == nil {
+		return err == nil, err
+	}
+	projects, err := db.GetCachedProjects()
+	if err != nil {
+		return false, err
+	}
+	prefix := group.FullPath + "/"
+	for _, project := range projects {
+		if visible[project.ID] && strings.HasPrefix(project.PathWithNamespace, prefix) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// filterVisibleCachedProjects keeps the cached projects in visible; a nil set keeps everything
+func filterVisibleCachedProjects(projects []models.CachedProject, visible map[int]bool) []models.CachedProject {
+	if visible == nil {
+		return projects
+	}
+	var result []models.CachedProject
+	for _, project := range projects {
+		if visible[project.ID] {
+			result = append(result, project)
+		}
+	}
+	return result
+}
+
+// filterVisibleSelectedProjects keeps the selected projects in visible; a nil set keeps everything
+func filterVisibleSelectedProjects(projects []models.SelectedProject, visible map[int]bool) []models.SelectedProject {
+	if visible == nil {
+		return projects
+	}
+	var result []models.SelectedProject
+	for _, project := range projects {
+		if visible[project.ProjectID] {
+			result = append(result, project)
+		}
+	}
+	return result
+}
+
+// GitLabAccessPageHandler shows whether the user has a personal GitLab token configured
+func GitLabAccessPageHandler(c echo.Context, store sessions.Store) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+
+	user, err := db.GetUser(userID)
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+
+	return templates.GitLabAccess(user.Username, csrfToken(c), membershipURL, user.GitLabToken != "", enforceMembership, "", "").
+		Render(c.Request().Context(), c.Response().Writer)
+}
+
+// SaveGitLabAccessHandler validates and stores the user's personal GitLab token
+func SaveGitLabAccessHandler(c echo.Context, store sessions.Store) error {
+	session, _ := store.Get(c.Request(), "gitlab-status-session")
+	userID, ok := session.Values["user_id"].(int64)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+
+	user, err := db.GetUser(userID)
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/logout")
+	}
+
+	token := strings.TrimSpace(c.FormValue("gitlab_token"))
+	message := "Personal token removed."
+	if token != "" {
+		// Make sure the token works before storing it
+		projectIDs, err := fetchMemberships(c.Request().Context(), token)
+		if err != nil {
+			log.Printf("Rejected GitLab token for user %s: %v", user.Username, err)
+			return templates.GitLabAccess(user.Username, csrfToken(c), membershipURL, user.GitLabToken != "", enforceMembership, "",
+				"The token could not be verified: "+err.Error()).Render(c.Request().Context(), c.Response().Writer)
+		}
+		message = fmt.Sprintf("Personal token saved. You are a member of %d projects.", len(projectIDs))
+	}
+
+	if err := db.SetUserGitLabToken(userID, token); err != nil {
+		return templates.GitLabAccess(user.Username, csrfToken(c), membershipURL, user.GitLabToken != "", enforceMembership, "", err.Error()).
+			Render(c.Request().Context(), c.Response().Writer)
+	}
+	forgetMemberships(userID)
+
+	return templates.GitLabAccess(user.Username, csrfToken(c), membershipURL, token != "", enforceMembership, message, "").
+		Render(c.Request().Context(), c.Response().Writer)
+}
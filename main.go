@@ -1,10 +1,21 @@
 package main
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/gob"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"runtime/debug"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	_ "github.com/a-h/templ"
@@ -12,23 +23,373 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/redis/go-redis/v9"
 
 	"gitlab-status/db"
 	"gitlab-status/gitlab"
 	"gitlab-status/handlers"
+	"gitlab-status/redisstore"
+	"gitlab-status/templates"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
 func init() {
 	// Register map[string]bool for storing expanded path information
 	gob.Register(map[string]bool{})
 }
 
+// appVersion returns the version set at build time, or the VCS revision Go recorded for development builds
+func appVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+				return "dev-" + setting.Value[:12]
+			}
+		}
+	}
+	return version
+}
+
+// databaseOptions reads the database settings from the environment, SQLite unless DB_DRIVER selects Postgres
+func databaseOptions() db.Options {
+	dbOptions := db.Options{
+		Driver:          os.Getenv("DB_DRIVER"),
+		DSN:             os.Getenv("DB_PATH"),
+		MaxOpenConns:    10,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: time.Hour,
+	}
+	if dbOptions.Driver == db.DriverPostgres {
+		dbOptions.DSN = os.Getenv("DATABASE_URL")
+		if dbOptions.DSN == "" {
+			log.Fatal("DATABASE_URL not set, it is required with DB_DRIVER=postgres")
+		}
+	} else if dbOptions.DSN == "" {
+		dbOptions.DSN = "gitlab-status.db" // Default SQLite database file
+	}
+	if n, err := strconv.Atoi(os.Getenv("DB_MAX_OPEN_CONNS")); err == nil && n > 0 {
+		dbOptions.MaxOpenConns = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("DB_MAX_IDLE_CONNS")); err == nil && n >= 0 {
+		dbOptions.MaxIdleConns = n
+	}
+	if minutes, err := strconv.Atoi(os.Getenv("DB_CONN_MAX_LIFETIME_MINUTES")); err == nil && minutes > 0 {
+		dbOptions.ConnMaxLifetime = time.Duration(minutes) * time.Minute
+	}
+	return dbOptions
+}
+
+// runMigrateCommand applies, lists or rolls back the database migrations
+func runMigrateCommand(args []string) {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	if err := db.Open(databaseOptions()); err != nil {
+		log.Fatal("Failed to open database: ", err)
+	}
+
+	switch command {
+	case "up":
+		if err := db.Migrate(); err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Database schema is up to date")
+	case "status":
+		migrations, err := db.MigrationStatus()
+		if err != nil {
+			log.Fatal("Failed to read migrations: ", err)
+		}
+		for _, migration := range migrations {
+			if migration.IsApplied() {
+				fmt.Printf("%s\tapplied %s\n", migration, migration.MigratedAt.Format(time.RFC3339))
+			} else {
+				fmt.Printf("%s\tpending\n", migration)
+			}
+		}
+	case "rollback":
+		group, err := db.RollbackMigrations()
+		if err != nil {
+			log.Fatal("Failed to roll back migrations: ", err)
+		}
+		if group.IsZero() {
+			log.Println("No migrations to roll back")
+		} else {
+			log.Printf("Rolled back %s", group)
+		}
+	default:
+		log.Fatalf("Unknown migrate command %q, use up, status or rollback", command)
+	}
+}
+
+// configureEncryption sets the keys secrets are stored with from ENCRYPTION_KEY and the
+// comma-separated keys used before, ENCRYPTION_KEY_PREVIOUS
+func configureEncryption() {
+	var previous []string
+	for _, key := range strings.Split(os.Getenv("ENCRYPTION_KEY_PREVIOUS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			previous = append(previous, key)
+		}
+	}
+	if err := db.SetEncryptionKeys(os.Getenv("ENCRYPTION_KEY"), previous); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// encryptStoredSecrets encrypts the secrets stored in plaintext before ENCRYPTION_KEY was set
+// and warns about the ones encrypted with a key that isn't configured anymore
+func encryptStoredSecrets() {
+	result, err := db.EncryptSecrets(context.Background())
+	if err != nil {
+		log.Fatal("Failed to encrypt stored secrets: ", err)
+	}
+	if result.Updated > 0 {
+		log.Printf("Encrypted %d stored secrets with ENCRYPTION_KEY", result.Updated)
+	}
+	if result.Unreadable > 0 {
+		log.Printf("Warning: %d stored secrets are encrypted with a key that isn't configured; add it to ENCRYPTION_KEY_PREVIOUS or have the users enter their tokens again", result.Unreadable)
+	}
+}
+
+// runSecretsCommand stores the secrets again with the current ENCRYPTION_KEY, decrypting them
+// with it or the keys in ENCRYPTION_KEY_PREVIOUS. Without ENCRYPTION_KEY they are decrypted.
+func runSecretsCommand(args []string) {
+	if len(args) != 1 || args[0] != "rotate" {
+		log.Fatal("Usage: ENCRYPTION_KEY=<new key> ENCRYPTION_KEY_PREVIOUS=<old key> gitlab-status secrets rotate")
+	}
+	configureEncryption()
+	if err := db.Initialize(databaseOptions()); err != nil {
+		log.Fatal("Failed to initialize database: ", err)
+	}
+
+	result, err := db.RotateSecrets(context.Background())
+	if err != nil {
+		log.Fatal("Failed to rotate secrets: ", err)
+	}
+	if os.Getenv("ENCRYPTION_KEY") == "" {
+		log.Printf("Decrypted %d stored secrets", result.Updated)
+	} else {
+		log.Printf("Encrypted %d stored secrets with the new key", result.Updated)
+	}
+	if result.Unreadable > 0 {
+		log.Fatalf("%d stored secrets are encrypted with none of the configured keys; add their key to ENCRYPTION_KEY_PREVIOUS and run again", result.Unreadable)
+	}
+}
+
+// runCacheCommand exports the GitLab structure cache to a snapshot file or replaces it with one.
+// Files ending in .gz are compressed.
+func runCacheCommand(args []string) {
+	if len(args) != 2 || (args[0] != "export" && args[0] != "import") {
+		log.Fatal("Usage: gitlab-status cache export|import <file>")
+	}
+	gitlabURL := os.Getenv("GITLAB_URL")
+	if gitlabURL == "" {
+		log.Fatal("GITLAB_URL not set, it names the instance of the snapshot")
+	}
+	if err := db.Initialize(databaseOptions()); err != nil {
+		log.Fatal("Failed to initialize database: ", err)
+	}
+
+	path := args[1]
+	if args[0] == "export" {
+		groups, projects, err := exportCacheSnapshot(path, gitlabURL)
+		if err != nil {
+			log.Fatal("Failed to export the cache: ", err)
+		}
+		log.Printf("Exported %d groups and %d projects to %s", groups, projects, path)
+		return
+	}
+	groups, projects, err := importCacheSnapshot(path, gitlabURL)
+	if err != nil {
+		log.Fatal("Failed to import the cache: ", err)
+	}
+	log.Printf("Imported %d groups and %d projects from %s", groups, projects, path)
+}
+
+// exportCacheSnapshot writes the structure cache to a snapshot file
+func exportCacheSnapshot(path, gitlabURL string) (int, int, error) {
+	var groups, projects int
+	err := writeDataFile(path, func(w io.Writer) error {
+		var err error
+		groups, projects, err = db.ExportCacheSnapshot(w, gitlabURL)
+		return err
+	})
+	return groups, projects, err
+}
+
+// importCacheSnapshot replaces the structure cache with a snapshot file
+func importCacheSnapshot(path, gitlabURL string) (int, int, error) {
+	var groups, projects int
+	err := readDataFile(path, func(r io.Reader) error {
+		var err error
+		groups, projects, err = db.ImportCacheSnapshot(r, gitlabURL)
+		return err
+	})
+	return groups, projects, err
+}
+
+// writeDataFile creates a file and writes it, gzip-compressed when the path ends in .gz
+func writeDataFile(path string, write func(w io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var w io.Writer = file
+	var zw *gzip.Writer
+	if strings.HasSuffix(path, ".gz") {
+		zw = gzip.NewWriter(file)
+		w = zw
+	}
+	if err := write(w); err != nil {
+		return err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("error compressing %s: %v", path, err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return nil
+}
+
+// readDataFile opens a file and reads it, decompressing it when the path ends in .gz
+func readDataFile(path string, read func(r io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", path, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	return read(r)
+}
+
+// runBackupCommand saves the users, their settings and selected projects and the incidents to a
+// backup file, which runRestoreCommand loads on another host or database. Files ending in .gz are compressed.
+func runBackupCommand(args []string) {
+	if len(args) != 1 {
+		log.Fatal("Usage: gitlab-status backup <file>")
+	}
+	if err := db.Initialize(databaseOptions()); err != nil {
+		log.Fatal("Failed to initialize database: ", err)
+	}
+
+	path := args[0]
+	var counts db.BackupCounts
+	err := writeDataFile(path, func(w io.Writer) error {
+		var err error
+		counts, err = db.WriteBackup(context.Background(), w)
+		return err
+	})
+	if err != nil {
+		log.Fatal("Failed to write the backup: ", err)
+	}
+	log.Printf("Backed up %s to %s", counts, path)
+}
+
+// runRestoreCommand loads a backup file into the database. A database with users is only
+// overwritten with -replace.
+func runRestoreCommand(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	replace := flags.Bool("replace", false, "delete the users, selected projects, sessions and incidents in the database first")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatal("Usage: gitlab-status restore [-replace] <file>")
+	}
+	configureEncryption()
+	if err := db.Initialize(databaseOptions()); err != nil {
+		log.Fatal("Failed to initialize database: ", err)
+	}
+
+	path := flags.Arg(0)
+	var counts db.BackupCounts
+	err := readDataFile(path, func(r io.Reader) error {
+		var err error
+		counts, err = db.RestoreBackup(context.Background(), r, *replace)
+		return err
+	})
+	if err != nil {
+		log.Fatal("Failed to restore the backup: ", err)
+	}
+	log.Printf("Restored %s from %s", counts, path)
+
+	// Tokens backed up in plaintext are encrypted when this host has a key
+	result, err := db.EncryptSecrets(context.Background())
+	if err != nil {
+		log.Fatal("Failed to encrypt the restored secrets: ", err)
+	}
+	if result.Unreadable > 0 {
+		log.Printf("Warning: %d restored GitLab tokens are encrypted with a key this host doesn't have; add the ENCRYPTION_KEY of the backed up host to ENCRYPTION_KEY_PREVIOUS", result.Unreadable)
+	}
+}
+
+// bootstrapCache fills an empty structure cache from a snapshot file, so the project tree is
+// usable before the first sync finishes. A cache that has data is left to the sync.
+func bootstrapCache(path, gitlabURL string) {
+	projectCount, groupCount, err := db.CountCachedItems()
+	if err != nil {
+		log.Printf("Error checking the cache, not bootstrapping it: %v", err)
+		return
+	}
+	if projectCount > 0 || groupCount > 0 {
+		return
+	}
+	groups, projects, err := importCacheSnapshot(path, gitlabURL)
+	if err != nil {
+		log.Printf("Error bootstrapping the cache from %s: %v", path, err)
+		return
+	}
+	log.Printf("Bootstrapped the cache with %d groups and %d projects from %s", groups, projects, path)
+}
+
 func main() {
 	// Load environment variables from .env file.
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, proceeding with system environment variables")
 	}
 
+	// "gitlab-status migrate [up|status|rollback]" manages the schema without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(os.Args[2:])
+		return
+	}
+	// "gitlab-status cache export|import <file>" saves or restores the GitLab structure cache
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		runCacheCommand(os.Args[2:])
+		return
+	}
+	// "gitlab-status backup <file>" and "restore [-replace] <file>" move users and their settings between hosts
+	if len(os.Args) > 1 && os.Args[1] == "backup" {
+		runBackupCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		runRestoreCommand(os.Args[2:])
+		return
+	}
+	// "gitlab-status secrets rotate" encrypts the stored secrets with a new ENCRYPTION_KEY
+	if len(os.Args) > 1 && os.Args[1] == "secrets" {
+		runSecretsCommand(os.Args[2:])
+		return
+	}
+
 	// Get configuration from environment variables.
 	gitlabURL := os.Getenv("GITLAB_URL")
 	if gitlabURL == "" {
@@ -37,6 +398,10 @@ func main() {
 	}
 	log.Printf("Using GitLab URL: %s", gitlabURL)
 	token := os.Getenv("GITLAB_TOKEN")
+	if token == "" && os.Getenv("GITLAB_REPLAY_DIR") != "" {
+		// Replayed responses need no token, and recorded fixtures never contain one
+		token = "replay"
+	}
 	if token == "" {
 		log.Fatal("GITLAB_TOKEN not set")
 	}
@@ -51,19 +416,100 @@ func main() {
 		}
 	}
 
-	// Initialize GitLab client
-	gitlab.Initialize(timeout)
+	// Initialize GitLab client, optionally through a proxy and with custom TLS settings
+	transportOptions := gitlab.TransportOptions{
+		ProxyURL:           os.Getenv("GITLAB_PROXY_URL"),
+		CACertFile:         os.Getenv("GITLAB_CA_CERT_FILE"),
+		ClientCertFile:     os.Getenv("GITLAB_CLIENT_CERT_FILE"),
+		ClientKeyFile:      os.Getenv("GITLAB_CLIENT_KEY_FILE"),
+		InsecureSkipVerify: os.Getenv("GITLAB_TLS_SKIP_VERIFY") == "true",
+		MinTLSVersion:      os.Getenv("GITLAB_TLS_MIN_VERSION"),
+		RecordDir:          os.Getenv("GITLAB_RECORD_DIR"),
+		ReplayDir:          os.Getenv("GITLAB_REPLAY_DIR"),
+	}
+	if err := gitlab.Initialize(timeout, transportOptions); err != nil {
+		log.Fatal("Failed to initialize GitLab client: ", err)
+	}
 
-	// Set up SQLite database
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "gitlab-status.db" // Default SQLite database file
+	// Get retry policy for transient GitLab API failures from environment
+	maxAttempts := gitlab.DefaultMaxAttempts
+	if attemptsStr := os.Getenv("GITLAB_API_MAX_ATTEMPTS"); attemptsStr != "" {
+		if attempts, err := strconv.Atoi(attemptsStr); err == nil && attempts > 0 {
+			maxAttempts = attempts
+		}
 	}
+	retryBackoff := gitlab.DefaultRetryBackoff
+	if backoffStr := os.Getenv("GITLAB_API_RETRY_BACKOFF_MS"); backoffStr != "" {
+		if backoffMs, err := strconv.Atoi(backoffStr); err == nil && backoffMs > 0 {
+			retryBackoff = time.Duration(backoffMs) * time.Millisecond
+		}
+	}
+	gitlab.ConfigureRetries(maxAttempts, retryBackoff)
+
+	// Identify this deployment in the User-Agent of GitLab API calls
+	appInfo := handlers.AppInfo{Version: appVersion(), Instance: os.Getenv("INSTANCE_ID")}
+	if appInfo.Instance == "" {
+		appInfo.Instance, _ = os.Hostname()
+	}
+	gitlab.ConfigureUserAgent(appInfo.Version, appInfo.Instance)
+	templates.AppVersion = appInfo.Version
+
+	// Get circuit breaker settings from environment
+	breakerThreshold := gitlab.DefaultBreakerThreshold
+	if thresholdStr := os.Getenv("GITLAB_CIRCUIT_BREAKER_THRESHOLD"); thresholdStr != "" {
+		if threshold, err := strconv.Atoi(thresholdStr); err == nil && threshold > 0 {
+			breakerThreshold = threshold
+		}
+	}
+	breakerCooldown := gitlab.DefaultBreakerCooldown
+	if cooldownStr := os.Getenv("GITLAB_CIRCUIT_BREAKER_COOLDOWN"); cooldownStr != "" {
+		if cooldownSec, err := strconv.Atoi(cooldownStr); err == nil && cooldownSec > 0 {
+			breakerCooldown = time.Duration(cooldownSec) * time.Second
+		}
+	}
+	gitlab.ConfigureCircuitBreaker(breakerThreshold, breakerCooldown)
+
+	// Get maximum GitLab API response size from environment
+	if maxResponseStr := os.Getenv("GITLAB_API_MAX_RESPONSE_MB"); maxResponseStr != "" {
+		if maxResponseMB, err := strconv.Atoi(maxResponseStr); err == nil && maxResponseMB > 0 {
+			gitlab.ConfigureMaxResponseSize(int64(maxResponseMB) << 20)
+		}
+	}
+
+	// Get hourly API call budgets per feature from environment, e.g. "sync=2000,status=10000"
+	if budgetSpec := os.Getenv("GITLAB_API_BUDGETS"); budgetSpec != "" {
+		if err := gitlab.ConfigureBudgets(budgetSpec); err != nil {
+			log.Printf("Ignoring GITLAB_API_BUDGETS: %v", err)
+		}
+	}
+	// Cap the GitLab API calls one page load or API request may make
+	maxCallsPerRequest := 0
+	if maxCallsStr := os.Getenv("GITLAB_MAX_CALLS_PER_REQUEST"); maxCallsStr != "" {
+		if maxCalls, err := strconv.Atoi(maxCallsStr); err == nil && maxCalls >= 0 {
+			maxCallsPerRequest = maxCalls
+			log.Printf("Limiting GitLab API calls to %d per request", maxCalls)
+		} else {
+			log.Printf("Ignoring invalid GITLAB_MAX_CALLS_PER_REQUEST: %s", maxCallsStr)
+		}
+	}
+
+	// Get how many days before the token expires to warn about it
+	if daysStr := os.Getenv("GITLAB_TOKEN_EXPIRY_WARNING_DAYS"); daysStr != "" {
+		if days, err := strconv.Atoi(daysStr); err == nil && days >= 0 {
+			gitlab.ConfigureTokenExpiryWarning(time.Duration(days) * 24 * time.Hour)
+		}
+	}
+
+	gitlabClient := gitlab.NewHTTPClient(gitlabURL, token)
+
+	dbOptions := databaseOptions()
 
 	// Initialize database
-	if err := db.Initialize(dbPath); err != nil {
+	configureEncryption()
+	if err := db.Initialize(dbOptions); err != nil {
 		log.Fatal("Failed to initialize database: ", err)
 	}
+	encryptStoredSecrets()
 
 	// Set up initial user
 	defaultUser := os.Getenv("DEFAULT_USERNAME")
@@ -79,118 +525,596 @@ func main() {
 		log.Fatal("Failed to create default user: ", err)
 	}
 
+	// Get users allowed to open the admin page, the default user unless configured
+	adminUsers := os.Getenv("ADMIN_USERNAMES")
+	if adminUsers == "" {
+		adminUsers = defaultUser
+	}
+	handlers.SetAdminUsernames(adminUsers)
+
+	// Get per-user project selection limit
+	if maxSelectedStr := os.Getenv("MAX_SELECTED_PROJECTS"); maxSelectedStr != "" {
+		if maxSelected, err := strconv.Atoi(maxSelectedStr); err == nil && maxSelected >= 0 {
+			db.SetMaxSelectedProjects(maxSelected)
+		}
+	}
+
+	// Get status page fetch concurrency
+	if concurrencyStr := os.Getenv("STATUS_FETCH_CONCURRENCY"); concurrencyStr != "" {
+		if concurrency, err := strconv.Atoi(concurrencyStr); err == nil && concurrency > 0 {
+			handlers.SetStatusFetchConcurrency(concurrency)
+		}
+	}
+
+	// Get the labels of merge requests that block releases; set but empty makes every merge request a blocker
+	if labels, ok := os.LookupEnv("RELEASE_BLOCKER_LABELS"); ok {
+		handlers.SetReleaseBlockerLabels(labels)
+	}
+
+	// Leave merge request pipelines out of the pipeline statuses
+	gitlab.SetExcludeMergeRequestPipelines(os.Getenv("STATUS_EXCLUDE_MR_PIPELINES") == "true")
+
+	// Get the optional status details, each costing extra GitLab API calls per project
+	if err := handlers.SetStatusDetails(os.Getenv("STATUS_DETAILS")); err != nil {
+		log.Printf("Ignoring STATUS_DETAILS: %v", err)
+	}
+
+	// Link failing projects to the current iteration and epics of their group
+	handlers.SetPlanningContext(os.Getenv("GITLAB_PLANNING_CONTEXT") == "true")
+
+	// Key the pseudonyms of anonymized mode, so they stay the same across restarts and replicas
+	handlers.SetAnonymizeSecret(os.Getenv("ANONYMIZE_SECRET"))
+
+	// Restrict visible projects to each user's GitLab memberships
+	handlers.SetMembershipEnforcement(os.Getenv("ENFORCE_GITLAB_MEMBERSHIP") == "true", gitlabURL)
+
+	// Get project sync filters, to cache only a slice of the projects on large instances
+	syncFilters := gitlab.SyncFilters{
+		Scope:           os.Getenv("GITLAB_SYNC_SCOPE"),
+		Visibility:      os.Getenv("GITLAB_SYNC_VISIBILITY"),
+		ExcludeArchived: os.Getenv("GITLAB_SYNC_EXCLUDE_ARCHIVED") == "true",
+	}
+	for _, topic := range strings.Split(os.Getenv("GITLAB_SYNC_TOPICS"), ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			syncFilters.Topics = append(syncFilters.Topics, topic)
+		}
+	}
+	if err := gitlab.ConfigureSyncFilters(syncFilters); err != nil {
+		log.Fatal("Invalid GitLab sync filters: ", err)
+	}
+
+	// Get sync mode: full (default) or incremental
+	incrementalSync := os.Getenv("GITLAB_SYNC_MODE") == "incremental"
+	fullSyncInterval := 24 * time.Hour
+	if hoursStr := os.Getenv("GITLAB_FULL_SYNC_INTERVAL_HOURS"); hoursStr != "" {
+		if hours, err := strconv.Atoi(hoursStr); err == nil && hours > 0 {
+			fullSyncInterval = time.Duration(hours) * time.Hour
+		}
+	}
+	if incrementalSync {
+		log.Printf("Using incremental GitLab sync with a full sync every %v", fullSyncInterval)
+	}
+
+	// Start with the structure of a snapshot file while the cache is empty, e.g. in preview environments
+	if snapshotFile := os.Getenv("CACHE_BOOTSTRAP_FILE"); snapshotFile != "" {
+		bootstrapCache(snapshotFile, gitlabURL)
+	}
+
+	// Canceled on shutdown to stop in-flight GitLab API calls
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Start background job to update cache every 30 minutes
-	startBackgroundCacheJob(gitlabURL, token)
+	startBackgroundCacheJob(gitlab.WithFeature(ctx, gitlab.FeatureSync), gitlabClient, incrementalSync, fullSyncInterval)
 
-	// Get session secret
-	sessionSecret := os.Getenv("SESSION_SECRET")
-	if sessionSecret == "" {
-		sessionSecret = "mysessionsecret" // Should be changed in production
+	// Get status snapshot schedule for point-in-time queries; an interval of 0 disables snapshots
+	snapshotInterval := 15 * time.Minute
+	if minutesStr := os.Getenv("STATUS_SNAPSHOT_INTERVAL_MINUTES"); minutesStr != "" {
+		if minutes, err := strconv.Atoi(minutesStr); err == nil && minutes >= 0 {
+			snapshotInterval = time.Duration(minutes) * time.Minute
+		}
+	}
+	snapshotRetention := 30 * 24 * time.Hour
+	if daysStr := os.Getenv("STATUS_SNAPSHOT_RETENTION_DAYS"); daysStr != "" {
+		if days, err := strconv.Atoi(daysStr); err == nil && days > 0 {
+			snapshotRetention = time.Duration(days) * 24 * time.Hour
+		}
+	}
+	// Get automatic incident settings; correlated failures are detected when snapshots are recorded
+	if thresholdStr := os.Getenv("AUTO_INCIDENT_THRESHOLD"); thresholdStr != "" {
+		if threshold, err := strconv.Atoi(thresholdStr); err == nil && threshold > 0 {
+			window := 30 * time.Minute
+			if minutesStr := os.Getenv("AUTO_INCIDENT_WINDOW_MINUTES"); minutesStr != "" {
+				if minutes, err := strconv.Atoi(minutesStr); err == nil && minutes > 0 {
+					window = time.Duration(minutes) * time.Minute
+				}
+			}
+			handlers.SetAutoIncidents(threshold, window)
+		}
+	}
+	// Export the pipeline status of every tracked project on /metrics to logged-in users and
+	// scrapes sending METRICS_TOKEN
+	handlers.ConfigurePipelineMetrics(os.Getenv("METRICS_PIPELINE_STATUS") == "true", snapshotInterval, os.Getenv("METRICS_TOKEN"))
+	if snapshotInterval > 0 {
+		startStatusSnapshotJob(ctx, gitlabClient, snapshotInterval, snapshotRetention)
+	}
+
+	// Get how long pipeline history and the audit log are kept; 0 keeps them forever
+	retention := db.RetentionPolicy{History: 730 * 24 * time.Hour, Audit: 90 * 24 * time.Hour}
+	if daysStr := os.Getenv("HISTORY_RETENTION_DAYS"); daysStr != "" {
+		if days, err := strconv.Atoi(daysStr); err == nil && days >= 0 {
+			retention.History = time.Duration(days) * 24 * time.Hour
+		}
+	}
+	if daysStr := os.Getenv("AUDIT_RETENTION_DAYS"); daysStr != "" {
+		if days, err := strconv.Atoi(daysStr); err == nil && days >= 0 {
+			retention.Audit = time.Duration(days) * 24 * time.Hour
+		}
+	}
+	startRetentionJob(ctx, retention)
+
+	// Share sessions and the last known statuses between instances through Redis if configured
+	var redisClient *redis.Client
+	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+		client, err := redisstore.Connect(ctx, redisURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer client.Close()
+		redisClient = client
+		handlers.SetStatusCache(redisstore.NewStatusCache(redisClient))
+		log.Println("Sharing the last known pipeline statuses through Redis")
 	}
 
-	// Initialize the session store
-	store := sessions.NewCookieStore([]byte(sessionSecret))
-	store.Options = &sessions.Options{
+	// Initialize the session store: signed cookies, or Redis when REDIS_URL is set, unless
+	// SESSION_STORE chooses otherwise
+	sessionOptions := &sessions.Options{
 		Path:     "/",
 		MaxAge:   86400 * 7, // 7 days
 		HttpOnly: true,
+		// Not sent with requests from other sites, except when following links to the dashboard
+		SameSite: http.SameSiteLaxMode,
+	}
+	sessionStore := os.Getenv("SESSION_STORE")
+	if sessionStore == "" && redisClient != nil {
+		sessionStore = "redis"
+	}
+	var store sessions.Store
+	switch sessionStore {
+	case "db":
+		store = db.NewSessionStore(sessionOptions)
+		log.Println("Storing sessions in the database")
+	case "redis":
+		if redisClient == nil {
+			log.Fatal("SESSION_STORE=redis needs REDIS_URL")
+		}
+		store = redisstore.NewSessionStore(redisClient, sessionOptions)
+		log.Println("Storing sessions in Redis")
+	case "", "cookie":
+		// Get session secret
+		sessionSecret := os.Getenv("SESSION_SECRET")
+		if sessionSecret == "" {
+			sessionSecret = "mysessionsecret" // Should be changed in production
+		}
+		cookieStore := sessions.NewCookieStore([]byte(sessionSecret))
+		cookieStore.Options = sessionOptions
+		store = cookieStore
+	default:
+		log.Fatalf("Unknown SESSION_STORE %q, use cookie, db or redis", sessionStore)
 	}
 
+	// Check the database regularly, serving pages from memory while it's unavailable
+	startDatabaseHealthCheck(ctx, databaseHealthInterval)
+
 	// Initialize Echo.
 	e := echo.New()
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 
 	// Set up middleware
+	e.Use(handlers.DatabaseFallbackMiddleware(store))
 	e.Use(handlers.AuthMiddleware(store))
+	if maxCallsPerRequest > 0 {
+		e.Use(handlers.GitLabCallBudgetMiddleware(maxCallsPerRequest))
+	}
+
+	// Every form posting to the app needs a CSRF token from the page it's on. The JSON API and the
+	// signed registration endpoint don't take forms, and browsers don't send cross-site JSON without CORS.
+	csrf := handlers.CSRFMiddleware()
 
 	// Set up routes
 	// Authentication routes
 	e.GET("/login", func(c echo.Context) error {
 		return handlers.LoginPageHandler(c)
-	})
+	}, csrf)
 	e.POST("/login", func(c echo.Context) error {
-		return handlers.LoginSubmitHandler(c, store)
-	})
+		return handlers.LoginSubmitHandler(c, store, gitlabClient)
+	}, csrf)
 	e.GET("/logout", func(c echo.Context) error {
 		return handlers.LogoutHandler(c, store)
 	})
 
 	// Status page route
 	e.GET("/", func(c echo.Context) error {
-		return handlers.StatusPageHandler(c, store, gitlabURL, token)
+		return handlers.StatusPageHandler(c, store, gitlabClient)
+	}, csrf)
+	e.GET("/status/:projectID/run", func(c echo.Context) error {
+		return handlers.RunPipelinePageHandler(c, store)
+	}, csrf)
+	e.POST("/status/:projectID/run", func(c echo.Context) error {
+		return handlers.RunPipelineHandler(c, store, gitlabClient)
+	}, csrf)
+	e.POST("/status/:projectID/jobs/:jobID/retry", func(c echo.Context) error {
+		return handlers.RetryJobHandler(c, store, gitlabClient)
+	}, csrf)
+	e.GET("/status/:projectID/pipelines/:pipelineID/failure-log", func(c echo.Context) error {
+		return handlers.FailureLogHandler(c, store, gitlabClient)
+	})
+	e.GET("/avatars/:kind/:id", func(c echo.Context) error {
+		return handlers.AvatarHandler(c, store, gitlabClient)
+	})
+	e.GET("/releases", func(c echo.Context) error {
+		return handlers.ReleaseReadinessHandler(c, store, gitlabClient)
+	})
+	e.GET("/changelog", func(c echo.Context) error {
+		return handlers.ChangelogHandler(c, store, gitlabClient)
+	})
+	e.GET("/schedules", func(c echo.Context) error {
+		return handlers.SchedulesHandler(c, store, gitlabClient)
+	}, csrf)
+	e.POST("/schedules", func(c echo.Context) error {
+		return handlers.CreateScheduleHandler(c, store, gitlabClient)
+	}, csrf)
+	e.POST("/schedules/:projectID/:scheduleID/toggle", func(c echo.Context) error {
+		return handlers.ToggleScheduleHandler(c, store, gitlabClient)
+	}, csrf)
+	e.GET("/durations", func(c echo.Context) error {
+		return handlers.DurationsHandler(c, store)
+	})
+
+	// Prometheus metrics of the background jobs
+	e.GET("/metrics", func(c echo.Context) error {
+		return handlers.MetricsHandler(c, store)
+	})
+	e.GET("/healthz", handlers.HealthHandler)
+	e.GET("/version", handlers.VersionHandler(appInfo))
+
+	// API routes
+	e.GET("/api/v1/statuses", func(c echo.Context) error {
+		return handlers.StatusesAPIHandler(c, store, gitlabClient)
+	})
+	e.GET("/api/v1/gitlab/usage", func(c echo.Context) error {
+		return handlers.GitLabUsageAPIHandler(c)
+	})
+	e.GET("/api/v1/selections", func(c echo.Context) error {
+		return handlers.SelectionsAPIHandler(c, store)
+	})
+	e.PUT("/api/v1/selections", func(c echo.Context) error {
+		return handlers.ReplaceSelectionsAPIHandler(c, store)
+	})
+	e.PATCH("/api/v1/selections", func(c echo.Context) error {
+		return handlers.PatchSelectionsAPIHandler(c, store)
+	})
+
+	// Project self-registration from CI jobs (authenticated by signature instead of session)
+	registrationSecret := os.Getenv("REGISTRATION_SECRET")
+	registrationUser := os.Getenv("REGISTRATION_USERNAME")
+	e.POST("/api/v1/register", func(c echo.Context) error {
+		return handlers.RegisterProjectHandler(c, registrationSecret, registrationUser, gitlabClient)
 	})
 
 	// Settings routes
 	e.GET("/settings", func(c echo.Context) error {
 		return handlers.SettingsPageHandler(c, store, gitlabURL)
-	})
+	}, csrf)
 	e.GET("/render-path-tree", func(c echo.Context) error {
 		return handlers.RenderPathTreeHandler(c, store, gitlabURL)
 	})
 	e.GET("/settings/projects", func(c echo.Context) error {
 		return handlers.ProjectsPageHandler(c, store, gitlabURL)
+	}, csrf)
+	e.GET("/settings/download", func(c echo.Context) error {
+		return handlers.DownloadStructureHandler(c, store, gitlabURL)
 	})
-	e.GET("/settings/cache", func(c echo.Context) error {
-		return handlers.CacheHandler(c, store, gitlabURL, token)
+	e.GET("/settings/download-path-structure", func(c echo.Context) error {
+		return handlers.DownloadPathStructureHandler(c, store, gitlabURL)
 	})
+	e.GET("/settings/download/bundle", func(c echo.Context) error {
+		return handlers.DownloadBundleHandler(c, store, gitlabClient)
+	})
+	e.GET("/settings/cache", func(c echo.Context) error {
+		return handlers.CacheHandler(c, store, gitlabClient)
+	}, csrf)
 	e.POST("/settings", func(c echo.Context) error {
 		return handlers.SaveSettingsHandler(c, store)
+	}, csrf)
+	e.GET("/settings/token-status", func(c echo.Context) error {
+		return handlers.TokenStatusHandler(c, gitlabClient)
+	})
+	e.GET("/settings/gitlab-access", func(c echo.Context) error {
+		return handlers.GitLabAccessPageHandler(c, store)
+	}, csrf)
+	e.POST("/settings/gitlab-access", func(c echo.Context) error {
+		return handlers.SaveGitLabAccessHandler(c, store)
+	}, csrf)
+	e.GET("/settings/display", func(c echo.Context) error {
+		return handlers.DisplayPageHandler(c, store)
+	}, csrf)
+	e.POST("/settings/display", func(c echo.Context) error {
+		return handlers.SaveDisplayHandler(c, store)
+	}, csrf)
+	e.GET("/settings/branches", func(c echo.Context) error {
+		return handlers.BranchesPageHandler(c, store)
+	}, csrf)
+	e.POST("/settings/branches", func(c echo.Context) error {
+		return handlers.SaveBranchesHandler(c, store)
+	}, csrf)
+
+	// Stable redirects to a project's pipelines in GitLab
+	e.GET("/go/:projectID/latest", func(c echo.Context) error {
+		return handlers.DeepLinkHandler(c, store, gitlabClient, handlers.DeepLinkLatest)
+	})
+	e.GET("/go/:projectID/last-success", func(c echo.Context) error {
+		return handlers.DeepLinkHandler(c, store, gitlabClient, handlers.DeepLinkLastSuccess)
 	})
 
+	// Admin routes
+	e.GET("/admin", func(c echo.Context) error {
+		return handlers.AdminPageHandler(c, store, gitlabClient)
+	}, csrf)
+	e.GET("/admin/alert-rules", func(c echo.Context) error {
+		return handlers.AlertRulesHandler(c, store)
+	})
+	e.POST("/admin/sync-preview", func(c echo.Context) error {
+		return handlers.SyncPreviewHandler(c, store, gitlabClient)
+	}, csrf)
+	e.POST("/admin/import", func(c echo.Context) error {
+		return handlers.ImportHistoryHandler(c, store, gitlabClient)
+	}, csrf)
+	e.POST("/admin/incidents", func(c echo.Context) error {
+		return handlers.DeclareIncidentHandler(c, store, gitlabClient)
+	}, csrf)
+	e.POST("/admin/incidents/:id/resolve", func(c echo.Context) error {
+		return handlers.ResolveIncidentHandler(c, store, gitlabClient)
+	}, csrf)
+
 	// Start the server
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
-	e.Logger.Fatal(e.Start(":" + port))
+	go func() {
+		if err := e.Start(":" + port); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	// Wait for a shutdown signal, then let running requests finish
+	<-ctx.Done()
+	log.Println("Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
 }
 
-// startBackgroundCacheJob starts a background job to update the GitLab structure cache periodically
-func startBackgroundCacheJob(gitlabURL, token string) {
-	go func() {
+// startBackgroundCacheJob starts a background job to update the GitLab structure cache periodically.
+// In incremental mode only projects changed since the last sync are fetched, with a full
+// sync at least every fullSyncInterval to pick up deleted projects.
+func startBackgroundCacheJob(ctx context.Context, client gitlab.Client, incremental bool, fullSyncInterval time.Duration) {
+	superviseBackgroundJob(ctx, handlers.JobSyncLoop, func(ctx context.Context) {
+		// Detect the GitLab version first so the sync can use the features it supports
+		detectGitLabInstance(ctx, client)
+		validateGitLabToken(ctx, client)
+
 		// Do initial cache update
 		log.Println("Starting initial GitLab structure cache update...")
-		groups, err := gitlab.FetchGroups(gitlabURL, token)
-		if err != nil {
-			log.Printf("Error fetching groups: %v", err)
-		} else {
-			projects, err := gitlab.FetchProjects(gitlabURL, token)
-			if err != nil {
-				log.Printf("Error fetching projects: %v", err)
-			} else {
-				err = db.CacheGitLabStructure(groups, projects)
-				if err != nil {
-					log.Printf("Error caching GitLab structure: %v", err)
-				} else {
-					log.Printf("Successfully cached GitLab structure: %d groups, %d projects", len(groups), len(projects))
-				}
+		syncGitLabStructure(ctx, client, incremental, fullSyncInterval)
+
+		// Set up ticker for periodic updates (every 30 minutes) until shutdown
+		ticker := time.NewTicker(30 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// Revalidate so expiry warnings and rotated tokens are noticed
+				validateGitLabToken(ctx, client)
+				log.Println("Running periodic GitLab structure cache update...")
+				syncGitLabStructure(ctx, client, incremental, fullSyncInterval)
 			}
 		}
+	})
+}
 
-		// Set up ticker for periodic updates (every 30 minutes)
-		ticker := time.NewTicker(30 * time.Minute)
-		for range ticker.C {
-			log.Println("Running periodic GitLab structure cache update...")
-			groups, err := gitlab.FetchGroups(gitlabURL, token)
-			if err != nil {
-				log.Printf("Error fetching groups: %v", err)
-				continue
+// startStatusSnapshotJob periodically records the pipeline status of all selected projects
+func startStatusSnapshotJob(ctx context.Context, client gitlab.Client, interval, retention time.Duration) {
+	log.Printf("Recording status snapshots every %v, kept for %v", interval, retention)
+	superviseBackgroundJob(ctx, handlers.JobSnapshotLoop, func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				startedAt := time.Now()
+				recorded, err := handlers.TakeStatusSnapshot(ctx, client, retention)
+				handlers.RecordJobRun(handlers.JobStatusSnapshot, startedAt, recorded, err)
 			}
+		}
+	})
+}
 
-			projects, err := gitlab.FetchProjects(gitlabURL, token)
-			if err != nil {
-				log.Printf("Error fetching projects: %v", err)
-				continue
+// startRetentionJob deletes the pipeline history and audit entries older than the policy allows,
+// at startup and then daily
+func startRetentionJob(ctx context.Context, policy db.RetentionPolicy) {
+	log.Printf("Keeping pipeline history for %v and the audit log for %v (0 keeps them forever)", policy.History, policy.Audit)
+	superviseBackgroundJob(ctx, handlers.JobRetentionLoop, func(ctx context.Context) {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+		for {
+			startedAt := time.Now()
+			result, err := db.PruneOldData(ctx, policy)
+			handlers.RecordJobRun(handlers.JobRetentionPrune, startedAt, int(result.TotalRows()), err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
 			}
+		}
+	})
+}
 
-			err = db.CacheGitLabStructure(groups, projects)
-			if err != nil {
-				log.Printf("Error caching GitLab structure: %v", err)
-				continue
+// databaseHealthInterval is how often the database is checked, and so how long pages may fail
+// before they are served from memory
+const databaseHealthInterval = 15 * time.Second
+
+// startDatabaseHealthCheck periodically checks that the database answers queries
+func startDatabaseHealthCheck(ctx context.Context, interval time.Duration) {
+	superviseBackgroundJob(ctx, handlers.JobHealthLoop, func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				checkCtx, cancel := context.WithTimeout(ctx, interval)
+				handlers.RecordDatabaseHealth(db.Ping(checkCtx))
+				cancel()
 			}
+		}
+	})
+}
+
+const (
+	// jobRestartDelay is how long a background job that panicked waits before it is restarted,
+	// doubled after every panic up to jobRestartMaxDelay
+	jobRestartDelay    = 10 * time.Second
+	jobRestartMaxDelay = 10 * time.Minute
+)
 
-			log.Printf("Successfully updated GitLab structure cache: %d groups, %d projects", len(groups), len(projects))
+// superviseBackgroundJob runs a background job loop in a goroutine and restarts it with backoff when
+// it panics, recording the panic as a failed run so it shows on the admin page and in the metrics.
+// The loop is expected to return only when ctx is done.
+func superviseBackgroundJob(ctx context.Context, name string, loop func(ctx context.Context)) {
+	go func() {
+		delay := jobRestartDelay
+		for {
+			startedAt := time.Now()
+			err := handlers.RunRecovered(func() { loop(ctx) })
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				log.Printf("Background job %s stopped", name)
+				return
+			}
+			handlers.RecordJobRun(name, startedAt, 0, err)
+			if time.Since(startedAt) > jobRestartMaxDelay {
+				// It ran fine for a while, so this isn't a crash loop
+				delay = jobRestartDelay
+			}
+			log.Printf("Restarting background job %s in %v", name, delay)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, jobRestartMaxDelay)
 		}
 	}()
 }
+
+// detectGitLabInstance fetches the GitLab version and capabilities; optional features stay
+// disabled when detection fails
+func detectGitLabInstance(ctx context.Context, client gitlab.Client) {
+	info, err := client.FetchInstanceInfo(gitlab.WithFeature(ctx, gitlab.FeatureOther))
+	if err != nil {
+		log.Printf("Error detecting GitLab version, optional features are disabled: %v", err)
+		return
+	}
+	gitlab.SetInstanceInfo(info)
+}
+
+// validateGitLabToken checks the configured token and logs actionable warnings when it can't be used
+func validateGitLabToken(ctx context.Context, client gitlab.Client) {
+	validation, err := client.ValidateToken(gitlab.WithFeature(ctx, gitlab.FeatureOther))
+	if err != nil {
+		log.Printf("Error validating GitLab token: %v", err)
+		return
+	}
+	gitlab.SetTokenValidation(validation)
+}
+
+// syncGitLabStructure runs an incremental sync when possible and falls back to a full sync
+func syncGitLabStructure(ctx context.Context, client gitlab.Client, incremental bool, fullSyncInterval time.Duration) {
+	if incremental {
+		state, err := db.GetSyncState()
+		if err != nil {
+			log.Printf("Error reading sync state, running full sync: %v", err)
+		} else if state.LastSync.IsZero() || state.LastFullSync.IsZero() {
+			log.Println("No previous sync recorded, running full sync")
+		} else if time.Since(state.LastFullSync) >= fullSyncInterval {
+			log.Printf("Last full sync was %s ago, running full sync", time.Since(state.LastFullSync).Round(time.Minute))
+		} else {
+			startedAt := time.Now()
+			items, err := runIncrementalSync(ctx, client, state.LastSync)
+			handlers.RecordJobRun(handlers.JobIncrementalSync, startedAt, items, err)
+			return
+		}
+	}
+	startedAt := time.Now()
+	items, err := runFullSync(ctx, client)
+	handlers.RecordJobRun(handlers.JobFullSync, startedAt, items, err)
+}
+
+// runFullSync fetches all groups and projects and replaces the cache, returning how many were cached
+func runFullSync(ctx context.Context, client gitlab.Client) (int, error) {
+	startedAt := time.Now()
+
+	groups, err := client.FetchGroups(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching groups: %v", err)
+	}
+
+	projects, err := client.FetchProjects(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching projects: %v", err)
+	}
+
+	if err := db.CacheGitLabStructure(groups, projects, startedAt); err != nil {
+		return 0, fmt.Errorf("error caching GitLab structure: %v", err)
+	}
+
+	log.Printf("Successfully cached GitLab structure: %d groups, %d projects", len(groups), len(projects))
+	log.Printf("GitLab API quota: %s", gitlab.GetRateLimitStatus())
+	return len(groups) + len(projects), nil
+}
+
+// runIncrementalSync fetches all groups and the projects changed since the last sync and updates the cache,
+// returning how many groups and projects were applied
+func runIncrementalSync(ctx context.Context, client gitlab.Client, since time.Time) (int, error) {
+	startedAt := time.Now()
+
+	groups, err := client.FetchGroups(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching groups: %v", err)
+	}
+
+	projects, err := client.FetchProjectsChangedSince(ctx, since)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching changed projects: %v", err)
+	}
+
+	if err := db.ApplyIncrementalSync(groups, projects, startedAt); err != nil {
+		return 0, fmt.Errorf("error applying incremental sync: %v", err)
+	}
+
+	log.Printf("Successfully applied incremental sync: %d groups, %d changed projects", len(groups), len(projects))
+	log.Printf("GitLab API quota: %s", gitlab.GetRateLimitStatus())
+	return len(groups) + len(projects), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab-status/db"
+	"gitlab-status/gitlab"
+)
+
+// replayGitLabURL is the instance the fixtures in testdata/gitlab were recorded from
+const replayGitLabURL = "https://gitlab.example.com"
+
+func TestRunFullSyncReplaysFixtures(t *testing.T) {
+	if err := db.Initialize(db.Options{DSN: filepath.Join(t.TempDir(), "gitlab-status.db")}); err != nil {
+		t.Fatalf("initializing database: %v", err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+	if err := gitlab.Initialize(10*time.Second, gitlab.TransportOptions{ReplayDir: "testdata/gitlab"}); err != nil {
+		t.Fatalf("initializing GitLab client: %v", err)
+	}
+	client := gitlab.NewHTTPClient(replayGitLabURL, "replay")
+
+	items, err := runFullSync(context.Background(), client)
+	if err != nil {
+		t.Fatalf("runFullSync: %v", err)
+	}
+	if items != 3 {
+		t.Errorf("runFullSync cached %d items, want 1 group and 2 projects", items)
+	}
+
+	groups, err := db.GetCachedGroups()
+	if err != nil {
+		t.Fatalf("loading cached groups: %v", err)
+	}
+	if len(groups) != 1 || groups[0].FullPath != "platform" {
+		t.Errorf("cached groups = %+v, want platform", groups)
+	}
+	projects, err := db.GetCachedProjects()
+	if err != nil {
+		t.Fatalf("loading cached projects: %v", err)
+	}
+	paths := make(map[string]bool)
+	for _, project := range projects {
+		paths[project.PathWithNamespace] = true
+		if project.GroupID != 10 {
+			t.Errorf("project %s has group %d, want 10", project.PathWithNamespace, project.GroupID)
+		}
+	}
+	if len(projects) != 2 || !paths["platform/api"] || !paths["platform/web"] {
+		t.Errorf("cached projects = %v, want platform/api and platform/web", paths)
+	}
+
+	state, err := db.GetSyncState()
+	if err != nil || state.LastSync.IsZero() {
+		t.Errorf("sync state = %+v, %v, want the time of the sync", state, err)
+	}
+}
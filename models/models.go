@@ -1,6 +1,9 @@
 package models
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/uptrace/bun"
@@ -12,7 +15,218 @@ type Pipeline struct {
 	Ref       string    `json:"ref"`
 	Status    string    `json:"status"`
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 	WebURL    string    `json:"web_url"`
+	Coverage  string    `json:"coverage" gitlab:"optional"` // Only returned for single pipelines, empty when none was reported
+	Source    string    `json:"source"`                     // What triggered the pipeline, e.g. push, schedule or merge_request_event
+	// Duration and QueuedDuration are the seconds spent running and waiting for runners,
+	// only returned for single pipelines
+	Duration       float64 `json:"duration" gitlab:"optional"`
+	QueuedDuration float64 `json:"queued_duration" gitlab:"optional"`
+	// FinishedAt is only returned for single pipelines, nil while the pipeline runs
+	FinishedAt *time.Time `json:"finished_at" gitlab:"optional"`
+}
+
+// MergeRequest reports whether the pipeline is a detached or merged results pipeline of a merge request
+func (p Pipeline) MergeRequest() bool {
+	return p.Source == "merge_request_event"
+}
+
+// PipelineVariable is a variable passed to a pipeline created on demand.
+type PipelineVariable struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Job represents a simplified GitLab pipeline job.
+type Job struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Stage        string `json:"stage"`
+	Status       string `json:"status"`
+	AllowFailure bool   `json:"allow_failure"`
+	WebURL       string `json:"web_url"`
+	// ArtifactsFile is the artifacts archive of the job, nil when it has none
+	ArtifactsFile     *ArtifactsFile `json:"artifacts_file" gitlab:"optional"`
+	ArtifactsExpireAt *time.Time     `json:"artifacts_expire_at"`
+}
+
+// ArtifactsFile is the artifacts archive a job uploaded
+type ArtifactsFile struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+}
+
+// ArtifactsURL returns the GitLab page that downloads the job's artifacts archive, so the download
+// is checked against the user's own GitLab permissions
+func (j Job) ArtifactsURL() string {
+	return j.WebURL + "/artifacts/download"
+}
+
+// Bridge represents a GitLab trigger job that starts a downstream or child pipeline.
+type Bridge struct {
+	ID                 int                 `json:"id"`
+	Name               string              `json:"name"`
+	Status             string              `json:"status"`
+	AllowFailure       bool                `json:"allow_failure"`
+	DownstreamPipeline *DownstreamPipeline `json:"downstream_pipeline"` // Nil until the downstream pipeline was created
+}
+
+// DownstreamPipeline is the pipeline started by a bridge, possibly in another project.
+type DownstreamPipeline struct {
+	ID        int    `json:"id"`
+	ProjectID int    `json:"project_id"`
+	Status    string `json:"status"`
+	WebURL    string `json:"web_url"`
+}
+
+// Environment represents a simplified GitLab environment.
+type Environment struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	State       string `json:"state"`
+	Tier        string `json:"tier"`
+	ExternalURL string `json:"external_url"`
+}
+
+// Deployment represents a simplified GitLab deployment.
+type Deployment struct {
+	ID          int       `json:"id"`
+	IID         int       `json:"iid"`
+	Ref         string    `json:"ref"`
+	SHA         string    `json:"sha"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Environment struct {
+		Name string `json:"name"`
+	} `json:"environment"`
+	Deployable struct {
+		Pipeline Pipeline `json:"pipeline"`
+	} `json:"deployable"`
+}
+
+// AgentConnectionWindow is how recently an agent for Kubernetes must have contacted GitLab to count as connected
+const AgentConnectionWindow = 8 * time.Minute
+
+// ClusterAgent represents a GitLab agent for Kubernetes registered in a project.
+type ClusterAgent struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// LastContact is when the agent last used one of its tokens, zero if it never connected
+	LastContact time.Time `json:"-"`
+}
+
+// Connected reports whether the agent contacted GitLab within AgentConnectionWindow
+func (a ClusterAgent) Connected() bool {
+	return !a.LastContact.IsZero() && time.Since(a.LastContact) < AgentConnectionWindow
+}
+
+// Runner represents a simplified GitLab runner.
+type Runner struct {
+	ID          int    `json:"id"`
+	Description string `json:"description"`
+	RunnerType  string `json:"runner_type"` // instance_type, group_type or project_type
+	Status      string `json:"status"`      // online, offline, stale or never_contacted
+	Paused      bool   `json:"paused"`
+	IPAddress   string `json:"ip_address"`
+}
+
+// Available reports whether the runner is online and picks up jobs
+func (r Runner) Available() bool {
+	return r.Status == "online" && !r.Paused
+}
+
+// PipelineSchedule represents a simplified GitLab pipeline schedule.
+type PipelineSchedule struct {
+	ID           int       `json:"id"`
+	Description  string    `json:"description"`
+	Ref          string    `json:"ref"`
+	Cron         string    `json:"cron"`
+	CronTimezone string    `json:"cron_timezone"`
+	NextRunAt    time.Time `json:"next_run_at"`
+	Active       bool      `json:"active"`
+	LastPipeline *Pipeline `json:"last_pipeline" gitlab:"optional"` // Only returned for single schedules
+}
+
+// Tag represents a simplified GitLab repository tag.
+type Tag struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+	Commit  struct {
+		ID        string    `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+	} `json:"commit"`
+}
+
+// Release represents a simplified GitLab release.
+type Release struct {
+	Name            string    `json:"name"`
+	TagName         string    `json:"tag_name"`
+	Description     string    `json:"description"`                        // Release notes in Markdown
+	DescriptionHTML string    `json:"description_html" gitlab:"optional"` // Only returned when requested, rendered by GitLab
+	ReleasedAt      time.Time `json:"released_at"`
+	Links           struct {
+		Self string `json:"self"`
+	} `json:"_links"`
+}
+
+// MergeRequest represents a simplified GitLab merge request.
+type MergeRequest struct {
+	IID          int      `json:"iid"`
+	Title        string   `json:"title"`
+	WebURL       string   `json:"web_url"`
+	TargetBranch string   `json:"target_branch"`
+	Labels       []string `json:"labels"`
+	Author       struct {
+		Username string `json:"username"`
+	} `json:"author"`
+}
+
+// Iteration represents a simplified GitLab iteration, a timebox of a group's planning cadence.
+type Iteration struct {
+	ID        int    `json:"id"`
+	IID       int    `json:"iid"`
+	Sequence  int    `json:"sequence"`
+	GroupID   int    `json:"group_id"`
+	Title     string `json:"title"` // Empty for iterations of automatic cadences
+	StartDate string `json:"start_date"`
+	DueDate   string `json:"due_date"`
+	WebURL    string `json:"web_url"`
+}
+
+// Name returns the title of the iteration, or its dates when it has none
+func (i Iteration) Name() string {
+	if i.Title != "" {
+		return i.Title
+	}
+	return i.StartDate + " – " + i.DueDate
+}
+
+// Issue represents a simplified GitLab issue.
+type Issue struct {
+	IID       int        `json:"iid"`
+	Title     string     `json:"title"`
+	WebURL    string     `json:"web_url"`
+	Iteration *Iteration `json:"iteration"` // Nil when the issue is in no iteration
+	Epic      *EpicRef   `json:"epic"`      // Nil when the issue belongs to no epic or epics aren't available
+}
+
+// EpicRef is the epic an issue belongs to, as GitLab embeds it in issues.
+type EpicRef struct {
+	ID      int    `json:"id"`
+	IID     int    `json:"iid"`
+	Title   string `json:"title"`
+	URL     string `json:"url"` // Path on the GitLab instance, e.g. /groups/platform/-/epics/4
+	GroupID int    `json:"group_id"`
+}
+
+// PlanningContext is the in-flight work of a project that a failing pipeline affects
+type PlanningContext struct {
+	Iteration Iteration `json:"iteration"`
+	Issues    []Issue   `json:"issues"`     // Open issues of the project in the iteration
+	Epics     []EpicRef `json:"epics"`      // Epics of those issues, with URLs made absolute
+	IssuesURL string    `json:"issues_url"` // The project's issue list filtered to the iteration
 }
 
 // Group represents a GitLab group.
@@ -23,6 +237,7 @@ type Group struct {
 	FullPath    string    `json:"full_path"`
 	Description string    `json:"description"`
 	WebURL      string    `json:"web_url"`
+	AvatarURL   string    `json:"avatar_url"`
 	ParentID    int       `json:"parent_id"`
 	Subgroups   []Group   `json:"-"`
 	Projects    []Project `json:"-"`
@@ -40,6 +255,8 @@ type Project struct {
 	Path              string `json:"path"`
 	PathWithNamespace string `json:"path_with_namespace"`
 	WebURL            string `json:"web_url"`
+	AvatarURL         string `json:"avatar_url"`
+	DefaultBranch     string `json:"default_branch"`
 	Namespace         struct {
 		ID       int    `json:"id"`
 		Name     string `json:"name"`
@@ -47,20 +264,142 @@ type Project struct {
 		FullPath string `json:"full_path"`
 		Kind     string `json:"kind"`
 	} `json:"namespace"`
+	Archived bool `json:"archived"`
 	Selected bool `json:"-"` // Used for UI selection
 	Level    int  `json:"-"` // For tree indentation
+
+	// OnlyAllowMergeIfPipelineSucceeds is the "Pipelines must succeed" merge check
+	OnlyAllowMergeIfPipelineSucceeds bool `json:"only_allow_merge_if_pipeline_succeeds"`
 }
 
 // User represents an application user.
 type User struct {
 	bun.BaseModel `bun:"table:users,alias:u"`
 
-	ID        int64     `bun:"id,pk,autoincrement"`
-	Username  string    `bun:"username,unique,notnull"`
-	Password  string    `bun:"password,notnull"` // Hashed password
-	GitLabURL string    `bun:"gitlab_url"`       // Optional custom GitLab URL for user
-	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp"`
-	UpdatedAt time.Time `bun:"updated_at,notnull,default:current_timestamp"`
+	ID          int64     `bun:"id,pk,autoincrement"`
+	Username    string    `bun:"username,unique,notnull"`
+	Password    string    `bun:"password,notnull"` // Hashed password
+	GitLabURL   string    `bun:"gitlab_url"`       // Optional custom GitLab URL for user
+	GitLabToken string    `bun:"gitlab_token"`     // Optional personal token used to resolve the user's GitLab memberships
+	CreatedAt   time.Time `bun:"created_at,notnull,default:current_timestamp"`
+	UpdatedAt   time.Time `bun:"updated_at,notnull,default:current_timestamp"`
+
+	StatusPalette string `bun:"status_palette"`                      // Colors of pipeline statuses, PaletteStandard when empty
+	StatusShapes  bool   `bun:"status_shapes,notnull,default:false"` // Show a symbol in addition to the status color
+
+	ExportLocale   string `bun:"export_locale"`   // Locale dates and numbers in exports are written in, ISO when empty
+	ExportTimezone string `bun:"export_timezone"` // IANA time zone of dates in exports, the server's when empty
+}
+
+// Palettes pipeline statuses can be colored with
+const (
+	PaletteStandard   = "standard"
+	PaletteColorBlind = "colorblind" // Okabe-Ito colors, distinguishable with red-green color blindness
+)
+
+// StatusDisplay is how a user wants pipeline statuses rendered
+type StatusDisplay struct {
+	Palette string
+	Shapes  bool
+}
+
+// StatusDisplay returns the user's status rendering options, defaulting to the standard palette
+func (u User) StatusDisplay() StatusDisplay {
+	display := StatusDisplay{Palette: u.StatusPalette, Shapes: u.StatusShapes}
+	if display.Palette != PaletteColorBlind {
+		display.Palette = PaletteStandard
+	}
+	return display
+}
+
+// Locale is how dates and numbers are written for readers of a region
+type Locale struct {
+	Code           string // BCP 47 tag, e.g. de-DE
+	Name           string
+	DateLayout     string
+	DateTimeLayout string
+	Decimal        string // Decimal separator
+	CSVSeparator   rune   // Field separator spreadsheets of the region expect, ';' where the decimal separator is a comma
+}
+
+// Locales lists the locales exports can be written in; the first, ISO 8601, is the default
+var Locales = []Locale{
+	{Code: "iso", Name: "ISO 8601 (2006-01-02 15:04)", DateLayout: "2006-01-02", DateTimeLayout: "2006-01-02 15:04", Decimal: ".", CSVSeparator: ','},
+	{Code: "en-US", Name: "English, United States (01/02/2006 3:04 PM)", DateLayout: "01/02/2006", DateTimeLayout: "01/02/2006 3:04 PM", Decimal: ".", CSVSeparator: ','},
+	{Code: "en-GB", Name: "English, United Kingdom (02/01/2006 15:04)", DateLayout: "02/01/2006", DateTimeLayout: "02/01/2006 15:04", Decimal: ".", CSVSeparator: ','},
+	{Code: "de-DE", Name: "Deutsch, Deutschland (02.01.2006 15:04)", DateLayout: "02.01.2006", DateTimeLayout: "02.01.2006 15:04", Decimal: ",", CSVSeparator: ';'},
+	{Code: "fr-FR", Name: "Français, France (02/01/2006 15:04)", DateLayout: "02/01/2006", DateTimeLayout: "02/01/2006 15:04", Decimal: ",", CSVSeparator: ';'},
+	{Code: "es-ES", Name: "Español, España (02/01/2006 15:04)", DateLayout: "02/01/2006", DateTimeLayout: "02/01/2006 15:04", Decimal: ",", CSVSeparator: ';'},
+	{Code: "nl-NL", Name: "Nederlands, Nederland (02-01-2006 15:04)", DateLayout: "02-01-2006", DateTimeLayout: "02-01-2006 15:04", Decimal: ",", CSVSeparator: ';'},
+}
+
+// LookupLocale finds a locale by its code, ignoring case and accepting de_DE for de-DE. A bare
+// language like de matches the first locale of the language.
+func LookupLocale(code string) (Locale, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), "_", "-")
+	for _, locale := range Locales {
+		if strings.EqualFold(locale.Code, code) {
+			return locale, true
+		}
+	}
+	for _, locale := range Locales {
+		if language, _, ok := strings.Cut(locale.Code, "-"); ok && strings.EqualFold(language, code) {
+			return locale, true
+		}
+	}
+	return Locale{}, false
+}
+
+// ExportSettings is the locale and time zone a user wants exports written in
+type ExportSettings struct {
+	Locale   string // Code of a locale in Locales, empty for ISO 8601
+	Timezone string // IANA time zone name, empty for the server's time zone
+}
+
+// ExportSettings returns the user's export locale and time zone
+func (u User) ExportSettings() ExportSettings {
+	return ExportSettings{Locale: u.ExportLocale, Timezone: u.ExportTimezone}
+}
+
+// Formatting resolves the settings to the locale and location exports are written with
+func (s ExportSettings) Formatting() (ExportFormatting, error) {
+	formatting := ExportFormatting{Locale: Locales[0], Location: time.Local}
+	if s.Locale != "" {
+		locale, ok := LookupLocale(s.Locale)
+		if !ok {
+			return formatting, fmt.Errorf("unsupported locale %q", s.Locale)
+		}
+		formatting.Locale = locale
+	}
+	if s.Timezone != "" {
+		location, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return formatting, fmt.Errorf("unknown time zone %q", s.Timezone)
+		}
+		formatting.Location = location
+	}
+	return formatting, nil
+}
+
+// ExportFormatting writes dates and numbers of exports in a locale and time zone
+type ExportFormatting struct {
+	Locale   Locale
+	Location *time.Location
+}
+
+// Date writes the day of a time in the export's time zone
+func (f ExportFormatting) Date(t time.Time) string {
+	return t.In(f.Location).Format(f.Locale.DateLayout)
+}
+
+// DateTime writes a time to the minute in the export's time zone
+func (f ExportFormatting) DateTime(t time.Time) string {
+	return t.In(f.Location).Format(f.Locale.DateTimeLayout)
+}
+
+// Decimal writes a number with a fixed number of decimals and the locale's decimal separator
+func (f ExportFormatting) Decimal(value float64, decimals int) string {
+	return strings.Replace(strconv.FormatFloat(value, 'f', decimals, 64), ".", f.Locale.Decimal, 1)
 }
 
 // RepositoryStatus holds the data to be displayed for each repository.
@@ -71,11 +410,125 @@ type RepositoryStatus struct {
 	Version             string
 	PipelineID          int
 	Status              string
+	Source              string // What triggered the latest pipeline
 	Date                time.Time
 	WebURL              string
 	LastSuccessPipeline *Pipeline
-	RecentPipelines     []Pipeline // Last 10 pipelines for hover view
+	RecentPipelines     []Pipeline         // Last 10 pipelines for hover view
+	Stages              []StageSummary     // Stages of the latest pipeline in order, for hover view
+	TestReport          *TestReportSummary // Nil when the latest pipeline has no test reports
+	Coverage            *float64           // Test coverage of the latest pipeline in percent, nil when not reported
+	Downstream          []Bridge           // Trigger jobs of the latest pipeline and its downstream pipelines
+	OwnStatus           string             // Status of the latest pipeline itself; Status includes its downstream pipelines
+	ClusterAgents       []ClusterAgent     // Agents for Kubernetes registered in the project
+	LatestRelease       *Release           // Latest release, or the latest tag of projects without releases
+	ScheduleProblems    []string           // Scheduled pipelines that are paused, missed a run or are stuck
+	LatestArtifact      *Job               // Newest job of the latest pipeline with unexpired artifacts
+	PreviousCoverage    *float64           // Test coverage of the pipeline before, for the delta
 	ProjectURL          string
+	HasAvatar           bool             // Whether the project's avatar can be loaded from /avatars/projects/:id
+	Stale               bool             // Served from the last known state because GitLab could not be reached
+	FetchedAt           time.Time        // When the status was fetched from GitLab
+	Error               string           // Why the status could not be fetched
+	Incident            string           // Title of the active incident affecting the project
+	Protection          *RefProtection   // Nil when it couldn't be determined
+	Criticality         string           // Criticality the user gave the project
+	Planning            *PlanningContext // Work in the current iteration, only looked up for failing pipelines
+}
+
+// TestReportSummary counts the test cases of a pipeline's JUnit reports by result
+type TestReportSummary struct {
+	Total   int `json:"count"`
+	Success int `json:"success"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+	Error   int `json:"error"`
+}
+
+// StageSummary is the combined status of the jobs in one stage of a pipeline
+type StageSummary struct {
+	Name       string
+	Status     string
+	FailedJobs []Job // Failed jobs that aren't allowed to fail
+}
+
+// ReleaseReadiness is what a release manager checks for a project before cutting a release
+type ReleaseReadiness struct {
+	ProjectID         int
+	ProjectName       string
+	ProjectPath       string
+	ProjectURL        string
+	DefaultBranch     string
+	LatestTag         *Tag      // Nil when the project has no tags
+	UnreleasedCommits int       // Commits on the default branch since the latest tag
+	Pipeline          *Pipeline // Latest pipeline of the default branch, nil when there is none
+	BlockingMRs       []MergeRequest
+	Error             string // Why the project could not be checked
+}
+
+// Ready reports whether the default branch pipeline succeeded and no merge requests block the release
+func (r ReleaseReadiness) Ready() bool {
+	return r.Error == "" && r.Pipeline != nil && r.Pipeline.Status == "success" && len(r.BlockingMRs) == 0
+}
+
+// ProjectChangelog holds the releases of a project within a date range, newest first
+type ProjectChangelog struct {
+	ProjectName string
+	ProjectPath string
+	ProjectURL  string
+	Releases    []Release
+	Error       string // Why the releases could not be fetched
+}
+
+// ProjectSchedules holds the pipeline schedules of a project, ordered by their next run
+type ProjectSchedules struct {
+	ProjectID   int
+	ProjectName string
+	ProjectPath string
+	ProjectURL  string
+	Schedules   []PipelineSchedule
+	Error       string // Why the schedules could not be fetched
+}
+
+// ScheduleForm is the input of the form creating a pipeline schedule
+type ScheduleForm struct {
+	ProjectID    int
+	Description  string
+	Ref          string
+	Cron         string
+	CronTimezone string
+	Active       bool
+}
+
+// ProjectTimings holds the stored timings of the recent finished pipelines of a project, newest first
+type ProjectTimings struct {
+	ProjectName string
+	ProjectPath string
+	ProjectURL  string
+	Timings     []PipelineTiming
+	Error       string // Why the timings could not be loaded
+}
+
+// Averages returns the mean seconds the pipelines waited for runners and ran
+func (p ProjectTimings) Averages() (queued, running float64) {
+	if len(p.Timings) == 0 {
+		return 0, 0
+	}
+	for _, timing := range p.Timings {
+		queued += timing.QueuedDuration
+		running += timing.Duration
+	}
+	return queued / float64(len(p.Timings)), running / float64(len(p.Timings))
+}
+
+// RefProtection tells whether a failing pipeline on a ref actually blocks anything
+type RefProtection struct {
+	// IsBranch is false for tags and deleted branches, whose protection isn't checked
+	IsBranch bool
+	// Protected reports whether the branch is protected, directly or by a wildcard rule
+	Protected bool
+	// PipelineRequired reports whether merge requests can only be merged when their pipeline succeeds
+	PipelineRequired bool
 }
 
 // SessionData holds the data stored in session
@@ -89,11 +542,58 @@ type SessionData struct {
 type SelectedProject struct {
 	bun.BaseModel `bun:"table:selected_projects,alias:sp"`
 
-	ID        int64     `bun:"id,pk,autoincrement"`
-	UserID    int64     `bun:"user_id,notnull"`
-	ProjectID int       `bun:"project_id,notnull"`
-	Path      string    `bun:"path,notnull"`
-	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp"`
+	ID          int64     `bun:"id,pk,autoincrement"`
+	UserID      int64     `bun:"user_id,notnull"`
+	ProjectID   int       `bun:"project_id,notnull"`
+	Path        string    `bun:"path,notnull"`
+	Ref         string    `bun:"ref"`         // Branch or tag whose pipelines are shown, empty for any
+	Criticality string    `bun:"criticality"` // Weight in the dashboard's health and order, CriticalityNormal when empty
+	CreatedAt   time.Time `bun:"created_at,notnull,default:current_timestamp"`
+}
+
+// Criticalities users can give their selected projects
+const (
+	CriticalityCritical = "critical"
+	CriticalityNormal   = "normal"
+	CriticalityLow      = "low"
+)
+
+// NormalizeCriticality returns a known criticality, CriticalityNormal for empty or unknown ones
+func NormalizeCriticality(criticality string) string {
+	switch criticality {
+	case CriticalityCritical, CriticalityLow:
+		return criticality
+	}
+	return CriticalityNormal
+}
+
+// CriticalityWeight is how much a project counts toward the weighted health, each criticality
+// twice as much as the one below
+func CriticalityWeight(criticality string) int {
+	switch NormalizeCriticality(criticality) {
+	case CriticalityCritical:
+		return 4
+	case CriticalityLow:
+		return 1
+	}
+	return 2
+}
+
+// WeightedHealth returns the share of the statuses that aren't failing in percent, weighted by
+// their criticality, and false when there are no statuses
+func WeightedHealth(statuses []RepositoryStatus) (int, bool) {
+	total, healthy := 0, 0
+	for _, status := range statuses {
+		weight := CriticalityWeight(status.Criticality)
+		total += weight
+		if status.Status != "failed" && status.Error == "" {
+			healthy += weight
+		}
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return healthy * 100 / total, true
 }
 
 // CachedProject represents a cached project from GitLab
@@ -107,7 +607,9 @@ type CachedProject struct {
 	Path              string    `bun:"path,notnull"`
 	PathWithNamespace string    `bun:"path_with_namespace,notnull"`
 	WebURL            string    `bun:"web_url,notnull"`
-	GroupID           int       `bun:"group_id"` // Parent group ID
+	AvatarURL         string    `bun:"avatar_url"` // Empty when the project has no avatar
+	GroupID           int       `bun:"group_id"`   // Parent group ID
+	Archived          bool      `bun:"archived,notnull,default:false"`
 	CreatedAt         time.Time `bun:"created_at,notnull,default:current_timestamp"`
 	UpdatedAt         time.Time `bun:"updated_at,notnull,default:current_timestamp"`
 }
@@ -123,6 +625,324 @@ type CachedGroup struct {
 	FullPath  string    `bun:"full_path,notnull"`
 	ParentID  int       `bun:"parent_id"` // Parent group ID
 	WebURL    string    `bun:"web_url,notnull"`
+	AvatarURL string    `bun:"avatar_url"` // Empty when the group has no avatar
 	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp"`
 	UpdatedAt time.Time `bun:"updated_at,notnull,default:current_timestamp"`
-}
\ No newline at end of file
+}
+
+// SyncState records when the GitLab structure cache was last synchronized
+type SyncState struct {
+	bun.BaseModel `bun:"table:sync_state,alias:ss"`
+
+	ID           int       `bun:"id,pk"` // Always 1, the table holds a single row
+	LastSync     time.Time `bun:"last_sync"`
+	LastFullSync time.Time `bun:"last_full_sync"`
+}
+
+// CacheSnapshotVersion is the format version of cache snapshot files
+const CacheSnapshotVersion = 1
+
+// CacheSnapshot is the GitLab structure cache saved to a file, with groups and projects in the
+// shape GitLab returns them, so new deployments can start with a populated tree
+type CacheSnapshot struct {
+	Version    int       `json:"version"`
+	GitLabURL  string    `json:"gitlab_url"`
+	ExportedAt time.Time `json:"exported_at"`
+	// SyncedAt is the last full sync of the exported cache; incremental syncs continue from it
+	SyncedAt time.Time `json:"synced_at"`
+	Groups   []Group   `json:"groups"`
+	Projects []Project `json:"projects"`
+}
+
+// BackupVersion is the format version of backup files
+const BackupVersion = 1
+
+// Backup is what gitlab-status backup saves: the users with their settings and selected projects,
+// and the incidents. The GitLab structure cache, statuses and pipeline history are left out, as
+// they are fetched from GitLab again.
+type Backup struct {
+	Version   int              `json:"version"`
+	CreatedAt time.Time        `json:"created_at"`
+	Users     []BackupUser     `json:"users"`
+	Incidents []BackupIncident `json:"incidents"`
+}
+
+// BackupUser is a user in a backup. IDs are kept, so the sessions of restored users stay theirs.
+type BackupUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Password string `json:"password"` // bcrypt hash
+	// GitLabToken is stored as in the database, encrypted when ENCRYPTION_KEY was set
+	GitLabToken    string            `json:"gitlab_token,omitempty"`
+	GitLabURL      string            `json:"gitlab_url,omitempty"`
+	StatusPalette  string            `json:"status_palette,omitempty"`
+	StatusShapes   bool              `json:"status_shapes"`
+	ExportLocale   string            `json:"export_locale,omitempty"`
+	ExportTimezone string            `json:"export_timezone,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+	Selections     []BackupSelection `json:"selected_projects"`
+}
+
+// BackupSelection is a project on a user's dashboard in a backup
+type BackupSelection struct {
+	ProjectID   int       `json:"project_id"`
+	Path        string    `json:"path"`
+	Ref         string    `json:"ref,omitempty"`
+	Criticality string    `json:"criticality,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// BackupIncident is a declared incident in a backup
+type BackupIncident struct {
+	Title         string    `json:"title"`
+	AffectedPaths string    `json:"affected_paths"`
+	StartedAt     time.Time `json:"started_at"`
+	ResolvedAt    time.Time `json:"resolved_at"`
+	DeclaredBy    string    `json:"declared_by"`
+	ResolvedBy    string    `json:"resolved_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// StructureChange describes a single group or project difference found by a sync preview
+type StructureChange struct {
+	ID      int
+	Name    string
+	OldPath string
+	NewPath string
+}
+
+// StructureDiff holds the changes a GitLab sync would apply to the cache
+type StructureDiff struct {
+	AddedGroups     []StructureChange
+	RemovedGroups   []StructureChange
+	RenamedGroups   []StructureChange
+	AddedProjects   []StructureChange
+	RemovedProjects []StructureChange
+	RenamedProjects []StructureChange
+}
+
+// IsEmpty reports whether the diff contains no changes
+func (d StructureDiff) IsEmpty() bool {
+	return len(d.AddedGroups) == 0 && len(d.RemovedGroups) == 0 && len(d.RenamedGroups) == 0 &&
+		len(d.AddedProjects) == 0 && len(d.RemovedProjects) == 0 && len(d.RenamedProjects) == 0
+}
+
+// InstanceInfo describes the GitLab instance and the capabilities detected from its version
+type InstanceInfo struct {
+	Version    string    `json:"version"`
+	Revision   string    `json:"revision"`
+	Enterprise bool      `json:"enterprise"`
+	KASEnabled bool      `json:"kas_enabled"`
+	DetectedAt time.Time `json:"detected_at"`
+	// GraphQL reports whether the GraphQL API is available (GitLab 12.1+)
+	GraphQL bool `json:"graphql"`
+	// KeysetPagination reports whether the projects API supports keyset pagination (GitLab 13.0+)
+	KeysetPagination bool `json:"keyset_pagination"`
+}
+
+// SchemaDrift is a GitLab API endpoint whose responses lack fields the application expects
+type SchemaDrift struct {
+	Endpoint      string    `json:"endpoint"` // API path with placeholders, e.g. /projects/:id/pipelines
+	Model         string    `json:"model"`
+	MissingFields []string  `json:"missing_fields"`
+	GitLabVersion string    `json:"gitlab_version"` // Empty when the version wasn't detected yet
+	DetectedAt    time.Time `json:"detected_at"`
+}
+
+// PipelineCoverage is the test coverage reported by a finished pipeline, stored so it is only fetched once
+type PipelineCoverage struct {
+	bun.BaseModel `bun:"table:pipeline_coverages,alias:pcov"`
+
+	PipelineID int       `bun:"pipeline_id,pk"`
+	ProjectID  int       `bun:"project_id,notnull"`
+	Coverage   *float64  `bun:"coverage"` // Nil when the pipeline reported no coverage
+	CreatedAt  time.Time `bun:"created_at,notnull,default:current_timestamp"`
+}
+
+// PipelineTiming is how long a finished pipeline waited for runners and ran, stored so it is only fetched once
+type PipelineTiming struct {
+	bun.BaseModel `bun:"table:pipeline_timings,alias:ptim"`
+
+	PipelineID     int       `bun:"pipeline_id,pk"`
+	ProjectID      int       `bun:"project_id,notnull"`
+	Ref            string    `bun:"ref"`
+	Status         string    `bun:"status"`
+	WebURL         string    `bun:"web_url"`
+	Duration       float64   `bun:"duration,notnull"`        // Seconds spent running
+	QueuedDuration float64   `bun:"queued_duration,notnull"` // Seconds spent waiting for runners
+	PipelineDate   time.Time `bun:"pipeline_date,notnull"`
+	CreatedAt      time.Time `bun:"created_at,notnull,default:current_timestamp"`
+}
+
+// PipelineRecord is a pipeline seen while polling GitLab, stored as the history of a project's
+// pipelines for trends and success rates
+type PipelineRecord struct {
+	bun.BaseModel `bun:"table:pipeline_history,alias:phist"`
+
+	PipelineID     int       `bun:"pipeline_id,pk"`
+	ProjectID      int       `bun:"project_id,notnull"`
+	Ref            string    `bun:"ref"`
+	Status         string    `bun:"status"`
+	Source         string    `bun:"source"`
+	WebURL         string    `bun:"web_url"`
+	Duration       *float64  `bun:"duration"`           // Seconds spent running, nil until the finished pipeline's details were fetched
+	QueuedDuration *float64  `bun:"queued_duration"`    // Seconds spent waiting for runners, nil like Duration
+	CreatedAt      time.Time `bun:"created_at,notnull"` // When GitLab created the pipeline
+	UpdatedAt      time.Time `bun:"updated_at"`         // When GitLab last changed the pipeline
+	FinishedAt     time.Time `bun:"finished_at,nullzero"`
+	FirstSeenAt    time.Time `bun:"first_seen_at,notnull"`
+}
+
+// HistoryImport is the progress of importing the pipeline history of projects from GitLab
+type HistoryImport struct {
+	Running    bool
+	Paths      []string // Project paths to import
+	Since      time.Time
+	Current    string // Path of the project being imported
+	Imported   int    // Pipelines whose details were stored
+	Skipped    int    // Pipelines that were already stored
+	Errors     []string
+	StartedBy  string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// JobRun is one run of a background job, such as the GitLab structure sync
+type JobRun struct {
+	bun.BaseModel `bun:"table:job_runs,alias:jr"`
+
+	ID         int64     `bun:"id,pk,autoincrement"`
+	Job        string    `bun:"job,notnull"`
+	StartedAt  time.Time `bun:"started_at,notnull"`
+	DurationMs int64     `bun:"duration_ms,notnull"`
+	Items      int       `bun:"items,notnull"` // Groups and projects synced, projects recorded or pipelines imported
+	Error      string    `bun:"error"`         // Empty when the run succeeded
+}
+
+// Duration returns how long the run took
+func (r JobRun) Duration() time.Duration {
+	return time.Duration(r.DurationMs) * time.Millisecond
+}
+
+// AuditEntry records an action a user took in GitLab through the status page, such as running a pipeline
+type AuditEntry struct {
+	bun.BaseModel `bun:"table:audit_log,alias:al"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	Action    string    `bun:"action,notnull"`
+	Actor     string    `bun:"actor,notnull"`
+	ProjectID int       `bun:"project_id,notnull"`
+	Target    string    `bun:"target"` // What the action was taken on, e.g. the ref or job
+	Error     string    `bun:"error"`  // Empty when GitLab accepted the action
+	ClientIP  string    `bun:"client_ip"`
+	UserAgent string    `bun:"user_agent"`
+	CreatedAt time.Time `bun:"created_at,notnull"`
+}
+
+// DeepLinkHit counts how often a /go/ redirect was followed for a project
+type DeepLinkHit struct {
+	bun.BaseModel `bun:"table:deep_link_hits,alias:dlh"`
+
+	ProjectID  int       `bun:"project_id,pk"`
+	Target     string    `bun:"target,pk"` // "latest" or "last-success"
+	Hits       int       `bun:"hits,notnull"`
+	LastUsedAt time.Time `bun:"last_used_at,notnull"`
+}
+
+// StatusSnapshot is the pipeline status of a selected project recorded at a point in time
+type StatusSnapshot struct {
+	bun.BaseModel `bun:"table:status_snapshots,alias:snap"`
+
+	ID              int64     `bun:"id,pk,autoincrement"`
+	TakenAt         time.Time `bun:"taken_at,notnull"` // Shared by all rows recorded in the same run
+	ProjectID       int       `bun:"project_id,notnull"`
+	TrackedRef      string    `bun:"tracked_ref"` // Ref preference of the selection, empty for any
+	ProjectName     string    `bun:"project_name"`
+	ProjectPath     string    `bun:"project_path"`
+	Ref             string    `bun:"ref"`
+	PipelineID      int       `bun:"pipeline_id"`
+	Status          string    `bun:"status"`
+	PipelineDate    time.Time `bun:"pipeline_date"`
+	WebURL          string    `bun:"web_url"`
+	ProjectURL      string    `bun:"project_url"`
+	LastSuccessID   int       `bun:"last_success_id"`
+	LastSuccessDate time.Time `bun:"last_success_date"`
+	Stale           bool      `bun:"stale"`
+	Error           string    `bun:"error"`
+}
+
+// LastKnownStatus is the last status fetched from GitLab for a selected project and tracked ref,
+// kept so the status page can still show it after a restart while GitLab is unreachable
+type LastKnownStatus struct {
+	bun.BaseModel `bun:"table:last_known_statuses,alias:lks"`
+
+	ProjectID  int              `bun:"project_id,pk"`
+	TrackedRef string           `bun:"tracked_ref,pk"` // Ref preference of the selection, empty for any
+	Status     RepositoryStatus `bun:"status,type:text"`
+	FetchedAt  time.Time        `bun:"fetched_at,notnull"`
+}
+
+// Session is a login session kept in the database with SESSION_STORE=db; the cookie only holds
+// a random ID, of which the hash is stored
+type Session struct {
+	bun.BaseModel `bun:"table:sessions,alias:sess"`
+
+	ID        string    `bun:"id,pk"` // Hex SHA-256 of the ID in the cookie
+	Data      []byte    `bun:"data"`  // gob-encoded session values
+	ExpiresAt time.Time `bun:"expires_at,notnull"`
+	UpdatedAt time.Time `bun:"updated_at,notnull"`
+}
+
+// TokenValidation is the result of checking the GitLab API token
+type TokenValidation struct {
+	Username  string     `json:"username"`
+	TokenName string     `json:"token_name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CheckedAt time.Time  `json:"checked_at"`
+	// Problems lists what is wrong with the token, with what to do about it; empty when the token is usable
+	Problems []string `json:"problems"`
+}
+
+// Valid reports whether no problems were found with the token
+func (v TokenValidation) Valid() bool {
+	return len(v.Problems) == 0
+}
+
+// Incident is an outage declared by an admin, shown as a banner on the status page
+type Incident struct {
+	bun.BaseModel `bun:"table:incidents,alias:inc"`
+
+	ID            int64     `bun:"id,pk,autoincrement"`
+	Title         string    `bun:"title,notnull"`
+	AffectedPaths string    `bun:"affected_paths"` // Newline-separated project or group paths
+	StartedAt     time.Time `bun:"started_at,notnull"`
+	ResolvedAt    time.Time `bun:"resolved_at,nullzero"`
+	DeclaredBy    string    `bun:"declared_by"`
+	ResolvedBy    string    `bun:"resolved_by"`
+	CreatedAt     time.Time `bun:"created_at,notnull,default:current_timestamp"`
+}
+
+// Paths returns the affected project and group paths
+func (i Incident) Paths() []string {
+	var paths []string
+	for _, path := range strings.Split(i.AffectedPaths, "\n") {
+		if path = strings.Trim(strings.TrimSpace(path), "/"); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Affects reports whether a project path is one of the affected projects or within an affected group
+func (i Incident) Affects(projectPath string) bool {
+	projectPath = strings.ToLower(projectPath)
+	for _, path := range i.Paths() {
+		path = strings.ToLower(path)
+		if projectPath == path || strings.HasPrefix(projectPath, path+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+// Package redisstore shares sessions and the last known pipeline statuses between instances
+// through Redis, so they survive restarts and every replica behind a load balancer sees them.
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyPrefix namespaces the keys, so the Redis database can be shared with other applications
+const keyPrefix = "gitlab-status:"
+
+// connectTimeout bounds the check that Redis answers on startup
+const connectTimeout = 5 * time.Second
+
+// Connect opens a connection to the Redis server at a redis:// or rediss:// URL and checks that it answers
+func Connect(ctx context.Context, redisURL string) (*redis.Client, error) {
+	options, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %v", err)
+	}
+	client := redis.NewClient(options)
+
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("error connecting to Redis at %s: %v", options.Addr, err)
+	}
+	return client, nil
+}
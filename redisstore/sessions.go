@@ -0,0 +1,107 @@
+package redisstore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+// browserSessionLifetime is how long sessions with a MaxAge of 0, whose cookie lasts until the
+// browser closes, are kept
+const browserSessionLifetime = 24 * time.Hour
+
+// SessionStore keeps sessions in Redis, expiring with their MaxAge. Like the database session
+// store, the cookie holds a random ID and Redis only its hash. Types stored in the values must be
+// registered with gob, like for cookies.
+type SessionStore struct {
+	client  *redis.Client
+	Options *sessions.Options // Default options of new sessions; MaxAge is also their lifetime
+}
+
+// NewSessionStore returns a Redis session store with the given default options
+func NewSessionStore(client *redis.Client, options *sessions.Options) *SessionStore {
+	return &SessionStore{client: client, Options: options}
+}
+
+// Get returns the named session of the request, loading it once per request
+func (s *SessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session named in the request's cookie, or returns a new one when there is none
+// or it expired
+func (s *SessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.Options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return session, nil
+	}
+	data, err := s.client.Get(r.Context(), sessionKey(cookie.Value)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return session, nil
+	}
+	if err != nil {
+		return session, fmt.Errorf("error loading session: %v", err)
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&session.Values); err != nil {
+		return session, fmt.Errorf("error decoding session: %v", err)
+	}
+	session.ID = cookie.Value
+	session.IsNew = false
+	return session, nil
+}
+
+// Save stores the session and sets its cookie. A negative MaxAge deletes the session.
+func (s *SessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	ctx := r.Context()
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.client.Del(ctx, sessionKey(session.ID)).Err(); err != nil {
+				return fmt.Errorf("error deleting session: %v", err)
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		id := make([]byte, 32)
+		if _, err := rand.Read(id); err != nil {
+			return fmt.Errorf("error generating session ID: %v", err)
+		}
+		session.ID = base64.RawURLEncoding.EncodeToString(id)
+	}
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(session.Values); err != nil {
+		return fmt.Errorf("error encoding session: %v", err)
+	}
+	lifetime := time.Duration(session.Options.MaxAge) * time.Second
+	if lifetime == 0 {
+		lifetime = browserSessionLifetime
+	}
+	if err := s.client.Set(ctx, sessionKey(session.ID), data.Bytes(), lifetime).Err(); err != nil {
+		return fmt.Errorf("error saving session: %v", err)
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), session.ID, session.Options))
+	return nil
+}
+
+// sessionKey returns the Redis key of a session ID
+func sessionKey(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return keyPrefix + "session:" + hex.EncodeToString(sum[:])
+}
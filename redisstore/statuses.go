@@ -0,0 +1,60 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"gitlab-status/models"
+)
+
+// statusTTL is how long a last known status is kept without being fetched again, so projects
+// nobody tracks anymore disappear
+const statusTTL = 7 * 24 * time.Hour
+
+// StatusCache keeps the last known pipeline status of each project and tracked ref in Redis
+type StatusCache struct {
+	client *redis.Client
+}
+
+// NewStatusCache returns a status cache in the Redis database of client
+func NewStatusCache(client *redis.Client) *StatusCache {
+	return &StatusCache{client: client}
+}
+
+// Get returns the status stored under key, false when there is none
+func (c *StatusCache) Get(ctx context.Context, key string) (models.RepositoryStatus, bool, error) {
+	var status models.RepositoryStatus
+	data, err := c.client.Get(ctx, statusKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return status, false, nil
+	}
+	if err != nil {
+		return status, false, fmt.Errorf("error loading status: %v", err)
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return status, false, fmt.Errorf("error decoding status: %v", err)
+	}
+	return status, true, nil
+}
+
+// Set stores a status under key
+func (c *StatusCache) Set(ctx context.Context, key string, status models.RepositoryStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("error encoding status: %v", err)
+	}
+	if err := c.client.Set(ctx, statusKey(key), data, statusTTL).Err(); err != nil {
+		return fmt.Errorf("error saving status: %v", err)
+	}
+	return nil
+}
+
+// statusKey returns the Redis key of a status
+func statusKey(key string) string {
+	return keyPrefix + "status:" + key
+}
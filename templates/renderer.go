@@ -10,6 +10,9 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// AppVersion is the application version shown in page footers
+var AppVersion = "dev"
+
 // TemplateRenderer is a custom HTML templating renderer for Echo.
 type TemplateRenderer struct {
 	templates *template.Template